@@ -2,31 +2,210 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/tomasz-sikora/logic-mcp/internal/auth"
+	"github.com/tomasz-sikora/logic-mcp/internal/config"
+	"github.com/tomasz-sikora/logic-mcp/internal/logging"
+	"github.com/tomasz-sikora/logic-mcp/internal/metrics"
 	"github.com/tomasz-sikora/logic-mcp/internal/prolog"
+	"github.com/tomasz-sikora/logic-mcp/internal/quota"
 	"github.com/tomasz-sikora/logic-mcp/internal/tools"
+	"github.com/tomasz-sikora/logic-mcp/internal/workspace"
 )
 
 func main() {
+	cfg := config.Default()
+
 	var (
-		mode = flag.String("mode", "stdio", "Server mode: stdio or http")
-		port = flag.String("port", "8080", "HTTP server port (when mode=http)")
+		configPath  = flag.String("config", "", "YAML or JSON config file (default $"+config.EnvPrefix+"CONFIG)")
+		printConfig = flag.Bool("print-config", false, "Print the effective configuration and exit")
+		hashToken   = flag.Bool("hash-token", false, "Read a token from stdin, print its SHA-256 hash for the auth file and exit")
 	)
+
+	flag.StringVar(&cfg.Mode, "mode", cfg.Mode, "Server mode: stdio or http")
+	flag.StringVar(&cfg.Port, "port", cfg.Port, "HTTP server port (when mode=http)")
+	flag.DurationVar(&cfg.DrainTimeout, "drain-timeout", cfg.DrainTimeout, "Time running queries get to finish on SIGINT or SIGTERM before they are cancelled")
+
+	flag.BoolVar(&cfg.Metrics.Enabled, "metrics", cfg.Metrics.Enabled, "Expose Prometheus metrics at /metrics")
+	flag.StringVar(&cfg.Metrics.Addr, "metrics-addr", cfg.Metrics.Addr, "Metrics listen address (when mode=stdio)")
+
+	flag.StringVar(&cfg.Log.Level, "log-level", cfg.Log.Level, "Log level: debug, info, warn or error")
+	flag.StringVar(&cfg.Log.Format, "log-format", cfg.Log.Format, "Log format: text or json")
+	flag.StringVar(&cfg.Audit.Path, "audit-log", cfg.Audit.Path, "Append a JSONL audit record of every tool call to this file")
+	flag.IntVar(&cfg.Audit.MaxArgBytes, "audit-max-arg-bytes", cfg.Audit.MaxArgBytes, "Maximum size of tool arguments recorded in the audit log")
+	flag.Var((*stringList)(&cfg.Audit.Redact), "audit-redact", "Comma-separated tool argument names to redact in the audit log")
+
+	flag.StringVar(&cfg.Auth.File, "auth-file", cfg.Auth.File, "JSON file with bearer token hashes, JWT keys and policies (when mode=http)")
+
+	flag.StringVar(&cfg.Engine.Sandbox, "sandbox", cfg.Engine.Sandbox, "Default sandbox level: none or restricted")
+	flag.DurationVar(&cfg.Engine.QueryTimeout, "query-timeout", cfg.Engine.QueryTimeout, "Maximum duration of a single query (0 = unlimited)")
+	flag.StringVar(&cfg.Engine.TempDir, "temp-dir", cfg.Engine.TempDir, "Directory for generated Prolog files (default system temp dir)")
+	flag.Var((*stringList)(&cfg.Engine.AllowedLibraries), "allowed-libraries", "Comma-separated libraries that :- use_module directives may load")
+
+	flag.Var((*stringList)(&cfg.Preload.Paths), "preload", "Comma-separated .pl files or directories loaded read-only into every session")
+	flag.DurationVar(&cfg.Preload.ReloadInterval, "preload-reload-interval", cfg.Preload.ReloadInterval, "How often preload files are checked for changes (0 = never)")
+	flag.Var((*stringList)(&cfg.Workspace.Roots), "workspace-root", "Comma-separated directories whose .pl files the file tools may load")
+
+	flag.IntVar(&cfg.Quotas.QueriesPerMinute, "quota-queries-per-minute", 0, "Maximum queries per minute per session (0 = unlimited)")
+	flag.IntVar(&cfg.Quotas.ConcurrentQueries, "quota-concurrent-queries", 0, "Maximum concurrent queries per session (0 = unlimited)")
+	flag.Float64Var(&cfg.Quotas.CPUSeconds, "quota-cpu-seconds", 0, "Maximum swipl CPU seconds per session per hour (0 = unlimited)")
+	flag.IntVar(&cfg.Quotas.MaxClauses, "quota-max-clauses", 0, "Maximum clauses in a session knowledge base (0 = unlimited)")
+	flag.Int64Var(&cfg.Quotas.MaxBytes, "quota-max-bytes", 0, "Maximum bytes of clauses loaded into a session knowledge base (0 = unlimited)")
 	flag.Parse()
 
-	// Create function to build per-session servers with isolated engines
-	createSessionServer := func() (*mcp.Server, error) {
+	if *hashToken {
+		token, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read token: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(auth.HashToken(strings.TrimSpace(string(token))))
+		return
+	}
+
+	// Precedence is flags > environment > config file > defaults, so the
+	// explicitly set flags are re-applied after the file and environment
+	if err := loadConfig(cfg, *configPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		os.Exit(1)
+	}
+	if *printConfig {
+		out, err := cfg.YAML()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to render configuration: %v\n", err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(out)
+		return
+	}
+
+	// Logs go to stderr so they never interfere with the STDIO transport
+	logger, err := logging.New(os.Stderr, cfg.Log.Level, cfg.Log.Format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging configuration: %v\n", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
+	var auditLog *logging.AuditLog
+	if cfg.Audit.Path != "" {
+		opts := logging.AuditOptions{MaxArgBytes: cfg.Audit.MaxArgBytes}
+		if len(cfg.Audit.Redact) > 0 {
+			opts.Redactors = append(opts.Redactors, logging.RedactFields(cfg.Audit.Redact...))
+		}
+		auditLog, err = logging.OpenAuditLog(cfg.Audit.Path, opts)
+		if err != nil {
+			fatal("Failed to open audit log", "path", cfg.Audit.Path, "error", err)
+		}
+		defer auditLog.Close()
+		atExit = append(atExit, func() { auditLog.Close() })
+		logger.Info("Audit log enabled", "path", cfg.Audit.Path)
+	}
+
+	var authenticator *auth.Authenticator
+	if cfg.Auth.File != "" {
+		authConfig, err := auth.LoadConfig(cfg.Auth.File)
+		if err != nil {
+			fatal("Failed to load auth file", "error", err)
+		}
+		authenticator, err = auth.New(authConfig)
+		if err != nil {
+			fatal("Failed to configure authentication", "error", err)
+		}
+		if cfg.Mode != "http" {
+			logger.Warn("Authentication only applies in HTTP mode", "mode", cfg.Mode)
+		}
+	}
+
+	sessionLimits := cfg.Quotas
+	// Query quotas of a token are shared by all of its sessions. HTTP
+	// sessions are stateless, a new one per request, so their session
+	// quotas are kept per caller instead.
+	tokenQuotas := quota.NewRegistry("")
+	callerQuotas := quota.NewRegistry("session")
+	sessions := newSessionEngines()
+
+	// SIGINT and SIGTERM start a graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The preload library is compiled once and shared by all sessions
+	var library *prolog.Library
+	if len(cfg.Preload.Paths) > 0 {
+		library, err = prolog.NewLibrary(cfg.Preload.Paths, cfg.Engine.TempDir)
+		if err != nil {
+			fatal("Failed to compile preload library", "error", err)
+		}
+		defer library.Close()
+		if cfg.Preload.ReloadInterval > 0 {
+			go library.Watch(ctx, cfg.Preload.ReloadInterval)
+		}
+	}
+
+	var ws *workspace.Workspace
+	if len(cfg.Workspace.Roots) > 0 {
+		ws, err = workspace.New(cfg.Workspace.Roots)
+		if err != nil {
+			fatal("Invalid workspace", "error", err)
+		}
+	}
+
+	// Create function to build per-session servers with isolated engines.
+	// The caller identity is nil when authentication is disabled. Sessions
+	// with the same non-empty quotaKey share their session quotas.
+	createSessionServer := func(identity *auth.Identity, quotaKey string) (*mcp.Server, *prolog.Engine, error) {
+		sessionID := newSessionID()
+		sessionLogger := logger.With("session", sessionID)
+
+		engineOpts := prolog.EngineOptions{
+			Sandbox:          cfg.Engine.Sandbox,
+			QueryTimeout:     cfg.Engine.QueryTimeout,
+			TempDir:          cfg.Engine.TempDir,
+			Library:          library,
+			AllowedLibraries: cfg.Engine.AllowedLibraries,
+		}
+		kbLimits := sessionLimits
+		sessionQuota := quota.NewTracker("session", sessionLimits)
+		if quotaKey != "" {
+			sessionQuota = callerQuotas.Tracker(quotaKey, sessionLimits)
+		}
+		trackers := []*quota.Tracker{sessionQuota}
+		var caller string
+		if identity != nil {
+			caller = identity.Key()
+			sessionLogger = sessionLogger.With("caller", identity.Key(), "policy", identity.PolicyName)
+			if identity.Policy.Sandbox != "" {
+				engineOpts.Sandbox = identity.Policy.Sandbox
+			}
+
+			tokenLimits := identity.Policy.Limits()
+			trackers = append(trackers, tokenQuotas.Tracker(identity.Key(), tokenLimits))
+			kbLimits = kbLimits.Merge(tokenLimits)
+		}
+		engineOpts.MaxClauses = kbLimits.MaxClauses
+		engineOpts.MaxBytes = kbLimits.MaxBytes
+		engineOpts.Quotas = trackers
+
 		// Create isolated Prolog engine for this session
-		prologEngine, err := prolog.NewEngine()
+		prologEngine, err := prolog.NewEngineWithOptions(engineOpts)
 		if err != nil {
-			return nil, fmt.Errorf("failed to initialize session Prolog engine: %v", err)
+			return nil, nil, fmt.Errorf("failed to initialize session Prolog engine: %v", err)
 		}
+		sessions.add(prologEngine)
 
 		// Create MCP server for this session
 		server := mcp.NewServer(&mcp.Implementation{
@@ -35,57 +214,229 @@ func main() {
 		}, nil)
 
 		// Initialize logic tools with session engine
-		logicTools := tools.NewLogicTools(prologEngine)
+		logicTools := tools.NewLogicToolsWithOptions(prologEngine, tools.Options{
+			Quotas:    trackers,
+			Workspace: ws,
+			Session:   sessionID,
+			Caller:    caller,
+		})
 
 		// Add all tools to the session server
 		if err := logicTools.RegisterTools(server); err != nil {
-			return nil, fmt.Errorf("failed to register tools: %v", err)
+			sessions.close(prologEngine)
+			return nil, nil, fmt.Errorf("failed to register tools: %v", err)
 		}
 
-		return server, nil
+		if identity != nil {
+			server.AddReceivingMiddleware(auth.ToolMiddleware(identity))
+		}
+		server.AddReceivingMiddleware(logging.ToolCalls(sessionLogger))
+		if auditLog != nil {
+			server.AddReceivingMiddleware(auditLog.Middleware(sessionID, prologEngine.KnowledgeBaseHash))
+		}
+
+		sessionLogger.Debug("Created session server")
+		return server, prologEngine, nil
+	}
+
+	// drain gives running queries until the drain timeout to finish, then
+	// cancels them and closes every session engine
+	drain := func() {
+		logger.Info("Shutting down", "drain_timeout", cfg.DrainTimeout)
+		drainCtx, cancel := context.WithTimeout(context.Background(), cfg.DrainTimeout)
+		defer cancel()
+		sessions.shutdown(drainCtx)
 	}
 
 	// Start server based on mode
-	switch *mode {
+	switch cfg.Mode {
 	case "stdio":
-		log.Println("Starting MCP server in STDIO mode...")
+		logger.Info("Starting MCP server in STDIO mode")
 		// Create dedicated server for STDIO mode (single session)
-		server, err := createSessionServer()
+		server, _, err := createSessionServer(nil, "")
 		if err != nil {
-			log.Fatalf("Failed to create STDIO server: %v", err)
+			fatal("Failed to create STDIO server", "error", err)
 		}
-		err = server.Run(context.Background(), &mcp.StdioTransport{})
-		if err != nil {
-			log.Fatalf("STDIO server error: %v", err)
+		var metricsServer *http.Server
+		if cfg.Metrics.Enabled {
+			// STDIO carries the MCP protocol, so metrics get their own listener
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", metrics.Handler())
+			metricsServer = &http.Server{Addr: cfg.Metrics.Addr, Handler: mux}
+			go func() {
+				logger.Info("Metrics listening", "addr", cfg.Metrics.Addr)
+				if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					logger.Error("Metrics server error", "error", err)
+				}
+			}()
+		}
+
+		// The session stays connected while its queries drain
+		runCtx, cancelRun := context.WithCancel(context.Background())
+		go func() {
+			<-ctx.Done()
+			drain()
+			cancelRun()
+		}()
+
+		err = server.Run(runCtx, &mcp.StdioTransport{})
+		if err != nil && runCtx.Err() == nil {
+			fatal("STDIO server error", "error", err)
 		}
-		log.Println("server.Run() completed without error")
+		cancelRun()
+		sessions.shutdown(runCtx)
+		// Metrics stay up while queries drain and go down with the session
+		if metricsServer != nil {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.DrainTimeout)
+			if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+				logger.Warn("Metrics server shutdown", "error", err)
+			}
+			cancel()
+			metricsServer.Close()
+		}
+		logger.Debug("server.Run() completed without error")
 	case "http":
-		log.Printf("Starting MCP server in HTTP mode on port %s...", *port)
+		logger.Info("Starting MCP server in HTTP mode", "port", cfg.Port)
 
 		// Create StreamableHTTPHandler with per-session server creation
-		handler := mcp.NewStreamableHTTPHandler(func(req *http.Request) *mcp.Server {
+		var handler http.Handler = mcp.NewStreamableHTTPHandler(func(req *http.Request) *mcp.Server {
 			// Create isolated server for each session
-			server, err := createSessionServer()
+			identity := auth.IdentityFromContext(req.Context())
+			server, engine, err := createSessionServer(identity, callerKey(identity, req))
 			if err != nil {
-				log.Printf("Failed to create session server: %v", err)
+				logger.Error("Failed to create session server", "error", err)
 				return nil // This will result in a 400 Bad Request
 			}
-			log.Printf("Created new session server for request from %s", req.RemoteAddr)
+			// Stateless sessions live exactly as long as their request
+			context.AfterFunc(req.Context(), func() {
+				sessions.close(engine)
+			})
+			logger.Debug("Created new session server", "remote_addr", req.RemoteAddr)
 			return server
 		}, &mcp.StreamableHTTPOptions{
 			JSONResponse: true, // Use JSON responses for better debugging
 			Stateless:    true, // Enable stateless mode for easier HTTP testing
 		})
 
-		addr := fmt.Sprintf(":%s", *port)
-		log.Printf("MCP HTTP server listening on %s", addr)
-		if err := http.ListenAndServe(addr, handler); err != nil {
-			log.Fatalf("HTTP server error: %v", err)
+		if authenticator != nil {
+			handler = authenticator.Handler(handler)
+			logger.Info("Bearer token authentication enabled", "auth_file", cfg.Auth.File)
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle("/", handler)
+		if cfg.Metrics.Enabled {
+			mux.Handle("/metrics", metrics.Handler())
+			logger.Info("Metrics exposed at /metrics")
+		}
+
+		addr := fmt.Sprintf(":%s", cfg.Port)
+		httpServer := &http.Server{Addr: addr, Handler: mux}
+		serveErr := make(chan error, 1)
+		go func() {
+			logger.Info("MCP HTTP server listening", "addr", addr)
+			serveErr <- httpServer.ListenAndServe()
+		}()
+
+		select {
+		case err := <-serveErr:
+			fatal("HTTP server error", "error", err)
+		case <-ctx.Done():
 		}
+
+		// Stop accepting requests and let running ones finish; whatever is
+		// still running at the deadline is cancelled by drain
+		logger.Info("Draining HTTP requests", "drain_timeout", cfg.DrainTimeout)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.DrainTimeout)
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			logger.Warn("Drain timeout exceeded, cancelling running queries", "error", err)
+		}
+		cancel()
+		sessions.shutdown(shutdownCtx)
+		httpServer.Close()
 	default:
-		fmt.Fprintf(os.Stderr, "Invalid mode: %s. Use 'stdio' or 'http'\n", *mode)
-		os.Exit(1)
+		fatal("Invalid mode, use stdio or http", "mode", cfg.Mode)
 	}
 
-	log.Println("Server stopped")
+	logger.Info("Server stopped")
+}
+
+// loadConfig merges the config file and LOGIC_MCP_* environment variables
+// into cfg, re-applies the flags given on the command line and validates
+// the result
+func loadConfig(cfg *config.Config, path string) error {
+	explicit := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = f.Value.String()
+	})
+
+	if path == "" {
+		path = os.Getenv(config.EnvPrefix + "CONFIG")
+	}
+	if path != "" {
+		if err := cfg.LoadFile(path); err != nil {
+			return err
+		}
+	}
+	if err := cfg.ApplyEnv(os.LookupEnv); err != nil {
+		return err
+	}
+	for name, value := range explicit {
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("-%s: %w", name, err)
+		}
+	}
+	return cfg.Validate()
+}
+
+// stringList is a comma-separated list flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = nil
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// atExit holds the cleanups fatal runs, since os.Exit skips deferred calls
+var atExit []func()
+
+// fatal logs an error, closes the audit log and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	for _, f := range atExit {
+		f()
+	}
+	os.Exit(1)
+}
+
+// callerKey identifies the caller of an HTTP request for its session
+// quotas: the authenticated identity, or else the remote host
+func callerKey(identity *auth.Identity, req *http.Request) string {
+	if identity != nil {
+		return identity.Key()
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+// newSessionID returns a random identifier used to correlate logs and audit
+// records of one session
+func newSessionID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
 }
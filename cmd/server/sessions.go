@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/tomasz-sikora/logic-mcp/internal/prolog"
+)
+
+// sessionEngines tracks the Prolog engines of open sessions so shutdown can
+// close every one of them
+type sessionEngines struct {
+	mu      sync.Mutex
+	engines map[*prolog.Engine]struct{}
+}
+
+func newSessionEngines() *sessionEngines {
+	return &sessionEngines{engines: make(map[*prolog.Engine]struct{})}
+}
+
+func (s *sessionEngines) add(e *prolog.Engine) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.engines[e] = struct{}{}
+}
+
+// close closes one engine and stops tracking it
+func (s *sessionEngines) close(e *prolog.Engine) {
+	s.mu.Lock()
+	delete(s.engines, e)
+	s.mu.Unlock()
+
+	if err := e.Close(); err != nil {
+		slog.Warn("Failed to close session engine", "error", err)
+	}
+}
+
+// shutdown closes all engines in parallel. Running queries may finish until
+// ctx is done; then they are cancelled and their swipl processes killed.
+func (s *sessionEngines) shutdown(ctx context.Context) {
+	s.mu.Lock()
+	engines := s.engines
+	s.engines = make(map[*prolog.Engine]struct{})
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for e := range engines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := e.Shutdown(ctx); err != nil {
+				slog.Warn("Failed to shut down session engine", "error", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	mcpauth "github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/tomasz-sikora/logic-mcp/internal/quota"
+)
+
+// JSON-RPC error codes sent with HTTP 403 and 429 responses
+const (
+	CodeForbidden   = -32003
+	CodeRateLimited = -32029
+)
+
+// staticTokenLifetime is the expiration reported for static tokens, which do
+// not expire themselves but must carry one for the SDK bearer middleware
+const staticTokenLifetime = time.Hour
+
+// identityKey is the TokenInfo.Extra key holding the caller identity
+const identityKey = "logic_mcp_identity"
+
+// MaxBodyBytes bounds the HTTP request bodies read to authorize tool calls
+const MaxBodyBytes = 16 << 20
+
+// Identity kinds, so static token names and JWT subjects cannot collide
+const (
+	KindToken = "token"
+	KindJWT   = "jwt"
+)
+
+// Identity is an authenticated caller and the policy that applies to it
+type Identity struct {
+	// Kind is KindToken or KindJWT
+	Kind       string
+	Subject    string
+	PolicyName string
+	Policy     *Policy
+}
+
+// Key identifies the caller across requests for rate limits and quotas,
+// e.g. "token:ci" or "jwt:agent-7"
+func (id *Identity) Key() string {
+	return id.Kind + ":" + id.Subject
+}
+
+// Authenticator verifies bearer tokens and enforces their policies
+type Authenticator struct {
+	policies      map[string]*Policy
+	tokens        map[string]*Identity // keyed by SHA-256 of the token
+	jwt           *jwtValidator
+	policyClaim   string
+	defaultPolicy string
+	limiter       *quota.RateLimiter
+}
+
+// New creates an Authenticator from an auth config
+func New(cfg *Config) (*Authenticator, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	a := &Authenticator{
+		policies: cfg.Policies,
+		tokens:   make(map[string]*Identity),
+		limiter:  quota.NewRateLimiter(),
+	}
+	for _, t := range cfg.Tokens {
+		a.tokens[t.SHA256] = &Identity{
+			Kind:       KindToken,
+			Subject:    t.Name,
+			PolicyName: t.Policy,
+			Policy:     cfg.Policies[t.Policy],
+		}
+	}
+
+	if cfg.JWT != nil {
+		v, err := newJWTValidator(cfg.JWT)
+		if err != nil {
+			return nil, err
+		}
+		a.jwt = v
+		a.policyClaim = cfg.JWT.PolicyClaim
+		if a.policyClaim == "" {
+			a.policyClaim = "policy"
+		}
+		a.defaultPolicy = cfg.JWT.DefaultPolicy
+	}
+	return a, nil
+}
+
+// HashToken returns the hex SHA-256 digest under which a token is stored
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify is a TokenVerifier for static tokens and HMAC-signed JWTs
+func (a *Authenticator) Verify(ctx context.Context, token string, req *http.Request) (*mcpauth.TokenInfo, error) {
+	if id, ok := a.tokens[HashToken(token)]; ok {
+		return &mcpauth.TokenInfo{
+			Expiration: time.Now().Add(staticTokenLifetime),
+			Extra:      map[string]any{identityKey: id},
+		}, nil
+	}
+
+	if a.jwt == nil {
+		return nil, fmt.Errorf("%w: unknown token", mcpauth.ErrInvalidToken)
+	}
+	claims, err := a.jwt.validate(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", mcpauth.ErrInvalidToken, err)
+	}
+	// Callers without a subject would share one identity
+	if strings.TrimSpace(claims.Subject) == "" {
+		return nil, fmt.Errorf("%w: jwt has no subject", mcpauth.ErrInvalidToken)
+	}
+
+	policyName, _ := claims.Raw[a.policyClaim].(string)
+	if policyName == "" {
+		policyName = a.defaultPolicy
+	}
+	policy, ok := a.policies[policyName]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown policy %q", mcpauth.ErrInvalidToken, policyName)
+	}
+
+	expiration := claims.ExpiresAt
+	if expiration.IsZero() {
+		expiration = time.Now().Add(staticTokenLifetime)
+	}
+	return &mcpauth.TokenInfo{
+		Expiration: expiration,
+		Extra: map[string]any{identityKey: &Identity{
+			Kind:       KindJWT,
+			Subject:    claims.Subject,
+			PolicyName: policyName,
+			Policy:     policy,
+		}},
+	}, nil
+}
+
+// IdentityFromContext returns the caller identity stored by Handler, or nil
+func IdentityFromContext(ctx context.Context) *Identity {
+	return identityFromTokenInfo(mcpauth.TokenInfoFromContext(ctx))
+}
+
+func identityFromTokenInfo(info *mcpauth.TokenInfo) *Identity {
+	if info == nil {
+		return nil
+	}
+	id, _ := info.Extra[identityKey].(*Identity)
+	return id
+}
+
+// Handler wraps an MCP HTTP handler with bearer authentication (401),
+// per-identity rate limiting (429) and tool authorization (403)
+func (a *Authenticator) Handler(next http.Handler) http.Handler {
+	authorize := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := IdentityFromContext(r.Context())
+		if id == nil {
+			http.Error(w, "unauthenticated", http.StatusUnauthorized)
+			return
+		}
+
+		if ok, retryAfter := a.limiter.Allow(id.Key(), id.Policy.RequestsPerMinute); !ok {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			writeRPCError(w, http.StatusTooManyRequests, nil, CodeRateLimited,
+				fmt.Sprintf("rate limit of %d requests per minute exceeded, retry after %ds", id.Policy.RequestsPerMinute, seconds))
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxBodyBytes))
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					http.Error(w, fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+					return
+				}
+				http.Error(w, "failed to read body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			for _, call := range toolCalls(body) {
+				if !id.Policy.AllowsTool(call.name) {
+					writeRPCError(w, http.StatusForbidden, call.id, CodeForbidden,
+						fmt.Sprintf("tool %q is not permitted by policy %q", call.name, id.PolicyName))
+					return
+				}
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+
+	return mcpauth.RequireBearerToken(a.Verify, nil)(authorize)
+}
+
+// ToolMiddleware returns MCP middleware that rejects tools/call requests
+// the caller's policy does not permit. It backs up the HTTP check for
+// requests that reach the session by other means.
+func ToolMiddleware(id *Identity) mcp.Middleware {
+	return func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			if call, ok := req.(*mcp.CallToolRequest); ok && !id.Policy.AllowsTool(call.Params.Name) {
+				return nil, fmt.Errorf("forbidden: tool %q is not permitted by policy %q", call.Params.Name, id.PolicyName)
+			}
+			return next(ctx, method, req)
+		}
+	}
+}
+
+// toolCall is a tools/call request found in an HTTP body
+type toolCall struct {
+	id   json.RawMessage
+	name string
+}
+
+// toolCalls extracts tools/call requests from a JSON-RPC message or batch
+func toolCalls(body []byte) []toolCall {
+	type message struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params struct {
+			Name string `json:"name"`
+		} `json:"params"`
+	}
+
+	var msgs []message
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		if err := json.Unmarshal(body, &msgs); err != nil {
+			return nil
+		}
+	} else {
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			return nil
+		}
+		msgs = append(msgs, msg)
+	}
+
+	var calls []toolCall
+	for _, m := range msgs {
+		if m.Method == "tools/call" {
+			calls = append(calls, toolCall{id: m.ID, name: m.Params.Name})
+		}
+	}
+	return calls
+}
+
+// writeRPCError writes a JSON-RPC error response with the given HTTP status
+func writeRPCError(w http.ResponseWriter, status int, id json.RawMessage, code int, message string) {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"error":   map[string]any{"code": code, "message": message},
+	})
+}
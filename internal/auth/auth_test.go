@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func testConfig() *Config {
+	return &Config{
+		Policies: map[string]*Policy{
+			"admin":    {},
+			"readonly": {AllowedTools: []string{"prolog_query"}, RequestsPerMinute: 2},
+		},
+		Tokens: []TokenEntry{
+			{Name: "ci", SHA256: HashToken("ci-token"), Policy: "admin"},
+			{Name: "bot", SHA256: HashToken("bot-token"), Policy: "readonly"},
+		},
+		JWT: &JWTConfig{
+			Keys:          map[string]string{"k1": base64.StdEncoding.EncodeToString(testSecret)},
+			Issuer:        "logic-mcp-test",
+			DefaultPolicy: "readonly",
+		},
+	}
+}
+
+func signJWT(t *testing.T, claims map[string]any) string {
+	t.Helper()
+
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "kid": "k1"})
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, testSecret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestAuthenticator_Verify(t *testing.T) {
+	a, err := New(testConfig())
+	require.NoError(t, err)
+
+	valid := signJWT(t, map[string]any{"sub": "agent-7", "iss": "logic-mcp-test", "exp": time.Now().Add(time.Hour).Unix(), "policy": "admin"})
+	expired := signJWT(t, map[string]any{"sub": "agent-7", "iss": "logic-mcp-test", "exp": time.Now().Add(-time.Minute).Unix()})
+	wrongIssuer := signJWT(t, map[string]any{"sub": "agent-7", "iss": "elsewhere"})
+	noSubject := signJWT(t, map[string]any{"iss": "logic-mcp-test", "policy": "admin"})
+	emptySubject := signJWT(t, map[string]any{"sub": " ", "iss": "logic-mcp-test"})
+	sameAsToken := signJWT(t, map[string]any{"sub": "ci", "iss": "logic-mcp-test"})
+	tampered := valid[:len(valid)-2] + "xx"
+
+	tests := []struct {
+		name   string
+		token  string
+		key    string
+		policy string
+	}{
+		{"static token", "ci-token", "token:ci", "admin"},
+		{"jwt with policy claim", valid, "jwt:agent-7", "admin"},
+		{"jwt subject named like a token", sameAsToken, "jwt:ci", "readonly"},
+		{"unknown static token", "nope", "", ""},
+		{"expired jwt", expired, "", ""},
+		{"wrong issuer", wrongIssuer, "", ""},
+		{"tampered signature", tampered, "", ""},
+		{"jwt without subject", noSubject, "", ""},
+		{"jwt with empty subject", emptySubject, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := a.Verify(context.Background(), tt.token, nil)
+			if tt.key == "" {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			id := identityFromTokenInfo(info)
+			require.NotNil(t, id)
+			assert.Equal(t, tt.key, id.Key())
+			assert.Equal(t, tt.policy, id.PolicyName)
+		})
+	}
+}
+
+func TestAuthenticator_Handler(t *testing.T) {
+	a, err := New(testConfig())
+	require.NoError(t, err)
+
+	handler := a.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	call := func(token, tool string) *httptest.ResponseRecorder {
+		body := `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"` + tool + `","arguments":{}}}`
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, call("", "prolog_query").Code)
+	assert.Equal(t, http.StatusUnauthorized, call("wrong", "prolog_query").Code)
+	assert.Equal(t, http.StatusOK, call("ci-token", "prolog_clear_kb").Code)
+
+	forbidden := call("bot-token", "prolog_clear_kb")
+	assert.Equal(t, http.StatusForbidden, forbidden.Code)
+	assert.Contains(t, forbidden.Body.String(), `"code":-32003`)
+
+	// readonly allows two requests per minute; the 403 above used one
+	assert.Equal(t, http.StatusOK, call("bot-token", "prolog_query").Code)
+	limited := call("bot-token", "prolog_query")
+	assert.Equal(t, http.StatusTooManyRequests, limited.Code)
+	assert.NotEmpty(t, limited.Header().Get("Retry-After"))
+}
+
+func TestAuthenticator_HandlerBodyLimit(t *testing.T) {
+	a, err := New(testConfig())
+	require.NoError(t, err)
+
+	handler := a.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	body := `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"prolog_load_facts","arguments":{"facts":"` +
+		strings.Repeat("a", MaxBodyBytes) + `"}}}`
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer ci-token")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name  string
+		edit  func(*Config)
+		error string
+	}{
+		{"valid", func(*Config) {}, ""},
+		{"null policy", func(c *Config) { c.Policies["broken"] = nil }, `policy "broken": must be an object`},
+		{"short digest", func(c *Config) { c.Tokens[0].SHA256 = "abc" }, "64 character lowercase hex digest"},
+		{"uppercase digest", func(c *Config) { c.Tokens[0].SHA256 = strings.ToUpper(c.Tokens[0].SHA256) }, "64 character lowercase hex digest"},
+		{"non-hex digest", func(c *Config) { c.Tokens[0].SHA256 = strings.Repeat("g", 64) }, "64 character lowercase hex digest"},
+		{"unknown policy", func(c *Config) { c.Tokens[0].Policy = "root" }, `unknown policy "root"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			tt.edit(cfg)
+			err := cfg.Validate()
+			if tt.error == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.error)
+		})
+	}
+
+	// A null policy in the file is reported, not a panic
+	var cfg Config
+	require.NoError(t, json.Unmarshal([]byte(`{"policies": {"p": null}, "tokens": [{"name": "a", "sha256": "`+HashToken("a")+`", "policy": "p"}]}`), &cfg))
+	assert.Error(t, cfg.Validate())
+}
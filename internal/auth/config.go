@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/tomasz-sikora/logic-mcp/internal/prolog"
+	"github.com/tomasz-sikora/logic-mcp/internal/quota"
+)
+
+// Policy describes what a caller may do
+type Policy struct {
+	// AllowedTools lists permitted tool names; empty allows every tool
+	AllowedTools []string `json:"allowed_tools,omitempty"`
+	// Sandbox is the engine sandbox level for the caller's sessions
+	Sandbox string `json:"sandbox,omitempty"`
+	// RequestsPerMinute limits HTTP requests per identity; zero means unlimited
+	RequestsPerMinute int `json:"requests_per_minute,omitempty"`
+	// MaxKBClauses limits the knowledge base size of the caller's sessions
+	MaxKBClauses int `json:"max_kb_clauses,omitempty"`
+	// Quotas limit queries and resources; query quotas are shared by all
+	// sessions of the identity, knowledge base quotas apply per session
+	Quotas quota.Limits `json:"quotas,omitempty"`
+}
+
+// Limits returns the policy quotas, with MaxKBClauses folded in
+func (p *Policy) Limits() quota.Limits {
+	return p.Quotas.Merge(quota.Limits{MaxClauses: p.MaxKBClauses})
+}
+
+// AllowsTool reports whether the policy permits calling the named tool
+func (p *Policy) AllowsTool(name string) bool {
+	return len(p.AllowedTools) == 0 || slices.Contains(p.AllowedTools, name)
+}
+
+// TokenEntry is a static bearer token stored by its SHA-256 hash
+type TokenEntry struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+	Policy string `json:"policy"`
+}
+
+// JWTConfig configures validation of HMAC-signed JWTs
+type JWTConfig struct {
+	// Keys maps key ids to base64-encoded HMAC secrets
+	Keys     map[string]string `json:"keys"`
+	Issuer   string            `json:"issuer,omitempty"`
+	Audience string            `json:"audience,omitempty"`
+	// PolicyClaim names the claim holding the policy name; defaults to "policy"
+	PolicyClaim string `json:"policy_claim,omitempty"`
+	// DefaultPolicy applies when a token carries no policy claim
+	DefaultPolicy string `json:"default_policy,omitempty"`
+}
+
+// Config is the contents of an auth file
+type Config struct {
+	Policies map[string]*Policy `json:"policies"`
+	Tokens   []TokenEntry       `json:"tokens,omitempty"`
+	JWT      *JWTConfig         `json:"jwt,omitempty"`
+}
+
+// LoadConfig reads an auth file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read auth file: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse auth file %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid auth file %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// Validate checks that every token and JWT setting refers to a known policy
+func (c *Config) Validate() error {
+	if len(c.Tokens) == 0 && c.JWT == nil {
+		return fmt.Errorf("no tokens or jwt keys configured")
+	}
+
+	for name, p := range c.Policies {
+		if p == nil {
+			return fmt.Errorf("policy %q: must be an object, use {} to allow everything", name)
+		}
+		switch p.Sandbox {
+		case "", prolog.SandboxNone, prolog.SandboxRestricted:
+		default:
+			return fmt.Errorf("policy %q: invalid sandbox level %q", name, p.Sandbox)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i, t := range c.Tokens {
+		if t.Name == "" {
+			return fmt.Errorf("token %d: missing name", i)
+		}
+		if !isDigest(t.SHA256) {
+			return fmt.Errorf("token %q: sha256 must be a 64 character lowercase hex digest", t.Name)
+		}
+		if seen[t.SHA256] {
+			return fmt.Errorf("token %q: duplicate hash", t.Name)
+		}
+		seen[t.SHA256] = true
+		if _, ok := c.Policies[t.Policy]; !ok {
+			return fmt.Errorf("token %q: unknown policy %q", t.Name, t.Policy)
+		}
+	}
+
+	if c.JWT != nil {
+		if len(c.JWT.Keys) == 0 {
+			return fmt.Errorf("jwt: no keys configured")
+		}
+		if c.JWT.DefaultPolicy != "" {
+			if _, ok := c.Policies[c.JWT.DefaultPolicy]; !ok {
+				return fmt.Errorf("jwt: unknown default policy %q", c.JWT.DefaultPolicy)
+			}
+		}
+	}
+	return nil
+}
+
+// isDigest reports whether s is a SHA-256 digest as HashToken prints it
+func isDigest(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !(s[i] >= '0' && s[i] <= '9' || s[i] >= 'a' && s[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"slices"
+	"strings"
+	"time"
+)
+
+// jwtClaims holds the registered claims we check plus everything else
+type jwtClaims struct {
+	Subject   string
+	Issuer    string
+	Audience  []string
+	ExpiresAt time.Time
+	NotBefore time.Time
+	Raw       map[string]any
+}
+
+// jwtValidator validates HMAC-signed JWTs against local keys
+type jwtValidator struct {
+	keys     map[string][]byte
+	issuer   string
+	audience string
+	now      func() time.Time
+}
+
+func newJWTValidator(cfg *JWTConfig) (*jwtValidator, error) {
+	v := &jwtValidator{
+		keys:     make(map[string][]byte),
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+		now:      time.Now,
+	}
+	for kid, secret := range cfg.Keys {
+		key, err := base64.StdEncoding.DecodeString(secret)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %q: invalid base64: %w", kid, err)
+		}
+		if len(key) < 32 {
+			return nil, fmt.Errorf("jwt key %q: secret must be at least 32 bytes", kid)
+		}
+		v.keys[kid] = key
+	}
+	return v, nil
+}
+
+// validate checks the signature and time claims of a compact JWT
+func (v *jwtValidator) validate(token string) (*jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed jwt")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed jwt header: %w", err)
+	}
+
+	var newHash func() hash.Hash
+	switch header.Alg {
+	case "HS256":
+		newHash = sha256.New
+	case "HS384":
+		newHash = sha512.New384
+	case "HS512":
+		newHash = sha512.New
+	default:
+		return nil, fmt.Errorf("unsupported jwt algorithm %q", header.Alg)
+	}
+
+	key, err := v.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed jwt signature")
+	}
+	mac := hmac.New(newHash, key)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, fmt.Errorf("invalid jwt signature")
+	}
+
+	var raw map[string]any
+	if err := decodeSegment(parts[1], &raw); err != nil {
+		return nil, fmt.Errorf("malformed jwt claims: %w", err)
+	}
+	claims := parseClaims(raw)
+
+	now := v.now()
+	if !claims.ExpiresAt.IsZero() && !now.Before(claims.ExpiresAt) {
+		return nil, fmt.Errorf("jwt expired")
+	}
+	if !claims.NotBefore.IsZero() && now.Before(claims.NotBefore) {
+		return nil, fmt.Errorf("jwt not yet valid")
+	}
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return nil, fmt.Errorf("jwt issuer mismatch")
+	}
+	if v.audience != "" && !slices.Contains(claims.Audience, v.audience) {
+		return nil, fmt.Errorf("jwt audience mismatch")
+	}
+	return claims, nil
+}
+
+// key picks the signing key by id, or the only key when there is no id
+func (v *jwtValidator) key(kid string) ([]byte, error) {
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, nil
+		}
+	}
+	key, ok := v.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown jwt key id %q", kid)
+	}
+	return key, nil
+}
+
+func decodeSegment(seg string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func parseClaims(raw map[string]any) *jwtClaims {
+	c := &jwtClaims{Raw: raw}
+	c.Subject, _ = raw["sub"].(string)
+	c.Issuer, _ = raw["iss"].(string)
+	switch aud := raw["aud"].(type) {
+	case string:
+		c.Audience = []string{aud}
+	case []any:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				c.Audience = append(c.Audience, s)
+			}
+		}
+	}
+	if exp, ok := raw["exp"].(float64); ok {
+		c.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+	if nbf, ok := raw["nbf"].(float64); ok {
+		c.NotBefore = time.Unix(int64(nbf), 0)
+	}
+	return c
+}
@@ -0,0 +1,241 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/tomasz-sikora/logic-mcp/internal/logging"
+	"github.com/tomasz-sikora/logic-mcp/internal/prolog"
+	"github.com/tomasz-sikora/logic-mcp/internal/quota"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix prefixes every environment variable override
+const EnvPrefix = "LOGIC_MCP_"
+
+// Config is the complete server configuration. The yaml tags define both
+// the config file keys and, joined with underscores, the environment
+// variable names (engine.query_timeout is LOGIC_MCP_ENGINE_QUERY_TIMEOUT).
+type Config struct {
+	// Mode is stdio or http
+	Mode string `yaml:"mode"`
+	// Port is the HTTP listen port when Mode is http
+	Port string `yaml:"port"`
+	// DrainTimeout is how long running queries may finish after SIGINT or
+	// SIGTERM before they are cancelled
+	DrainTimeout time.Duration `yaml:"drain_timeout"`
+
+	Log       LogConfig       `yaml:"log"`
+	Audit     AuditConfig     `yaml:"audit"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Engine    EngineConfig    `yaml:"engine"`
+	Preload   PreloadConfig   `yaml:"preload"`
+	Workspace WorkspaceConfig `yaml:"workspace"`
+
+	// Quotas apply to every session
+	Quotas quota.Limits `yaml:"quotas"`
+}
+
+// LogConfig configures structured logging
+type LogConfig struct {
+	// Level is debug, info, warn or error
+	Level string `yaml:"level"`
+	// Format is text or json
+	Format string `yaml:"format"`
+}
+
+// AuditConfig configures the tool call audit log
+type AuditConfig struct {
+	// Path of the JSONL audit log; empty disables auditing
+	Path string `yaml:"path"`
+	// MaxArgBytes caps the recorded tool arguments
+	MaxArgBytes int `yaml:"max_arg_bytes"`
+	// Redact lists tool argument names replaced by a hash
+	Redact []string `yaml:"redact"`
+}
+
+// MetricsConfig configures the Prometheus endpoint
+type MetricsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Addr is the metrics listen address in stdio mode
+	Addr string `yaml:"addr"`
+}
+
+// AuthConfig configures HTTP authentication
+type AuthConfig struct {
+	// File is the auth file with token hashes, JWT keys and policies
+	File string `yaml:"file"`
+}
+
+// EngineConfig configures the Prolog engine of every session
+type EngineConfig struct {
+	// Sandbox is the default sandbox level: none or restricted
+	Sandbox string `yaml:"sandbox"`
+	// QueryTimeout bounds every query; zero disables the bound
+	QueryTimeout time.Duration `yaml:"query_timeout"`
+	// TempDir holds the generated Prolog files
+	TempDir string `yaml:"temp_dir"`
+	// AllowedLibraries are the libraries directives may load
+	AllowedLibraries []string `yaml:"allowed_libraries"`
+}
+
+// PreloadConfig configures the Prolog library shared by every session
+type PreloadConfig struct {
+	// Paths are .pl files or directories searched recursively for them
+	Paths []string `yaml:"paths"`
+	// ReloadInterval is how often the files are checked for changes; zero
+	// disables hot reload
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+}
+
+// WorkspaceConfig configures the directories the file tools may read
+type WorkspaceConfig struct {
+	// Roots are directories of .pl files; empty disables the file tools
+	Roots []string `yaml:"roots"`
+}
+
+// Default returns the built-in configuration
+func Default() *Config {
+	return &Config{
+		Mode: "stdio",
+		Port: "8080",
+
+		DrainTimeout: 15 * time.Second,
+		Log: LogConfig{
+			Level:  "info",
+			Format: "text",
+		},
+		Audit: AuditConfig{
+			MaxArgBytes: logging.DefaultMaxArgBytes,
+		},
+		Metrics: MetricsConfig{
+			Addr: ":9090",
+		},
+		Engine: EngineConfig{
+			Sandbox:          prolog.SandboxNone,
+			QueryTimeout:     30 * time.Second,
+			AllowedLibraries: slices.Clone(prolog.DefaultAllowedLibraries),
+		},
+		Preload: PreloadConfig{
+			ReloadInterval: 2 * time.Second,
+		},
+	}
+}
+
+// LoadFile merges a YAML or JSON config file into c. Keys that are not
+// part of the schema are rejected.
+func (c *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate checks the configuration and reports every problem found
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(field, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	switch c.Mode {
+	case "stdio", "http":
+	default:
+		fail("mode", "must be stdio or http, got %q", c.Mode)
+	}
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		fail("port", "must be a number between 1 and 65535, got %q", c.Port)
+	}
+	if c.DrainTimeout < 0 {
+		fail("drain_timeout", "must not be negative, got %s", c.DrainTimeout)
+	}
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		fail("log.level", "must be debug, info, warn or error, got %q", c.Log.Level)
+	}
+	switch c.Log.Format {
+	case "text", "json":
+	default:
+		fail("log.format", "must be text or json, got %q", c.Log.Format)
+	}
+
+	if c.Audit.MaxArgBytes <= 0 {
+		fail("audit.max_arg_bytes", "must be positive, got %d", c.Audit.MaxArgBytes)
+	}
+	if c.Metrics.Enabled && c.Mode == "stdio" && c.Metrics.Addr == "" {
+		fail("metrics.addr", "is required in stdio mode")
+	}
+	if c.Auth.File != "" {
+		if _, err := os.Stat(c.Auth.File); err != nil {
+			fail("auth.file", "%v", err)
+		}
+	}
+
+	switch c.Engine.Sandbox {
+	case prolog.SandboxNone, prolog.SandboxRestricted:
+	default:
+		fail("engine.sandbox", "must be %s or %s, got %q", prolog.SandboxNone, prolog.SandboxRestricted, c.Engine.Sandbox)
+	}
+	if c.Engine.QueryTimeout < 0 {
+		fail("engine.query_timeout", "must not be negative, got %s", c.Engine.QueryTimeout)
+	}
+	if c.Engine.TempDir != "" {
+		if info, err := os.Stat(c.Engine.TempDir); err != nil {
+			fail("engine.temp_dir", "%v", err)
+		} else if !info.IsDir() {
+			fail("engine.temp_dir", "%s is not a directory", c.Engine.TempDir)
+		}
+	}
+
+	for _, p := range c.Preload.Paths {
+		if _, err := os.Stat(p); err != nil {
+			fail("preload.paths", "%v", err)
+		}
+	}
+	if c.Preload.ReloadInterval < 0 {
+		fail("preload.reload_interval", "must not be negative, got %s", c.Preload.ReloadInterval)
+	}
+
+	for _, r := range c.Workspace.Roots {
+		if info, err := os.Stat(r); err != nil {
+			fail("workspace.roots", "%v", err)
+		} else if !info.IsDir() {
+			fail("workspace.roots", "%s is not a directory", r)
+		}
+	}
+
+	q := c.Quotas
+	if q.QueriesPerMinute < 0 || q.ConcurrentQueries < 0 || q.CPUSeconds < 0 || q.MaxClauses < 0 || q.MaxBytes < 0 {
+		fail("quotas", "limits must not be negative")
+	}
+
+	return errors.Join(errs...)
+}
+
+// YAML renders the configuration in config file format
+func (c *Config) YAML() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+}
+
+func TestConfig_FileThenEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+mode: http
+port: "9000"
+engine:
+  query_timeout: 5s
+quotas:
+  max_clauses: 100
+`), 0o600))
+
+	cfg := Default()
+	require.NoError(t, cfg.LoadFile(path))
+	require.NoError(t, cfg.ApplyEnv(env(map[string]string{
+		"LOGIC_MCP_PORT":                  "9100",
+		"LOGIC_MCP_ENGINE_SANDBOX":        "restricted",
+		"LOGIC_MCP_AUDIT_REDACT":          "facts, query",
+		"LOGIC_MCP_METRICS_ENABLED":       "true",
+		"LOGIC_MCP_QUOTAS_CPU_SECONDS":    "2.5",
+		"LOGIC_MCP_ENGINE_QUERY_TIMEOUT":  "1m",
+		"LOGIC_MCP_QUOTAS_MAX_BYTES":      "4096",
+		"LOGIC_MCP_SOMETHING_UNSUPPORTED": "ignored",
+	})))
+	require.NoError(t, cfg.Validate())
+
+	assert.Equal(t, "http", cfg.Mode)
+	assert.Equal(t, "9100", cfg.Port)
+	assert.Equal(t, "info", cfg.Log.Level, "defaults survive")
+	assert.Equal(t, "restricted", cfg.Engine.Sandbox)
+	assert.Equal(t, time.Minute, cfg.Engine.QueryTimeout)
+	assert.Equal(t, []string{"facts", "query"}, cfg.Audit.Redact)
+	assert.True(t, cfg.Metrics.Enabled)
+	assert.Equal(t, 100, cfg.Quotas.MaxClauses)
+	assert.Equal(t, 2.5, cfg.Quotas.CPUSeconds)
+	assert.Equal(t, int64(4096), cfg.Quotas.MaxBytes)
+}
+
+func TestConfig_LoadFileRejectsUnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"engine": {"timeout": "5s"}}`), 0o600))
+
+	err := Default().LoadFile(path)
+	assert.ErrorContains(t, err, "timeout")
+}
+
+func TestConfig_ApplyEnvInvalidValue(t *testing.T) {
+	err := Default().ApplyEnv(env(map[string]string{"LOGIC_MCP_ENGINE_QUERY_TIMEOUT": "soon"}))
+	assert.ErrorContains(t, err, "LOGIC_MCP_ENGINE_QUERY_TIMEOUT")
+}
+
+func TestConfig_ValidateReportsEveryField(t *testing.T) {
+	cfg := Default()
+	cfg.Mode = "grpc"
+	cfg.Port = "0"
+	cfg.Engine.Sandbox = "strict"
+	cfg.Quotas.MaxClauses = -1
+
+	err := cfg.Validate()
+	for _, field := range []string{"mode:", "port:", "engine.sandbox:", "quotas:"} {
+		assert.ErrorContains(t, err, field)
+	}
+	assert.NoError(t, Default().Validate())
+}
+
+func TestEnvVars(t *testing.T) {
+	vars := EnvVars()
+	assert.Contains(t, vars, "LOGIC_MCP_MODE")
+	assert.Contains(t, vars, "LOGIC_MCP_ENGINE_QUERY_TIMEOUT")
+	assert.Contains(t, vars, "LOGIC_MCP_QUOTAS_QUERIES_PER_MINUTE")
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ApplyEnv overrides c with LOGIC_MCP_* variables found by lookup (normally
+// os.LookupEnv). Lists are comma-separated.
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	return applyEnv(reflect.ValueOf(c).Elem(), EnvPrefix, lookup)
+}
+
+// EnvVars lists every supported environment variable
+func EnvVars() []string {
+	var names []string
+	walkFields(reflect.TypeOf(Config{}), EnvPrefix, func(name string, _ []int) {
+		names = append(names, name)
+	})
+	return names
+}
+
+func applyEnv(v reflect.Value, prefix string, lookup func(string) (string, bool)) error {
+	var firstErr error
+	walkFields(v.Type(), prefix, func(name string, index []int) {
+		raw, ok := lookup(name)
+		if !ok || firstErr != nil {
+			return
+		}
+		if err := setField(v.FieldByIndex(index), raw); err != nil {
+			firstErr = fmt.Errorf("%s: %w", name, err)
+		}
+	})
+	return firstErr
+}
+
+// walkFields calls fn for every leaf field of t with its variable name
+func walkFields(t reflect.Type, prefix string, fn func(name string, index []int)) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		name := prefix + strings.ToUpper(key)
+
+		if f.Type.Kind() == reflect.Struct {
+			walkFields(f.Type, name+"_", func(sub string, index []int) {
+				fn(sub, append([]int{i}, index...))
+			})
+			continue
+		}
+		fn(name, []int{i})
+	}
+}
+
+func setField(field reflect.Value, raw string) error {
+	raw = strings.TrimSpace(raw)
+
+	if field.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,406 @@
+package dataimport
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Input formats
+const (
+	FormatCSV   = "csv"
+	FormatJSON  = "json"  // array of objects
+	FormatJSONL = "jsonl" // one object per line
+)
+
+// Argument types
+const (
+	TypeAuto   = "auto"   // number if the value is numeric, atom otherwise
+	TypeNumber = "number" // the value must be numeric
+	TypeAtom   = "atom"
+	TypeString = "string" // double-quoted Prolog string
+)
+
+// DefaultMaxRows caps an import when Options.MaxRows is zero
+const DefaultMaxRows = 10000
+
+// Options controls the conversion of records to facts
+type Options struct {
+	// Predicate is the functor name of the generated facts
+	Predicate string
+	// Format is csv, json or jsonl; empty detects it from the data
+	Format string
+	// Columns selects the fields, in argument order. Empty uses every CSV
+	// column or the keys of the first JSON object, in order of appearance.
+	// Headerless CSV columns are named 1, 2, ...
+	Columns []string
+	// Types maps column names to an argument type; unlisted columns are TypeAuto
+	Types map[string]string
+	// NoHeader treats the first CSV row as data
+	NoHeader bool
+	// Delimiter separates CSV fields; zero means a comma
+	Delimiter rune
+	// MaxRows limits the number of facts; zero means DefaultMaxRows
+	MaxRows int
+}
+
+// Result holds the generated facts
+type Result struct {
+	Facts     []string `json:"facts"`
+	Columns   []string `json:"columns"`
+	Format    string   `json:"format"`
+	Truncated bool     `json:"truncated,omitempty"`
+}
+
+// Indicator returns the predicate indicator of the facts, e.g. employee/3
+func (r *Result) Indicator(predicate string) string {
+	return fmt.Sprintf("%s/%d", Atom(predicate), len(r.Columns))
+}
+
+// record is one input row as column name to value. CSV values are strings;
+// JSON values are whatever encoding/json produced.
+type record map[string]any
+
+// Convert turns CSV or JSON data into one fact per record
+func Convert(data []byte, opts Options) (*Result, error) {
+	if opts.Predicate == "" {
+		return nil, errors.New("predicate name is required")
+	}
+	for col, typ := range opts.Types {
+		switch typ {
+		case TypeAuto, TypeNumber, TypeAtom, TypeString:
+		default:
+			return nil, fmt.Errorf("column %q: unknown type %q (use auto, number, atom or string)", col, typ)
+		}
+	}
+	maxRows := opts.MaxRows
+	if maxRows <= 0 {
+		maxRows = DefaultMaxRows
+	}
+
+	format := opts.Format
+	if format == "" {
+		format = detectFormat(data)
+	}
+
+	var (
+		records []record
+		columns []string
+		more    bool
+		err     error
+	)
+	switch format {
+	case FormatCSV:
+		records, columns, more, err = readCSV(data, opts, maxRows)
+	case FormatJSON:
+		records, columns, more, err = readJSON(data, maxRows)
+	case FormatJSONL:
+		records, columns, more, err = readJSONLines(data, maxRows)
+	default:
+		return nil, fmt.Errorf("unknown format %q (use csv, json or jsonl)", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(opts.Columns) > 0 {
+		columns = opts.Columns
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("no columns to import")
+	}
+
+	result := &Result{Columns: columns, Format: format, Truncated: more}
+	functor := Atom(opts.Predicate)
+	for i, rec := range records {
+		args := make([]string, len(columns))
+		for j, col := range columns {
+			v, ok := rec[col]
+			if !ok && (format == FormatCSV || i == 0 && len(opts.Columns) > 0) {
+				return nil, fmt.Errorf("record %d: missing column %q", i+1, col)
+			}
+			// Keys absent from later JSON objects become null
+			arg, err := term(v, opts.Types[col])
+			if err != nil {
+				return nil, fmt.Errorf("record %d, column %q: %w", i+1, col, err)
+			}
+			args[j] = arg
+		}
+		result.Facts = append(result.Facts, fmt.Sprintf("%s(%s).", functor, strings.Join(args, ", ")))
+	}
+	return result, nil
+}
+
+func detectFormat(data []byte) string {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		return FormatJSON
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		return FormatJSONL
+	default:
+		return FormatCSV
+	}
+}
+
+func readCSV(data []byte, opts Options, maxRows int) ([]record, []string, bool, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	if opts.Delimiter != 0 {
+		r.Comma = opts.Delimiter
+	}
+	r.TrimLeadingSpace = true
+
+	var header []string
+	if !opts.NoHeader {
+		row, err := r.Read()
+		if err == io.EOF {
+			return nil, nil, false, errors.New("CSV data is empty")
+		}
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("invalid CSV: %w", err)
+		}
+		header = row
+	}
+
+	var records []record
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			return records, header, false, nil
+		}
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("invalid CSV: %w", err)
+		}
+		if len(records) == maxRows {
+			return records, header, true, nil
+		}
+		if header == nil {
+			for i := range row {
+				header = append(header, strconv.Itoa(i+1))
+			}
+		}
+
+		rec := make(record, len(row))
+		for i, v := range row {
+			if i < len(header) {
+				rec[header[i]] = v
+			}
+		}
+		records = append(records, rec)
+	}
+}
+
+func readJSON(data []byte, maxRows int) ([]record, []string, bool, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, nil, false, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	more := len(raw) > maxRows
+	if more {
+		raw = raw[:maxRows]
+	}
+	records, columns, err := decodeObjects(raw)
+	return records, columns, more, err
+}
+
+func readJSONLines(data []byte, maxRows int) ([]record, []string, bool, error) {
+	var raw []json.RawMessage
+	more := false
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if len(raw) == maxRows {
+			more = true
+			break
+		}
+		if !json.Valid(line) {
+			return nil, nil, false, fmt.Errorf("invalid JSON on line %d", i+1)
+		}
+		raw = append(raw, line)
+	}
+	records, columns, err := decodeObjects(raw)
+	return records, columns, more, err
+}
+
+// decodeObjects decodes JSON objects and returns the keys of the first one
+// in document order
+func decodeObjects(raw []json.RawMessage) ([]record, []string, error) {
+	var records []record
+	var columns []string
+	for i, msg := range raw {
+		dec := json.NewDecoder(bytes.NewReader(msg))
+		dec.UseNumber()
+		var rec record
+		if err := dec.Decode(&rec); err != nil || rec == nil {
+			return nil, nil, fmt.Errorf("record %d is not a JSON object", i+1)
+		}
+		if i == 0 {
+			keys, err := objectKeys(msg)
+			if err != nil {
+				return nil, nil, err
+			}
+			columns = keys
+		}
+		records = append(records, rec)
+	}
+	return records, columns, nil
+}
+
+// objectKeys returns the top-level keys of a JSON object in order
+func objectKeys(msg json.RawMessage) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(msg))
+	if _, err := dec.Token(); err != nil { // opening brace
+		return nil, err
+	}
+	var keys []string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, tok.(string))
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// term renders a value as a Prolog term of the given type
+func term(v any, typ string) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		if typ == TypeString {
+			return `""`, nil
+		}
+		return "null", nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case json.Number:
+		return scalar(v.String(), typ)
+	case string:
+		return scalar(v, typ)
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, err := term(item, TypeAuto)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	default:
+		// Nested objects are kept as their JSON text
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return String(string(b)), nil
+	}
+}
+
+// scalar renders a textual value as a number, atom or string
+func scalar(s, typ string) (string, error) {
+	switch typ {
+	case TypeString:
+		return String(s), nil
+	case TypeAtom:
+		return Atom(s), nil
+	}
+
+	if n, ok := number(s); ok {
+		return n, nil
+	}
+	if typ == TypeNumber {
+		return "", fmt.Errorf("%q is not a number", s)
+	}
+	return Atom(s), nil
+}
+
+// number returns s as a Prolog number if it is one
+func number(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	// Leading zeros mark identifiers such as postal codes, not numbers
+	digits := strings.TrimLeft(s, "+-")
+	if len(digits) > 1 && digits[0] == '0' && digits[1] != '.' {
+		return "", false
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return strconv.FormatInt(i, 10), true
+	}
+	// Prolog integers are unbounded, so larger ones are kept digit for digit
+	if bigInteger.MatchString(s) {
+		return strings.TrimPrefix(s, "+"), true
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return "", false
+	}
+	out := strconv.FormatFloat(f, 'g', -1, 64)
+	// Prolog floats need a fractional part or an exponent with a dot
+	if !strings.ContainsAny(out, ".") {
+		if mant, exp, ok := strings.Cut(out, "e"); ok {
+			out = mant + ".0e" + exp
+		} else {
+			out += ".0"
+		}
+	}
+	return out, true
+}
+
+var (
+	plainAtom  = regexp.MustCompile(`^[a-z][a-zA-Z0-9_]*$`)
+	bigInteger = regexp.MustCompile(`^[+-]?[0-9]+$`)
+)
+
+// Atom renders s as a Prolog atom, quoting and escaping it when needed
+func Atom(s string) string {
+	if plainAtom.MatchString(s) {
+		return s
+	}
+	return "'" + escape(s, '\'') + "'"
+}
+
+// String renders s as a double-quoted Prolog string
+func String(s string) string {
+	return `"` + escape(s, '"') + `"`
+}
+
+// escape escapes backslashes, the quote and every control character, the
+// latter as \xHH\ where Prolog has no shorter escape
+func escape(s string, quote rune) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == quote:
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case unicode.IsControl(r):
+			fmt.Fprintf(&b, `\x%x\`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
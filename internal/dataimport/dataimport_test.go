@@ -0,0 +1,95 @@
+package dataimport
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvert_CSV(t *testing.T) {
+	data := "name,dept,salary,zip\nAlice,Engineering,120000,02139\nbob,sales,85000.50,10001\n"
+
+	result, err := Convert([]byte(data), Options{Predicate: "employee"})
+	require.NoError(t, err)
+	assert.Equal(t, FormatCSV, result.Format)
+	assert.Equal(t, "employee/4", result.Indicator("employee"))
+	assert.Equal(t, []string{
+		"employee('Alice', 'Engineering', 120000, '02139').",
+		"employee(bob, sales, 85000.5, 10001).",
+	}, result.Facts)
+}
+
+func TestConvert_ColumnsTypesAndLimit(t *testing.T) {
+	data := "id;name;note\n1;Ann;\"it's \"\"fine\"\"\"\n2;Ben;a\\b\n3;Cy;x\n"
+
+	result, err := Convert([]byte(data), Options{
+		Predicate: "Person Note",
+		Delimiter: ';',
+		Columns:   []string{"note", "id"},
+		Types:     map[string]string{"note": TypeString, "id": TypeAtom},
+		MaxRows:   2,
+	})
+	require.NoError(t, err)
+	assert.True(t, result.Truncated)
+	assert.Equal(t, []string{
+		`'Person Note'("it's \"fine\"", '1').`,
+		`'Person Note'("a\\b", '2').`,
+	}, result.Facts)
+}
+
+func TestConvert_JSON(t *testing.T) {
+	data := `[{"name": "O'Brien", "age": 41, "active": true, "tags": ["a", 2], "meta": {"k": 1}},
+	          {"age": 7, "name": "line\nbreak"}]`
+
+	result, err := Convert([]byte(data), Options{Predicate: "person"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"name", "age", "active", "tags", "meta"}, result.Columns)
+	assert.Equal(t, []string{
+		`person('O\'Brien', 41, true, [a, 2], "{\"k\":1}").`,
+		`person('line\nbreak', 7, null, null, null).`,
+	}, result.Facts)
+}
+
+func TestConvert_JSONLines(t *testing.T) {
+	data := "{\"a\": 1.5e3}\n\n{\"a\": -2}\n{\"a\": 3}\n"
+
+	result, err := Convert([]byte(data), Options{Predicate: "v", MaxRows: 2})
+	require.NoError(t, err)
+	assert.Equal(t, FormatJSONL, result.Format)
+	assert.True(t, result.Truncated)
+	assert.Equal(t, []string{"v(1500.0).", "v(-2)."}, result.Facts)
+}
+
+func TestConvert_EscapesControlCharacters(t *testing.T) {
+	result, err := Convert([]byte("[{\"a\": \"x\\u0000y\\u001bz\\u007f\", \"b\": \"tab\\there\"}]"),
+		Options{Predicate: "p", Types: map[string]string{"b": TypeString}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{`p('x\x0\y\x1b\z\x7f\', "tab\there").`}, result.Facts)
+}
+
+func TestConvert_BigIntegers(t *testing.T) {
+	result, err := Convert([]byte(`{"id": 9007199254740993, "n": 123456789012345678901234567890, "f": 1.5}`),
+		Options{Predicate: "p"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"p(9007199254740993, 123456789012345678901234567890, 1.5)."}, result.Facts)
+
+	result, err = Convert([]byte("n\n+123456789012345678901234567890\n-123456789012345678901234567890\n"),
+		Options{Predicate: "p", Types: map[string]string{"n": TypeNumber}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"p(123456789012345678901234567890).", "p(-123456789012345678901234567890)."}, result.Facts)
+}
+
+func TestConvert_Errors(t *testing.T) {
+	_, err := Convert([]byte("a\nx\n"), Options{})
+	assert.ErrorContains(t, err, "predicate")
+
+	_, err = Convert([]byte("a\nx\n"), Options{Predicate: "p", Types: map[string]string{"a": TypeNumber}})
+	assert.ErrorContains(t, err, "not a number")
+
+	_, err = Convert([]byte("a\nx\n"), Options{Predicate: "p", Columns: []string{"b"}})
+	assert.ErrorContains(t, err, `missing column "b"`)
+
+	_, err = Convert([]byte(`[1, 2]`), Options{Predicate: "p"})
+	assert.ErrorContains(t, err, "not a JSON object")
+}
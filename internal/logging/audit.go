@@ -0,0 +1,240 @@
+package logging
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Audit outcomes. A call is recorded as AuditStarted before it runs and
+// again with its outcome when it returns.
+const (
+	AuditStarted   = "started"
+	AuditOK        = "ok"
+	AuditToolError = "tool_error"
+	AuditError     = "error"
+)
+
+// DefaultMaxArgBytes caps the size of recorded tool arguments
+const DefaultMaxArgBytes = 64 * 1024
+
+// AuditEntry is one line of the audit log
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	SessionID string    `json:"session_id"`
+	// Call numbers the tool calls of a session from 1, pairing the started
+	// record of a call with its outcome
+	Call               int64           `json:"call"`
+	Tool               string          `json:"tool"`
+	Arguments          json.RawMessage `json:"arguments,omitempty"`
+	ArgumentsTruncated bool            `json:"arguments_truncated,omitempty"`
+	ArgumentsSHA256    string          `json:"arguments_sha256,omitempty"`
+	Outcome            string          `json:"outcome"`
+	Error              string          `json:"error,omitempty"`
+	DurationMS         float64         `json:"duration_ms,omitempty"`
+	KBHash             string          `json:"kb_hash,omitempty"`
+}
+
+// Redactor rewrites tool arguments before they are written to the audit log
+type Redactor func(tool string, args map[string]any) map[string]any
+
+// AuditOptions configures an AuditLog
+type AuditOptions struct {
+	// MaxArgBytes caps recorded arguments; larger arguments are truncated.
+	// Zero means DefaultMaxArgBytes.
+	MaxArgBytes int
+	// Redactors are applied in order to the decoded arguments
+	Redactors []Redactor
+}
+
+// AuditLog is an append-only JSONL record of every tool invocation
+type AuditLog struct {
+	mu   sync.Mutex
+	w    io.Writer
+	file *os.File
+	opts AuditOptions
+}
+
+// OpenAuditLog opens (or creates) an audit log file for appending
+func OpenAuditLog(path string, opts AuditOptions) (*AuditLog, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	a := NewAuditLog(f, opts)
+	a.file = f
+	return a, nil
+}
+
+// NewAuditLog creates an audit log writing to w
+func NewAuditLog(w io.Writer, opts AuditOptions) *AuditLog {
+	if opts.MaxArgBytes <= 0 {
+		opts.MaxArgBytes = DefaultMaxArgBytes
+	}
+	return &AuditLog{w: w, opts: opts}
+}
+
+// Record appends an entry to the audit log. Entries are synced to disk
+// before Record returns, so they survive a crash of the server.
+func (a *AuditLog) Record(entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, err := a.w.Write(line); err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	if a.file != nil {
+		if err := a.file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync audit log: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close closes the underlying file, if any. Later entries are not written.
+func (a *AuditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	a.w = io.Discard
+	return err
+}
+
+// Middleware returns MCP middleware that records every tools/call made in a
+// session: with its arguments before it runs, so a call that crashes or
+// hangs the server is still on record, and with its outcome after it
+// returns. kbHash is called after the tool returns to capture the state of
+// the knowledge base the call left behind.
+func (a *AuditLog) Middleware(sessionID string, kbHash func() string) mcp.Middleware {
+	var calls atomic.Int64
+	return func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			call, ok := req.(*mcp.CallToolRequest)
+			if !ok {
+				return next(ctx, method, req)
+			}
+
+			start := time.Now()
+			started := AuditEntry{
+				Time:      start.UTC(),
+				SessionID: sessionID,
+				Call:      calls.Add(1),
+				Tool:      call.Params.Name,
+				Outcome:   AuditStarted,
+			}
+			a.setArguments(&started, call.Params.Name, call.Params.Arguments)
+			if recErr := a.Record(started); recErr != nil {
+				slog.Error("Failed to record audit entry", "error", recErr)
+			}
+
+			res, err := next(ctx, method, req)
+
+			// The arguments are in the started record; their hash pairs
+			// the two for readers that ignore Call
+			entry := AuditEntry{
+				Time:            time.Now().UTC(),
+				SessionID:       sessionID,
+				Call:            started.Call,
+				Tool:            call.Params.Name,
+				ArgumentsSHA256: started.ArgumentsSHA256,
+				DurationMS:      float64(time.Since(start).Microseconds()) / 1000,
+			}
+			entry.Outcome, entry.Error = callOutcome(res, err)
+			if kbHash != nil {
+				entry.KBHash = kbHash()
+			}
+
+			if recErr := a.Record(entry); recErr != nil {
+				slog.Error("Failed to record audit entry", "error", recErr)
+			}
+			return res, err
+		}
+	}
+}
+
+// setArguments stores redacted, size-capped arguments in the entry. The
+// hash is taken after redaction so it gives away nothing about a redacted
+// value that the recorded arguments do not.
+func (a *AuditLog) setArguments(entry *AuditEntry, tool string, raw json.RawMessage) {
+	if len(raw) == 0 {
+		return
+	}
+
+	args := raw
+	if len(a.opts.Redactors) > 0 {
+		var decoded map[string]any
+		if err := json.Unmarshal(raw, &decoded); err == nil {
+			for _, redact := range a.opts.Redactors {
+				decoded = redact(tool, decoded)
+			}
+			if encoded, err := json.Marshal(decoded); err == nil {
+				args = encoded
+			}
+		}
+	}
+	sum := sha256.Sum256(args)
+	entry.ArgumentsSHA256 = hex.EncodeToString(sum[:])
+
+	if len(args) > a.opts.MaxArgBytes {
+		// Keep the record valid JSON by storing the prefix as a string
+		truncated, _ := json.Marshal(string(args[:a.opts.MaxArgBytes]))
+		args = truncated
+		entry.ArgumentsTruncated = true
+	}
+	entry.Arguments = args
+}
+
+// callOutcome classifies the result of a tool call
+func callOutcome(res mcp.Result, err error) (string, string) {
+	if err != nil {
+		return AuditError, err.Error()
+	}
+	result, ok := res.(*mcp.CallToolResult)
+	if !ok || !result.IsError {
+		return AuditOK, ""
+	}
+	for _, c := range result.Content {
+		if text, ok := c.(*mcp.TextContent); ok {
+			return AuditToolError, text.Text
+		}
+	}
+	return AuditToolError, ""
+}
+
+// RedactFields returns a Redactor that replaces the named arguments of every
+// tool with a hash of their value, so identical inputs can still be matched
+func RedactFields(fields ...string) Redactor {
+	return func(tool string, args map[string]any) map[string]any {
+		for _, field := range fields {
+			v, ok := args[field]
+			if !ok {
+				continue
+			}
+			encoded, _ := json.Marshal(v)
+			sum := sha256.Sum256(encoded)
+			args[field] = "[redacted sha256:" + hex.EncodeToString(sum[:8]) + "]"
+		}
+		return args
+	}
+}
@@ -0,0 +1,142 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func callTool(t *testing.T, mw mcp.Middleware, args string, result *mcp.CallToolResult) {
+	t.Helper()
+
+	handler := mw(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		return result, nil
+	})
+	req := &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{
+		Name:      "prolog_load_facts",
+		Arguments: json.RawMessage(args),
+	}}
+	_, err := handler(context.Background(), "tools/call", req)
+	require.NoError(t, err)
+}
+
+func readEntries(t *testing.T, buf *bytes.Buffer) []AuditEntry {
+	t.Helper()
+
+	var entries []AuditEntry
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry AuditEntry
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestAuditLog_RecordsToolCall(t *testing.T) {
+	var buf bytes.Buffer
+	audit := NewAuditLog(&buf, AuditOptions{})
+
+	mw := audit.Middleware("session-1", func() string { return "abc" })
+	callTool(t, mw, `{"facts":"a."}`, &mcp.CallToolResult{})
+	callTool(t, mw, `{"facts":"b("}`, &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: "Failed to load facts"}},
+		IsError: true,
+	})
+
+	entries := readEntries(t, &buf)
+	require.Len(t, entries, 4)
+
+	assert.Equal(t, "session-1", entries[0].SessionID)
+	assert.Equal(t, int64(1), entries[0].Call)
+	assert.Equal(t, "prolog_load_facts", entries[0].Tool)
+	assert.JSONEq(t, `{"facts":"a."}`, string(entries[0].Arguments))
+	assert.Equal(t, AuditStarted, entries[0].Outcome)
+	assert.Empty(t, entries[0].KBHash)
+
+	assert.Equal(t, int64(1), entries[1].Call)
+	assert.Empty(t, entries[1].Arguments)
+	assert.Equal(t, entries[0].ArgumentsSHA256, entries[1].ArgumentsSHA256)
+	assert.Equal(t, AuditOK, entries[1].Outcome)
+	assert.Equal(t, "abc", entries[1].KBHash)
+
+	assert.Equal(t, int64(2), entries[3].Call)
+	assert.Equal(t, AuditToolError, entries[3].Outcome)
+	assert.Equal(t, "Failed to load facts", entries[3].Error)
+}
+
+func TestAuditLog_RecordsStartBeforeCall(t *testing.T) {
+	var buf bytes.Buffer
+	audit := NewAuditLog(&buf, AuditOptions{})
+
+	var during string
+	handler := audit.Middleware("s", nil)(func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		during = buf.String()
+		panic("tool crashed")
+	})
+	req := &mcp.CallToolRequest{Params: &mcp.CallToolParamsRaw{
+		Name:      "prolog_query",
+		Arguments: json.RawMessage(`{"query":"loop."}`),
+	}}
+	assert.Panics(t, func() { handler(context.Background(), "tools/call", req) })
+
+	entries := readEntries(t, bytes.NewBufferString(during))
+	require.Len(t, entries, 1)
+	assert.Equal(t, AuditStarted, entries[0].Outcome)
+	assert.JSONEq(t, `{"query":"loop."}`, string(entries[0].Arguments))
+}
+
+func TestAuditLog_CloseFlushesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	audit, err := OpenAuditLog(path, AuditOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, audit.Record(AuditEntry{SessionID: "s", Tool: "prolog_query", Outcome: AuditOK}))
+	require.NoError(t, audit.Close())
+	require.NoError(t, audit.Record(AuditEntry{SessionID: "s", Tool: "prolog_query", Outcome: AuditOK}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	entries := readEntries(t, bytes.NewBuffer(data))
+	assert.Len(t, entries, 1)
+}
+
+func TestAuditLog_RedactsAndTruncates(t *testing.T) {
+	var buf bytes.Buffer
+	audit := NewAuditLog(&buf, AuditOptions{
+		MaxArgBytes: 60,
+		Redactors:   []Redactor{RedactFields("secret")},
+	})
+
+	mw := audit.Middleware("s", nil)
+	callTool(t, mw, `{"secret":"hunter2"}`, &mcp.CallToolResult{})
+	callTool(t, mw, `{"facts":"`+strings.Repeat("x", 100)+`"}`, &mcp.CallToolResult{})
+
+	entries := readEntries(t, &buf)
+	require.Len(t, entries, 4)
+	entries = []AuditEntry{entries[0], entries[2]}
+
+	assert.NotContains(t, string(entries[0].Arguments), "hunter2")
+	assert.Contains(t, string(entries[0].Arguments), "[redacted sha256:")
+	assert.False(t, entries[0].ArgumentsTruncated)
+	// The hash is of what was recorded, not of the secret
+	redacted := sha256.Sum256(entries[0].Arguments)
+	assert.Equal(t, hex.EncodeToString(redacted[:]), entries[0].ArgumentsSHA256)
+	raw := sha256.Sum256([]byte(`{"secret":"hunter2"}`))
+	assert.NotEqual(t, hex.EncodeToString(raw[:]), entries[0].ArgumentsSHA256)
+
+	assert.True(t, entries[1].ArgumentsTruncated)
+	assert.NotEmpty(t, entries[1].ArgumentsSHA256)
+	var prefix string
+	require.NoError(t, json.Unmarshal(entries[1].Arguments, &prefix))
+	assert.Len(t, prefix, 60)
+}
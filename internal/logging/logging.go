@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// New creates a structured logger writing to w.
+// Level is one of debug, info, warn or error; format is text or json.
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q: use text or json", format)
+	}
+}
+
+// ParseLevel converts a level name to a slog level
+func ParseLevel(level string) (slog.Level, error) {
+	var lvl slog.Level
+	if level == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q: use debug, info, warn or error", level)
+	}
+	return lvl, nil
+}
+
+// ToolCalls returns MCP middleware that logs every tools/call with its
+// duration and outcome
+func ToolCalls(logger *slog.Logger) mcp.Middleware {
+	return func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			call, ok := req.(*mcp.CallToolRequest)
+			if !ok {
+				return next(ctx, method, req)
+			}
+
+			logger.DebugContext(ctx, "Tool call started", "tool", call.Params.Name)
+			start := time.Now()
+			res, err := next(ctx, method, req)
+			outcome, errText := callOutcome(res, err)
+
+			level := slog.LevelInfo
+			if outcome != AuditOK {
+				level = slog.LevelWarn
+			}
+			logger.Log(ctx, level, "Tool call finished",
+				"tool", call.Params.Name,
+				"outcome", outcome,
+				"error", errText,
+				"duration", time.Since(start),
+			)
+			return res, err
+		}
+	}
+}
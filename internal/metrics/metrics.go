@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Query outcomes used as the "outcome" label value
+const (
+	OutcomeSuccess = "success"
+	OutcomeFail    = "fail"
+	OutcomeError   = "error"
+	OutcomeTimeout = "timeout"
+)
+
+// Registry holds every logic-mcp collector. It is separate from the
+// Prometheus default registry so only our own series are exported.
+var Registry = prometheus.NewRegistry()
+
+var (
+	queriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "logic_mcp",
+		Name:      "queries_total",
+		Help:      "Prolog queries executed, by tool and outcome.",
+	}, []string{"tool", "outcome"})
+
+	queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "logic_mcp",
+		Name:      "query_duration_seconds",
+		Help:      "Prolog query execution time, by tool.",
+		Buckets:   []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"tool"})
+
+	kbClauses = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "logic_mcp",
+		Name:      "session_kb_clauses",
+		Help:      "Number of clauses in a session knowledge base, observed whenever it changes.",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 10),
+	})
+
+	activeSessions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "logic_mcp",
+		Name:      "active_sessions",
+		Help:      "Number of open session engines.",
+	})
+
+	swiplSpawned = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "logic_mcp",
+		Name:      "swipl_processes_spawned_total",
+		Help:      "swipl child processes started.",
+	})
+
+	swiplKilled = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "logic_mcp",
+		Name:      "swipl_processes_killed_total",
+		Help:      "swipl child processes terminated by a signal (cancellation or timeout).",
+	})
+
+	tempFilesCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "logic_mcp",
+		Name:      "temp_files_created_total",
+		Help:      "Temporary Prolog files written.",
+	})
+
+	tempFiles = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "logic_mcp",
+		Name:      "temp_files",
+		Help:      "Temporary Prolog files currently on disk.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		queriesTotal,
+		queryDuration,
+		kbClauses,
+		activeSessions,
+		swiplSpawned,
+		swiplKilled,
+		tempFilesCreated,
+		tempFiles,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler returns the HTTP handler serving the /metrics endpoint
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveQuery records one query executed on behalf of tool
+func ObserveQuery(tool, outcome string, d time.Duration) {
+	queriesTotal.WithLabelValues(tool, outcome).Inc()
+	queryDuration.WithLabelValues(tool).Observe(d.Seconds())
+}
+
+// ObserveKBSize records the clause count of a session knowledge base
+func ObserveKBSize(clauses int) {
+	kbClauses.Observe(float64(clauses))
+}
+
+// SessionOpened increments the active session gauge
+func SessionOpened() { activeSessions.Inc() }
+
+// SessionClosed decrements the active session gauge
+func SessionClosed() { activeSessions.Dec() }
+
+// SwiplSpawned counts a started swipl process
+func SwiplSpawned() { swiplSpawned.Inc() }
+
+// SwiplKilled counts a swipl process that was terminated by a signal
+func SwiplKilled() { swiplKilled.Inc() }
+
+// TempFileCreated counts a temporary file written to disk
+func TempFileCreated() {
+	tempFilesCreated.Inc()
+	tempFiles.Inc()
+}
+
+// TempFileRemoved counts a temporary file removed from disk
+func TempFileRemoved() { tempFiles.Dec() }
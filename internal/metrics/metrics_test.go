@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObserveQuery(t *testing.T) {
+	success := testutil.ToFloat64(queriesTotal.WithLabelValues("test_tool", OutcomeSuccess))
+	timeout := testutil.ToFloat64(queriesTotal.WithLabelValues("test_tool", OutcomeTimeout))
+
+	ObserveQuery("test_tool", OutcomeSuccess, 20*time.Millisecond)
+	ObserveQuery("test_tool", OutcomeSuccess, 3*time.Second)
+	ObserveQuery("test_tool", OutcomeTimeout, 40*time.Second)
+
+	assert.Equal(t, success+2, testutil.ToFloat64(queriesTotal.WithLabelValues("test_tool", OutcomeSuccess)))
+	assert.Equal(t, timeout+1, testutil.ToFloat64(queriesTotal.WithLabelValues("test_tool", OutcomeTimeout)))
+
+	families, err := Registry.Gather()
+	require.NoError(t, err)
+	var found bool
+	for _, f := range families {
+		if f.GetName() != "logic_mcp_query_duration_seconds" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			if m.GetLabel()[0].GetValue() != "test_tool" {
+				continue
+			}
+			found = true
+			h := m.GetHistogram()
+			assert.Equal(t, uint64(3), h.GetSampleCount())
+			assert.InDelta(t, 43.02, h.GetSampleSum(), 1e-9)
+			for _, b := range h.GetBucket() {
+				switch b.GetUpperBound() {
+				case 0.025:
+					assert.Equal(t, uint64(1), b.GetCumulativeCount())
+				case 5:
+					assert.Equal(t, uint64(2), b.GetCumulativeCount())
+				case 30:
+					assert.Equal(t, uint64(2), b.GetCumulativeCount(), "40s is only in +Inf")
+				}
+			}
+		}
+	}
+	assert.True(t, found, "query duration histogram of test_tool not exported")
+}
+
+func TestGauges(t *testing.T) {
+	sessions := testutil.ToFloat64(activeSessions)
+	files := testutil.ToFloat64(tempFiles)
+	created := testutil.ToFloat64(tempFilesCreated)
+
+	SessionOpened()
+	SessionOpened()
+	SessionClosed()
+	assert.Equal(t, sessions+1, testutil.ToFloat64(activeSessions))
+
+	TempFileCreated()
+	TempFileCreated()
+	TempFileRemoved()
+	assert.Equal(t, files+1, testutil.ToFloat64(tempFiles))
+	assert.Equal(t, created+2, testutil.ToFloat64(tempFilesCreated))
+
+	spawned, killed := testutil.ToFloat64(swiplSpawned), testutil.ToFloat64(swiplKilled)
+	SwiplSpawned()
+	SwiplKilled()
+	assert.Equal(t, spawned+1, testutil.ToFloat64(swiplSpawned))
+	assert.Equal(t, killed+1, testutil.ToFloat64(swiplKilled))
+}
+
+func TestRegistryExportsOnlyOwnSeries(t *testing.T) {
+	ObserveKBSize(10)
+
+	families, err := Registry.Gather()
+	require.NoError(t, err)
+	names := make(map[string]bool)
+	for _, f := range families {
+		names[f.GetName()] = true
+		assert.True(t, strings.HasPrefix(f.GetName(), "logic_mcp_") ||
+			strings.HasPrefix(f.GetName(), "go_") || strings.HasPrefix(f.GetName(), "process_"), f.GetName())
+	}
+	assert.True(t, names["logic_mcp_session_kb_clauses"])
+	assert.True(t, names["logic_mcp_active_sessions"])
+}
@@ -0,0 +1,347 @@
+package prolog
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// clause is a clause of the knowledge base and where it came from. The
+// clauses of one load share their provenance.
+type clause struct {
+	text       string
+	source     Source
+	provenance *Provenance
+}
+
+// Source locates a clause in the text it was loaded from
+type Source struct {
+	// Load numbers the loads of an engine from 1
+	Load int `json:"load"`
+	// File is the name of the consulted file, if any
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// String formats the source as "load #3, line 42" or, for a consulted
+// file, "load #3 (family.pl), line 42". Before the load is numbered, a
+// file is named alone, and text that is never loaded has only a line.
+func (s Source) String() string {
+	if s.Load == 0 {
+		if s.File == "" {
+			return fmt.Sprintf("line %d", s.Line)
+		}
+		return fmt.Sprintf("%s, line %d", s.File, s.Line)
+	}
+	if s.File != "" {
+		return fmt.Sprintf("load #%d (%s), line %d", s.Load, s.File, s.Line)
+	}
+	return fmt.Sprintf("load #%d, line %d", s.Load, s.Line)
+}
+
+// quoteAtom renders s as a quoted Prolog atom. Control characters are
+// escaped, so the atom is safe to embed in generated source as data.
+func quoteAtom(s string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '\'':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\x%x\`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+// predicateIndicator formats name/arity the way swipl prints it with ~w
+func predicateIndicator(name string, arity int) string {
+	return fmt.Sprintf("%s/%d", name, arity)
+}
+
+// clauseHead returns the predicate indicator of the head of a clause, or
+// false for directives and heads it cannot recognise
+func clauseHead(clause string) (string, bool) {
+	s := strings.TrimSpace(clause)
+	if s == "" || isDirective(s) {
+		return "", false
+	}
+
+	// Functor name: a quoted atom or a run of identifier characters
+	var name string
+	i := 0
+	if s[0] == '\'' {
+		end := closingQuote(s, 0)
+		if end < 0 {
+			return "", false
+		}
+		name = strings.NewReplacer(`\'`, `'`, `''`, `'`).Replace(s[1:end])
+		i = end + 1
+	} else {
+		for i < len(s) && isAtomChar(s[i]) {
+			i++
+		}
+		name = s[:i]
+		if name == "" || !(s[0] >= 'a' && s[0] <= 'z') {
+			return "", false
+		}
+	}
+
+	if i >= len(s) || s[i] != '(' {
+		return predicateIndicator(name, 0), true
+	}
+
+	// Count the top-level arguments up to the matching parenthesis
+	arity, depth := 1, 0
+	for j := i; j < len(s); j++ {
+		switch c := s[j]; c {
+		case '\'', '"', '`':
+			end := closingQuote(s, j)
+			if end < 0 {
+				return "", false
+			}
+			j = end
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+			if depth == 0 {
+				return predicateIndicator(name, arity), true
+			}
+		case ',':
+			if depth == 1 {
+				arity++
+			}
+		}
+	}
+	return "", false
+}
+
+// closingQuote returns the index of the quote closing the one at start
+func closingQuote(s string, start int) int {
+	q := s[start]
+	for j := start + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case q:
+			if j+1 < len(s) && s[j+1] == q {
+				j++ // doubled quote
+				continue
+			}
+			return j
+		}
+	}
+	return -1
+}
+
+func isAtomChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// splitClauses splits Prolog source text into clauses, each ending with its
+// terminating period. Comments are dropped; quoted text and 0'c character
+// codes are kept intact. Trailing text without a period is returned as a
+// final clause so callers can report it.
+func splitClauses(src string) []string {
+	var texts []string
+	for _, c := range splitClausesAt(src) {
+		texts = append(texts, c.text)
+	}
+	return texts
+}
+
+// sourceClause is a clause of a source text with the 1-based line and
+// column it starts at
+type sourceClause struct {
+	text         string
+	line, column int
+}
+
+// splitClausesAt splits like splitClauses and also returns where each
+// clause starts. Comments spanning lines are replaced by as many line
+// breaks, so lines within a clause keep their distance.
+func splitClausesAt(src string) []sourceClause {
+	var newlines []int
+	for i := 0; i < len(src); i++ {
+		if src[i] == '\n' {
+			newlines = append(newlines, i)
+		}
+	}
+
+	var clauses []sourceClause
+	var cur strings.Builder
+	start := -1
+	flush := func() {
+		if c := strings.TrimSpace(cur.String()); c != "" {
+			line, column := position(newlines, start)
+			clauses = append(clauses, sourceClause{text: c, line: line, column: column})
+		}
+		cur.Reset()
+		start = -1
+	}
+
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		comment := c == '%' || c == '/' && i+1 < len(src) && src[i+1] == '*'
+		if start < 0 && !comment && !isLayout(c) {
+			start = i
+		}
+		switch {
+		case c == '%':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			cur.WriteByte('\n')
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				end = len(src) - i - 2
+			}
+			if n := strings.Count(src[i:i+2+end], "\n"); n > 0 {
+				cur.WriteString(strings.Repeat("\n", n))
+			} else {
+				cur.WriteByte(' ')
+			}
+			i += end + 3
+		case c == '0' && i+1 < len(src) && src[i+1] == '\'' && (i == 0 || !isAtomChar(src[i-1])):
+			// Character code such as 0'a or 0'\n
+			n := 3
+			if i+2 < len(src) && src[i+2] == '\\' {
+				n = 4
+			}
+			n = min(n, len(src)-i)
+			cur.WriteString(src[i : i+n])
+			i += n - 1
+		case c == '\'' || c == '"' || c == '`':
+			end := closingQuote(src, i)
+			if end < 0 {
+				end = len(src) - 1
+			}
+			cur.WriteString(src[i : end+1])
+			i = end
+		case c == '.' && (i+1 == len(src) || isLayout(src[i+1]) || src[i+1] == '%') && !isSymbolChar(prevByte(cur.String())):
+			cur.WriteByte('.')
+			flush()
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	flush()
+	return clauses
+}
+
+// position returns the 1-based line and column of a byte offset, given the
+// offsets of all line breaks
+func position(newlines []int, offset int) (line, column int) {
+	n := sort.SearchInts(newlines, offset)
+	if n == 0 {
+		return 1, offset + 1
+	}
+	return n + 1, offset - newlines[n-1]
+}
+
+func isLayout(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// isSymbolChar reports characters that form symbol atoms such as =.. or :-
+func isSymbolChar(c byte) bool {
+	return strings.IndexByte(`+-*/\^<>=~:.?@#&$`, c) >= 0
+}
+
+func prevByte(s string) byte {
+	if s == "" {
+		return 0
+	}
+	return s[len(s)-1]
+}
+
+// clauseKey returns a key that is equal for clauses differing only in
+// layout, comments or the names of their variables, e.g. "p(X,Y) :- q(Y)."
+// and "p(A, B):-q(B).". It is used to detect clauses already loaded.
+func clauseKey(clause string) string {
+	var b strings.Builder
+	vars := make(map[string]string)
+	space := false
+	// emit writes s, keeping a single space where dropping the layout
+	// before it would join two tokens
+	emit := func(s string) {
+		if space && b.Len() > 0 {
+			out := b.String()
+			prev, next := out[len(out)-1], s[0]
+			// "- 1" is -(1) where "-1" is a number, unless - is infix
+			signed := (prev == '-' || prev == '+') && next >= '0' && next <= '9' &&
+				(len(out) == 1 || strings.IndexByte("([{,|", out[len(out)-2]) >= 0)
+			if isAtomChar(prev) && isAtomChar(next) || isSymbolChar(prev) && isSymbolChar(next) || signed {
+				b.WriteByte(' ')
+			}
+		}
+		space = false
+		b.WriteString(s)
+	}
+
+	s := strings.TrimSpace(clause)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case isLayout(c):
+			space = true
+		case c == '%':
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+			space = true
+		case c == '/' && i+1 < len(s) && s[i+1] == '*':
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				i = len(s)
+			} else {
+				i += end + 3
+			}
+			space = true
+		case c == '0' && i+1 < len(s) && s[i+1] == '\'':
+			n := 3
+			if i+2 < len(s) && s[i+2] == '\\' {
+				n = 4
+			}
+			n = min(n, len(s)-i)
+			emit(s[i : i+n])
+			i += n - 1
+		case c == '\'' || c == '"' || c == '`':
+			end := closingQuote(s, i)
+			if end < 0 {
+				end = len(s) - 1
+			}
+			emit(s[i : end+1])
+			i = end
+		case isAtomChar(c):
+			start := i
+			for i < len(s) && isAtomChar(s[i]) {
+				i++
+			}
+			name := s[start:i]
+			i--
+			if (c >= 'A' && c <= 'Z' || c == '_') && name != "_" {
+				if _, ok := vars[name]; !ok {
+					vars[name] = fmt.Sprintf("_V%d", len(vars))
+				}
+				name = vars[name]
+			}
+			emit(name)
+		default:
+			emit(string(c))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,739 @@
+package prolog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomasz-sikora/logic-mcp/internal/quota"
+	"github.com/tomasz-sikora/logic-mcp/internal/termjson"
+)
+
+func TestClauseHead(t *testing.T) {
+	tests := []struct {
+		clause string
+		want   string
+	}{
+		{"parent(tom, bob).", "parent/2"},
+		{"ready.", "ready/0"},
+		{"mammal(X) :- animal(X), has_fur(X).", "mammal/1"},
+		{"edge([a, b], f(c, d), 'x,y').", "edge/3"},
+		{"'Weird name'(1).", "Weird name/1"},
+		{"ok :- true.", "ok/0"},
+		{":- dynamic(foo/1).", ""},
+		{"X = Y.", ""},
+	}
+
+	for _, tt := range tests {
+		got, ok := clauseHead(tt.clause)
+		assert.Equal(t, tt.want != "", ok, tt.clause)
+		assert.Equal(t, tt.want, got, tt.clause)
+	}
+}
+
+func TestSplitClauses(t *testing.T) {
+	src := `% family rules
+parent(tom, bob).
+grandparent(X, Z) :-
+    parent(X, Y), /* middle */ parent(Y, Z).
+name('St. Mary', "a. b").
+code(0'.).
+univ(T, L) :- T =.. L.
+unterminated(x)`
+
+	assert.Equal(t, []string{
+		"parent(tom, bob).",
+		"grandparent(X, Z) :-\n    parent(X, Y),   parent(Y, Z).",
+		`name('St. Mary', "a. b").`,
+		"code(0'.).",
+		"univ(T, L) :- T =.. L.",
+		"unterminated(x)",
+	}, splitClauses(src))
+}
+
+func TestClauseKey(t *testing.T) {
+	same := [][]string{
+		{"p(X, Y) :- q(Y).", "p(A,B):-q(B).", "p( X ,\tY )  :-  q( Y ) ."},
+		{"name('a  b').", "name( 'a  b' )."},
+		{"x(_, _).", "x( _ , _ )."},
+		{"f(X) :- X is 1 - 1.", "f(Y):-Y is 1-1."},
+	}
+	for _, group := range same {
+		for _, clause := range group[1:] {
+			assert.Equal(t, clauseKey(group[0]), clauseKey(clause), clause)
+		}
+	}
+
+	different := [][2]string{
+		{"p(X, Y).", "p(X, X)."},
+		{"name('a  b').", "name('a b')."},
+		{"x(_, _).", "x(_A, _A)."},
+		{"a :- b.", "a :- c."},
+		{"f(- 1).", "f(-1)."},
+		{"g(a b).", "g(ab)."},
+	}
+	for _, pair := range different {
+		assert.NotEqual(t, clauseKey(pair[0]), clauseKey(pair[1]), pair[0])
+	}
+}
+
+func TestParseMessages(t *testing.T) {
+	out := "Warning: /tmp/a.pl:3:\nWarning:    Singleton variables: [X]\nERROR: /tmp/a.pl:5:\nERROR:    Syntax error: Operator expected\n"
+	warnings, errs := parseMessages(out)
+	assert.Equal(t, []string{"/tmp/a.pl:3: Singleton variables: [X]"}, warnings)
+	assert.Equal(t, []string{"/tmp/a.pl:5: Syntax error: Operator expected"}, errs)
+}
+
+func TestSplitMessages(t *testing.T) {
+	out := "hello\nWarning: /tmp/q.pl:3:\nWarning:    Singleton variables: [X]\nworld\nERROR: -g main: false\n"
+	text, warnings, errs := splitMessages(out)
+	assert.Equal(t, "hello\nworld\n", text)
+	assert.Equal(t, []string{"/tmp/q.pl:3: Singleton variables: [X]"}, warnings)
+	assert.Equal(t, []string{"-g main: false"}, errs)
+}
+
+func TestMapMessages(t *testing.T) {
+	clauses := []clause{
+		{text: "a.", source: Source{Load: 1, Line: 1, Column: 1}},
+		{text: "p(X) :-\n    q.", source: Source{Load: 2, File: "rules.pl", Line: 10, Column: 3}},
+		{text: "b(c d).", source: Source{Load: 3, Line: 42, Column: 5}},
+	}
+	starts := []int{3, 4, 6}
+	msgs := mapMessages([]string{
+		"/tmp/q.pl:4: Singleton variables: [X]",
+		"/tmp/q.pl:5:4: Syntax error: Unknown procedure",
+		"/tmp/q.pl:6:4: Syntax error: Operator expected",
+		"/tmp/q.pl:40: Goal (directive) failed",
+		"Unknown procedure: foo/0",
+	}, "/tmp/q.pl", starts, clauses)
+
+	assert.Equal(t, []Message{
+		{
+			Text:    "load #2 (rules.pl), line 10: Singleton variables: [X]",
+			Clause:  "p(X) :-\n    q.",
+			Source:  &Source{Load: 2, File: "rules.pl", Line: 10, Column: 3},
+			Snippet: "10 | p(X) :-",
+		},
+		{
+			Text:    "load #2 (rules.pl), line 11, column 5: Syntax error: Unknown procedure",
+			Clause:  "p(X) :-\n    q.",
+			Source:  &Source{Load: 2, File: "rules.pl", Line: 11, Column: 5},
+			Snippet: "11 |     q.\n   |     ^",
+		},
+		{
+			Text:    "load #3, line 42, column 9: Syntax error: Operator expected",
+			Clause:  "b(c d).",
+			Source:  &Source{Load: 3, Line: 42, Column: 9},
+			Snippet: "42 | b(c d).\n   |     ^",
+		},
+		{Text: "Goal (directive) failed"},
+		{Text: "Unknown procedure: foo/0"},
+	}, msgs)
+}
+
+func TestSplitClausesAt(t *testing.T) {
+	src := "a.\n  b :-\n    /* two\n  lines */ c.\nd. e."
+	assert.Equal(t, []sourceClause{
+		{text: "a.", line: 1, column: 1},
+		{text: "b :-\n    \n c.", line: 2, column: 3},
+		{text: "d.", line: 5, column: 1},
+		{text: "e.", line: 5, column: 4},
+	}, splitClausesAt(src))
+}
+
+func TestQuoteAtom(t *testing.T) {
+	assert.Equal(t, `'it\'s'`, quoteAtom("it's"))
+	assert.Equal(t, `'a\\b'`, quoteAtom(`a\b`))
+	assert.Equal(t, `'x\ny\tz\x1\'`, quoteAtom("x\ny\tz\x01"))
+	// A query cannot end the atom and add clauses
+	assert.Equal(t, `'true), halt.\nevil :- (shell(x)'`, quoteAtom("true), halt.\nevil :- (shell(x)"))
+}
+
+func TestParseStatus(t *testing.T) {
+	rest, ok := parseStatus("a\n" + statusMarker + "\ttrue\n")
+	assert.True(t, ok)
+	assert.Equal(t, "a\n", rest)
+
+	rest, ok = parseStatus(statusMarker + "\tfalse\n")
+	assert.False(t, ok)
+	assert.Empty(t, rest)
+
+	// Only the last line counts, and only exactly
+	for _, out := range []string{
+		statusMarker + "\ttrue\nhalted\n",
+		"SUCCESS: true\n",
+		"x" + statusMarker + "\ttrue\n",
+		statusMarker + "\ttrue \n",
+		"",
+	} {
+		_, ok := parseStatus(out)
+		assert.False(t, ok, out)
+	}
+}
+
+func TestParseVariables(t *testing.T) {
+	rest, vars := parseVariables("warning\n" + variablesMarker + "\tX\tTotal\nprinted\n")
+	assert.Equal(t, "warning\nprinted\n", rest)
+	assert.Equal(t, []string{"X", "Total"}, vars)
+
+	_, vars = parseVariables(variablesMarker + "\n")
+	assert.Empty(t, vars)
+}
+
+func TestParseSolutions(t *testing.T) {
+	out := "hello\n" +
+		solutionMarker + "\tX=a\tY='B c'\n" +
+		termsMarker + `{"X":{"type":"atom","value":"a"},"Y":{"type":"atom","value":"B c"}}` + "\n" +
+		"printed\n"
+	rest, solutions, terms := parseSolutions(out)
+	assert.Equal(t, "hello\nprinted\n", rest)
+	assert.Equal(t, []map[string]any{{"X": "a", "Y": "'B c'"}}, solutions)
+	assert.Equal(t, []map[string]termjson.Term{{"X": termjson.Atom("a"), "Y": termjson.Atom("B c")}}, terms)
+
+	// A solution without a valid terms line drops all terms
+	_, solutions, terms = parseSolutions(out + solutionMarker + "\tX=b\tY=c\n" + termsMarker + "{bad\n")
+	assert.Len(t, solutions, 2)
+	assert.Nil(t, terms)
+}
+
+func TestOutputWriter_Progress(t *testing.T) {
+	var reports []Progress
+	w := &outputWriter{start: time.Now(), limit: 1, progress: func(p Progress) { reports = append(reports, p) }}
+
+	chunks := []string{
+		"hello\n" + progressMarker,
+		"42 0\nwarn",
+		"ing\n" + progressMarker + "1000 2\n" + progressMarker + "bad\ntail",
+	}
+	for _, c := range chunks {
+		n, err := w.Write([]byte(c))
+		assert.NoError(t, err)
+		assert.Equal(t, len(c), n)
+	}
+
+	assert.Equal(t, "hello\nwarning\n"+progressMarker+"bad\ntail", string(w.Bytes()))
+	if assert.Len(t, reports, 2) {
+		assert.Equal(t, int64(42), reports[0].Inferences)
+		assert.Equal(t, 0, reports[0].Solutions)
+		assert.Equal(t, int64(1000), reports[1].Inferences)
+		assert.Equal(t, 1, reports[1].Solutions, "solutions are capped at the limit")
+	}
+}
+
+func TestClauseFilter(t *testing.T) {
+	at := time.Date(2024, 5, 1, 14, 2, 0, 0, time.UTC)
+	imported := &Provenance{Tool: "prolog_import_data", Time: at, Session: "s1", Caller: "alice", Tags: []string{"hr"}}
+	c := clause{text: "employee(bob, 85000).", source: Source{Load: 3, Line: 1, Column: 1}, provenance: imported}
+
+	matching := []ClauseFilter{
+		{},
+		{Load: 3},
+		{Tool: "prolog_import_data", Caller: "alice"},
+		{Tag: "hr", Session: "s1"},
+		{Predicate: "employee/2"},
+		{Since: at, Until: at.Add(time.Minute)},
+	}
+	for _, f := range matching {
+		assert.True(t, f.matches(c), "%+v", f)
+	}
+
+	other := []ClauseFilter{
+		{Load: 2},
+		{Tool: "prolog_load_facts"},
+		{Caller: "bob"},
+		{Tag: "sales"},
+		{Predicate: "employee/3"},
+		{Since: at.Add(time.Second)},
+		{Until: at},
+	}
+	for _, f := range other {
+		assert.False(t, f.matches(c), "%+v", f)
+	}
+
+	assert.True(t, ClauseFilter{}.IsZero())
+	assert.False(t, ClauseFilter{Tag: "hr"}.IsZero())
+}
+
+func TestCheckDirective(t *testing.T) {
+	allowed := []string{
+		":- use_module(library(clpfd)).",
+		":- use_module(library(lists), [append/3]).",
+		":- ensure_loaded(library( dcg/basics )).",
+		":- dynamic counter/1.",
+		":- dynamic foo/1, bar/2.",
+		":- dynamic((foo/1, bar/2)).",
+		":- discontiguous(edge/2).",
+		":- table path(_, _, min).",
+		":- op(700, xfx, '===>').",
+		":- op(200, xfy, [^^, 'x:-']).",
+		":- set_prolog_flag(double_quotes, codes).",
+		"':-'(dynamic(foo/1)).",
+		"(:- discontiguous edge/2).",
+	}
+	for _, d := range allowed {
+		assert.Empty(t, checkDirective(d, DefaultAllowedLibraries), d)
+	}
+
+	rejected := map[string]string{
+		":- initialization(main).":                     "initialization/1 is not an allowed directive",
+		":- use_module(library(process)).":             "library(process) is not a permitted library",
+		":- use_module('/etc/evil.pl').":               "only libraries can be loaded, as library(Name)",
+		":- set_prolog_flag(answer_write_options, x).": "flag answer_write_options cannot be set",
+		":- dynamic(foo/1), shell('rm -rf /').":        "a directive must be a single declaration",
+		":- X = 1.":                                    "not a declaration",
+		"?- halt.":                                     "halt/0 is not an allowed directive",
+		":- op(0, fx, (:-)).":                          "operator :- cannot be changed",
+		":- op(1200, xfx, ':-').":                      "operator :- cannot be changed",
+		":- op(700, xfx, [===>, (',')]).":              "operator , cannot be changed",
+	}
+	for d, reason := range rejected {
+		assert.Equal(t, reason, checkDirective(d, DefaultAllowedLibraries), d)
+	}
+}
+
+func TestDirectiveBody(t *testing.T) {
+	// Every way swipl reads as a directive
+	for text, body := range map[string]string{
+		":- shell(ls).":                 "shell(ls)",
+		"?-halt.":                       "halt",
+		"':-'(shell(ls)).":              "shell(ls)",
+		"'?-'(G).":                      "G",
+		"'?-' halt.":                    "halt",
+		"( :- shell(ls) ).":             "shell(ls)",
+		"((':-'((shell(ls), true)))).":  "shell(ls), true",
+		"(:-)(shell(ls)).":              "shell(ls)",
+		"('?-')(halt).":                 "halt",
+		`'\x3A\-'(shell(ls)).`:          "shell(ls)",
+		`'\72\\u002D'(shell(ls)).`:      "shell(ls)",
+		"':-'((dynamic foo/1, bar/2)).": "dynamic foo/1, bar/2",
+	} {
+		got, ok := directiveBody(text)
+		assert.True(t, ok, text)
+		assert.Equal(t, body, got, text)
+	}
+
+	for _, text := range []string{"a :- b.", "(a :- b).", "':- '(x).", "'x:-'(y).", "(a, b) :- c.", "p(':-').", "'\\q'(x)."} {
+		_, ok := directiveBody(text)
+		assert.False(t, ok, text)
+	}
+}
+
+func TestEngine_DirectivesOnSharedLines(t *testing.T) {
+	e := &Engine{factKeys: make(map[string]int)}
+
+	// Every clause of a line is checked, not only the first
+	loads := map[string][]string{
+		":- dynamic foo/1. :- shell(x).":                {":- shell(x)."},
+		"a. :- initialization(main).":                   {":- initialization(main)."},
+		":- use_module(library(lists)). ?- halt. b.":    {"?- halt."},
+		":- initialization(a). :- use_module('/x.pl').": {":- initialization(a).", ":- use_module('/x.pl')."},
+		"a. ':-'(shell(ls)).":                           {"':-'(shell(ls))."},
+		"'?-'(halt). ( :- shell(ls) ).":                 {"'?-'(halt).", "( :- shell(ls) )."},
+	}
+	for facts, directives := range loads {
+		_, err := e.LoadFactsWithOptions(facts, LoadOptions{})
+		var rejected *DirectiveError
+		require.ErrorAs(t, err, &rejected, facts)
+		require.Len(t, rejected.Rejected, len(directives), facts)
+		for i, d := range directives {
+			assert.Equal(t, d, rejected.Rejected[i].Directive, facts)
+			assert.Equal(t, 1, rejected.Rejected[i].Source.Line, facts)
+		}
+	}
+	assert.Empty(t, e.GetLoadedFacts(), "rejected loads changed nothing")
+}
+
+func TestEngine_ConsultFileChecksDirectives(t *testing.T) {
+	e := &Engine{factKeys: make(map[string]int), opts: EngineOptions{TempDir: t.TempDir()}}
+
+	// Directives are checked before anything compiles the file
+	path := filepath.Join(t.TempDir(), "evil.pl")
+	require.NoError(t, os.WriteFile(path, []byte("a.\n':-'(shell(ls)).\n"), 0644))
+	_, err := e.ConsultFile(context.Background(), path, "evil.pl", LoadOptions{})
+	var rejected *DirectiveError
+	require.ErrorAs(t, err, &rejected)
+	assert.Equal(t, "evil.pl, line 2", rejected.Rejected[0].Source.String())
+	assert.Empty(t, e.GetLoadedFacts())
+}
+
+func TestEngine_LoadNumbers(t *testing.T) {
+	e := &Engine{factKeys: make(map[string]int)}
+
+	result, err := e.LoadFactsWithOptions("a.", LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Load)
+
+	// Rejected loads take no number
+	_, err = e.LoadFactsWithOptions("b.\n:- initialization(main).", LoadOptions{})
+	var rejected *DirectiveError
+	require.ErrorAs(t, err, &rejected)
+	assert.Equal(t, "line 2", rejected.Rejected[0].Source.String())
+	_, err = e.LoadFactsWithOptions(":- pred c(integer).\nc(x).", LoadOptions{})
+	var mismatch *DeclarationError
+	require.ErrorAs(t, err, &mismatch)
+	assert.Contains(t, err.Error(), "\n  line 2: ")
+
+	result, err = e.LoadFactsWithOptions(":- pred c(integer).\nc(1).", LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Load)
+	facts := e.Clauses(ClauseFilter{})
+	require.Len(t, facts, 2)
+	assert.Equal(t, "load #2, line 2", facts[1].Source.String())
+	assert.Equal(t, 2, e.Declarations()[0].Source.Load)
+}
+
+func TestDirectiveError(t *testing.T) {
+	err := &DirectiveError{Rejected: []RejectedDirective{
+		{Directive: ":- initialization(main).", Source: Source{Load: 2, Line: 3}, Reason: "initialization/1 is not an allowed directive"},
+	}}
+	assert.Contains(t, err.Error(), "1 directives rejected")
+	assert.Contains(t, err.Error(), "\n  load #2, line 3: initialization/1 is not an allowed directive: :- initialization(main).")
+}
+
+func TestEngine_RestrictedSandbox(t *testing.T) {
+	e := &Engine{factKeys: make(map[string]int), opts: EngineOptions{Sandbox: SandboxRestricted}}
+
+	rejected := map[string]string{
+		"a. :- shell(x).":                     "line 1: directives are not allowed in the restricted sandbox: :- shell(x).",
+		"b.\nc :- true. ?- halt.":             "line 2: directives are not allowed",
+		"term_expansion(a, b).":               "clauses of the hook term_expansion are not allowed",
+		"goal_expansion(G, true) :- G = foo.": "clauses of the hook goal_expansion are not allowed",
+		"'message_hook'(_, _, _) :- halt.":    "clauses of the hook message_hook are not allowed",
+		"user:term_expansion(a, b).":          "clauses of module user are not allowed",
+		"(term_expansion(a, b) :- true).":     "parenthesised clauses are not allowed",
+		"':-'(shell(ls)).":                    "directives are not allowed",
+		"'?-'(halt).":                         "directives are not allowed",
+		"(:- shell(ls)).":                     "directives are not allowed",
+	}
+	for facts, reason := range rejected {
+		_, err := e.LoadFactsWithOptions(facts, LoadOptions{})
+		require.Error(t, err, facts)
+		assert.Contains(t, err.Error(), reason, facts)
+	}
+	assert.Empty(t, e.GetLoadedFacts(), "rejected loads changed nothing")
+
+	result, err := e.LoadFactsWithOptions("a. b :- a.\nexpansion(x). user_term(y) :- a.", LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 4, result.Added)
+	assert.Equal(t, []string{"a.", "b :- a.", "expansion(x).", "user_term(y) :- a."}, e.GetLoadedFacts())
+}
+
+func TestEngine_QuotasAdmitScratchRuns(t *testing.T) {
+	tracker := quota.NewTracker("session", quota.Limits{ConcurrentQueries: 1})
+	hold, err := tracker.Acquire()
+	require.NoError(t, err)
+	defer hold(0)
+
+	e := &Engine{factKeys: make(map[string]int), opts: EngineOptions{Quotas: []*quota.Tracker{tracker}, TempDir: t.TempDir()}}
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+	defer e.cancel()
+
+	var exceeded *quota.ExceededError
+	_, err = e.CheckSyntax(context.Background(), "a.")
+	assert.ErrorAs(t, err, &exceeded, "syntax checks run swipl")
+	_, err = e.LoadFactsWithOptions(":- dynamic a/1.", LoadOptions{})
+	assert.ErrorAs(t, err, &exceeded, "new directives run swipl")
+
+	require.NoError(t, e.LoadFacts("a(1)."), "loads without directives do not run swipl")
+	_, err = e.AddConstraints(":- a(X), X > 1.")
+	require.NoError(t, err)
+	_, err = e.LoadFactsWithOptions("a(2).", LoadOptions{RejectViolations: true})
+	assert.ErrorAs(t, err, &exceeded, "checking violations runs swipl")
+	assert.Equal(t, []string{"a(1)."}, e.GetLoadedFacts())
+
+	results, err := e.QueryBatch(context.Background(), []string{"a(X).", "a(2).", "a(3)."}, 4)
+	assert.ErrorAs(t, err, &exceeded, "every query of a batch is admitted")
+	assert.Equal(t, []*QueryResult{nil, nil, nil}, results, "no query ran")
+	_, err = e.WhatIf(context.Background(), "a(X).", Assumptions{Add: "a(2)."})
+	assert.ErrorAs(t, err, &exceeded, "both queries of a what-if are admitted")
+	_, err = e.Entails(context.Background(), "a(1)", EntailOptions{})
+	assert.ErrorAs(t, err, &exceeded)
+}
+
+func TestEngine_Parallelism(t *testing.T) {
+	e := &Engine{opts: EngineOptions{Quotas: []*quota.Tracker{
+		nil,
+		quota.NewTracker("session", quota.Limits{ConcurrentQueries: 3}),
+		quota.NewTracker("token", quota.Limits{}),
+	}}}
+	assert.Equal(t, 2, e.parallelism(2))
+	assert.Equal(t, 3, e.parallelism(16))
+	assert.Equal(t, 1, (&Engine{}).parallelism(0))
+}
+
+func TestEngine_SetFlags(t *testing.T) {
+	e := &Engine{}
+	settings := e.Settings()
+	assert.Equal(t, "string", settings.Flags["double_quotes"])
+	assert.Equal(t, "error", settings.Flags["unknown"])
+	assert.Empty(t, settings.Operators)
+
+	settings, err := e.SetFlags(map[string]string{"double_quotes": "codes"}, []Operator{{Priority: 700, Type: "xfx", Name: "===>"}})
+	require.NoError(t, err)
+	assert.Equal(t, "codes", settings.Flags["double_quotes"])
+
+	// Later calls merge, replacing operators of the same name and type
+	settings, err = e.SetFlags(map[string]string{"occurs_check": "error"}, []Operator{{Priority: 800, Type: "xfx", Name: "===>"}, {Priority: 200, Type: "fy", Name: "~"}})
+	require.NoError(t, err)
+	assert.Equal(t, "codes", settings.Flags["double_quotes"])
+	assert.Equal(t, "error", settings.Flags["occurs_check"])
+	assert.Equal(t, []Operator{{Priority: 800, Type: "xfx", Name: "===>"}, {Priority: 200, Type: "fy", Name: "~"}}, settings.Operators)
+	assert.Equal(t, ":- op(800, xfx, '===>').\n:- op(200, fy, '~').\n"+
+		":- set_prolog_flag(double_quotes, codes).\n:- set_prolog_flag(occurs_check, error).\n"+
+		"logic_mcp_settings :- true, set_prolog_flag(double_quotes, codes), set_prolog_flag(occurs_check, error).\n",
+		e.settingsSource())
+
+	for _, bad := range []struct {
+		flags map[string]string
+		ops   []Operator
+	}{
+		{flags: map[string]string{"gc": "false"}},
+		{flags: map[string]string{"unknown": "ignore"}},
+		{ops: []Operator{{Priority: 1300, Type: "xfx", Name: "=>>"}}},
+		{ops: []Operator{{Priority: 700, Type: "xyz", Name: "=>>"}}},
+		{ops: []Operator{{Priority: 700, Type: "xfy", Name: ","}}},
+		{ops: []Operator{{Priority: 0, Type: "fx", Name: ":-"}}},
+	} {
+		_, err := e.SetFlags(bad.flags, bad.ops)
+		assert.Error(t, err, "%+v", bad)
+		_, err = e.ReplaceFlags(bad.flags, bad.ops)
+		assert.Error(t, err, "%+v", bad)
+	}
+	assert.Equal(t, "codes", e.Settings().Flags["double_quotes"], "failed calls change nothing")
+	assert.Len(t, e.Settings().Operators, 2, "failed calls change nothing")
+
+	settings, err = e.ReplaceFlags(map[string]string{"unknown": "fail"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "string", settings.Flags["double_quotes"])
+	assert.Equal(t, "fail", settings.Flags["unknown"])
+	assert.Empty(t, settings.Operators)
+
+	settings = e.ResetFlags()
+	assert.Equal(t, "string", settings.Flags["double_quotes"])
+	assert.Empty(t, settings.Operators)
+	assert.Equal(t, "logic_mcp_settings :- true.\n", e.settingsSource())
+}
+
+func TestParseEntailment(t *testing.T) {
+	program := []clause{
+		{text: "parent(tom, bob).", source: Source{Load: 1, Line: 1}},
+		{text: "grandparent(X, Z) :- parent(X, Y), parent(Y, Z).", source: Source{Load: 1, Line: 3}},
+	}
+	result := &QueryResult{
+		Variables: []string{"Z"},
+		Solutions: []map[string]any{{"Z": "ann"}},
+		program:   program,
+		starts:    []int{10, 11},
+		rest: verdictMarker + "\tprovable\t\n" +
+			proofMarker + "\t0\tclause\t11\tgrandparent(tom,ann)\n" +
+			proofMarker + "\t1\tclause\t10\tparent(tom,bob)\n" +
+			proofMarker + "\t1\tbuiltin\t0\tX==Y\n",
+	}
+	ent := parseEntailment(result)
+	assert.Equal(t, VerdictProvable, ent.Verdict)
+	assert.Equal(t, "ann", ent.Bindings["Z"])
+	require.Len(t, ent.Proof, 3)
+	assert.Equal(t, ProofStep{Depth: 1, Kind: "clause", Goal: "parent(tom,bob)", Clause: "parent(tom, bob).", Source: &Source{Load: 1, Line: 1}}, ent.Proof[1])
+	assert.Nil(t, ent.Proof[2].Source)
+
+	ent = parseEntailment(&QueryResult{rest: verdictMarker + "\tunprovable\t\n" + frontierMarker + "\tparent(ann,_)\tno matching clause\n"})
+	assert.Equal(t, VerdictUnprovable, ent.Verdict)
+	assert.Equal(t, []FrontierGoal{{Goal: "parent(ann,_)", Reason: "no matching clause"}}, ent.Frontier)
+	assert.Nil(t, ent.Bindings)
+
+	ent = parseEntailment(&QueryResult{
+		rest:   verdictMarker + "\tundetermined\tthe goal raised an error\n",
+		Errors: []Message{{Text: "Arithmetic: evaluation error: zero_divisor"}},
+	})
+	assert.Equal(t, "the goal raised an error: Arithmetic: evaluation error: zero_divisor", ent.Reason)
+
+	ent = parseEntailment(&QueryResult{Error: "query timed out after 1s", TimedOut: true})
+	assert.Equal(t, VerdictUndetermined, ent.Verdict)
+	assert.Equal(t, "query timed out after 1s", ent.Reason)
+
+	ent = parseEntailment(&QueryResult{})
+	assert.Equal(t, VerdictUndetermined, ent.Verdict)
+	assert.Equal(t, "no verdict was reached", ent.Reason)
+}
+
+func TestEngine_Constraints(t *testing.T) {
+	e := &Engine{}
+	added, err := e.AddConstraints(":- parent(X, X).\n\n:- male(X), female(X)")
+	require.NoError(t, err)
+	assert.Equal(t, 2, added)
+
+	// Constraints compare like clauses
+	added, err = e.AddConstraints(":- parent(A,A).")
+	require.NoError(t, err)
+	assert.Equal(t, 0, added)
+
+	_, err = e.AddConstraints(":- age(X, A), A < 0.\nparent(X, X).")
+	assert.ErrorContains(t, err, "constraints, line 2: a constraint must be a denial")
+	_, err = e.AddConstraints(":- .")
+	assert.Error(t, err)
+	assert.Equal(t, []string{":- parent(X, X).", ":- male(X), female(X)."}, e.Constraints(), "failed calls change nothing")
+
+	_, err = e.RemoveConstraints([]string{":- parent(X, X).", ":- age(X, -1)."})
+	assert.ErrorContains(t, err, "not a declared constraint")
+	removed, err := e.RemoveConstraints([]string{":- parent(Y,Y)"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.Equal(t, []string{":- male(X), female(X)."}, e.Constraints())
+
+	source := e.consistencySource()
+	assert.Contains(t, source, "logic_mcp_constraint(0, 'male(X), female(X)').\n")
+	assert.Contains(t, source, "logic_mcp_prove(")
+}
+
+func TestConsistencyError(t *testing.T) {
+	err := &ConsistencyError{Violations: []Violation{{
+		Constraint: ":- male(X), female(X).",
+		Bindings:   "X = pat",
+		Facts: []Clause{
+			{Text: "male(pat).", Source: Source{Load: 1, Line: 2}},
+			{Text: "female(pat).", Source: Source{Load: 3, Line: 1}},
+		},
+	}}}
+	assert.Equal(t, "load rejected: it introduces 1 violations of integrity constraints\n"+
+		"  :- male(X), female(X). with X = pat\n"+
+		"    load #1, line 2: male(pat).\n"+
+		"    load #3, line 1: female(pat).", err.Error())
+}
+
+func TestTermKind(t *testing.T) {
+	for term, kind := range map[string]string{
+		"X": "var", "_": "var", "_Name": "var",
+		"42": "integer", "-7": "integer", "0x1F": "integer", "0'a": "integer", "1_000": "integer",
+		"3.14": "float", "-1.0e10": "float", "1e5": "float",
+		`"text"`: "string", `"a\"b"`: "string",
+		"tom": "atom", "'Tom'": "atom", "[]": "list", "->": "atom", "aBc_1": "atom",
+		"[a, b]": "list", "[H|T]": "list", "[[1], [2, 3]]": "list",
+		"f(x)": "compound", "a-b": "compound", "'a'-b": "compound", "[a]-b": "compound", "X+1": "compound",
+	} {
+		assert.Equal(t, kind, termKind(term), term)
+	}
+
+	elems, tail, ok := listElements("[a, f(b, c) | T]")
+	require.True(t, ok)
+	assert.Equal(t, []string{"a", "f(b, c)"}, elems)
+	assert.Equal(t, "T", tail)
+}
+
+func TestParseDeclaration(t *testing.T) {
+	d, err := parseDeclaration(clause{text: ":- pred parent(+person, -list({red, 'green'}), ?integer)."})
+	require.NoError(t, err)
+	assert.Equal(t, "pred parent/3", d.key)
+	assert.Equal(t, []string{"+", "-", "?"}, d.pred.modes)
+	assert.Equal(t, "list({red, green})", d.pred.types[1].String())
+
+	d, err = parseDeclaration(clause{text: ":- type color = {red, green}."})
+	require.NoError(t, err)
+	assert.Equal(t, "type color", d.key)
+
+	for _, bad := range []string{
+		":- pred parent(person, person) :- true.",
+		":- pred parent(list(a, b)).",
+		":- pred color({red, f(x)}).",
+		":- type Color = atom.",
+		":- type atom = integer.",
+		":- type color.",
+	} {
+		_, err := parseDeclaration(clause{text: bad, source: Source{Load: 1, Line: 1}})
+		assert.Error(t, err, bad)
+	}
+
+	assert.True(t, isDeclaration(":- pred parent(person, person)."))
+	assert.True(t, isDeclaration(":- type person = atom."))
+	assert.False(t, isDeclaration(":- predicate(x)."))
+	assert.False(t, isDeclaration("pred(x)."))
+}
+
+func TestEngine_Declarations(t *testing.T) {
+	e := &Engine{factKeys: make(map[string]int)}
+	result, err := e.LoadFactsWithOptions(":- type gender = {male, female}.\n:- pred parent(person, person).\n:- type person = atom.\n:- pred person(+atom, gender, integer).\nparent(tom, bob).\nperson(tom, male, 52).", LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 4, result.Declared)
+	assert.Equal(t, 2, result.Added, "declarations are not clauses")
+	assert.Len(t, e.Declarations(), 4)
+
+	// Type names must be builtin or defined, in this load or an earlier one
+	_, err = e.LoadFactsWithOptions(":- pred age(atom, intger).\nage(tom, 52).", LoadOptions{})
+	assert.ErrorContains(t, err, "line 1: unknown type intger")
+	_, err = e.LoadFactsWithOptions(":- type people = list(persn).", LoadOptions{})
+	assert.ErrorContains(t, err, "unknown type persn")
+	_, err = e.LoadFactsWithOptions(":- pred owns(person, list({car, bike})).\n:- type ages = list(gender).", LoadOptions{})
+	require.NoError(t, err)
+	assert.Len(t, e.Declarations(), 6)
+	assert.Len(t, e.GetLoadedFacts(), 2, "the rejected loads changed nothing")
+
+	_, err = e.LoadFactsWithOptions("parent(bob).\nperson(bob, man, 30).\nperson(ann, female, old).\nperson(_, female, 3).\nparent(X, Y) :- person(X, _, _), Y = bob.\nparent(bob, \"ann\") :- true.", LoadOptions{})
+	var mismatch *DeclarationError
+	require.ErrorAs(t, err, &mismatch)
+	reasons := make([]string, len(mismatch.Mismatches))
+	for i, m := range mismatch.Mismatches {
+		reasons[i] = m.Reason
+	}
+	assert.Equal(t, []string{
+		"parent/1 does not match the declaration of parent/2",
+		"argument 2 of person/3: expected gender, got man",
+		"argument 3 of person/3: expected integer, got old",
+		"argument 1 of person/3 must be bound (mode +)",
+		`argument 2 of parent/2: expected person, got "ann"`,
+	}, reasons)
+	assert.Equal(t, 1, mismatch.Mismatches[0].Source.Line)
+	assert.Len(t, e.GetLoadedFacts(), 2, "the rejected load changed nothing")
+
+	// New declarations must match the clauses already loaded
+	_, err = e.LoadFactsWithOptions(":- pred parent(integer, integer).", LoadOptions{})
+	require.ErrorAs(t, err, &mismatch)
+	assert.Equal(t, "argument 1 of parent/2: expected integer, got tom", mismatch.Mismatches[0].Reason)
+
+	// Undeclared predicates are inferred from their facts
+	_, err = e.LoadFactsWithOptions("likes(tom, [pizza, pasta], 3).\nlikes(bob, [], 2.5).\nlikes(ann, [sushi], 4).\nsex(tom, male).\nsex(bob, male).\nsex(ann, female).\nsex(liz, female).\nage(tom, 52).\nage(bob, unknown).", LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		":- pred likes(atom, list(atom), number).",
+		":- pred sex(atom, {female, male}).",
+		":- pred age(atom, atomic).",
+	}, e.InferDeclarations())
+}
+
+func TestEngine_WhatIfChecksAssumptions(t *testing.T) {
+	e := &Engine{factKeys: make(map[string]int)}
+	require.NoError(t, e.LoadFacts(":- pred age(atom, integer).\nage(tom, 52)."))
+
+	// Assumptions are checked like loaded clauses before anything runs
+	_, err := e.WhatIf(context.Background(), "age(X, A).", Assumptions{Add: "age(bob, old)."})
+	var mismatch *DeclarationError
+	require.ErrorAs(t, err, &mismatch)
+	assert.Equal(t, "argument 2 of age/2: expected integer, got old", mismatch.Mismatches[0].Reason)
+
+	_, err = e.WhatIf(context.Background(), "age(X, A).", Assumptions{Add: "age(bob, 30). :- initialization(halt)."})
+	var rejected *DirectiveError
+	require.ErrorAs(t, err, &rejected)
+	assert.Equal(t, []string{"age(tom, 52)."}, e.GetLoadedFacts())
+}
+
+func TestReadConsistency(t *testing.T) {
+	e := &Engine{constraints: []clause{{text: ":- note(X, Y)."}, {text: ":- bad(X)."}}}
+	report := &ConsistencyReport{}
+	e.readConsistency(report, &QueryResult{rest: strings.Join([]string{
+		violationMarker + "\t0\t\t[\"X = 'a\\\\tb'\",\"Y = \\\"line\\\\nbreak\\\"\"]",
+		violationMarker + "\t0\t\t[]",
+		constraintMarker + "\t0\tmore",
+		constraintMarker + "\t1\terror\t\"Type error:\\t`integer' expected\"",
+		violationMarker + "\t2\t\t[]",
+	}, "\n")})
+
+	assert.Equal(t, []Violation{
+		{Constraint: ":- note(X, Y).", Bindings: `X = 'a\tb', Y = "line\nbreak"`},
+		{Constraint: ":- note(X, Y)."},
+	}, report.Violations)
+	assert.Equal(t, []string{":- note(X, Y)."}, report.Incomplete)
+	assert.Equal(t, []ConstraintFailure{{Constraint: ":- bad(X).", Error: "Type error:\t`integer' expected"}}, report.Failures)
+}
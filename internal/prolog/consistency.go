@@ -0,0 +1,369 @@
+package prolog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxViolations bounds the violations reported per constraint
+const maxViolations = 100
+
+// Markers of the result file lines written by the consistency check
+const (
+	violationMarker  = "__LOGIC_MCP_VIOLATION__"
+	constraintMarker = "__LOGIC_MCP_CONSTRAINT__"
+)
+
+// Violation is a solution of the body of an integrity constraint
+type Violation struct {
+	Constraint string `json:"constraint"`
+	// Bindings are those of the named variables of the constraint, as
+	// "X = tom, Y = bob"
+	Bindings string `json:"bindings,omitempty"`
+	// Facts are the knowledge base facts the violation rests on, if they
+	// could be found
+	Facts []Clause `json:"facts,omitempty"`
+}
+
+// key identifies a violation across checks of different knowledge bases
+func (v Violation) key() string {
+	return v.Constraint + "\x00" + v.Bindings
+}
+
+// ConstraintFailure is a constraint that could not be checked
+type ConstraintFailure struct {
+	Constraint string `json:"constraint"`
+	Error      string `json:"error"`
+}
+
+// ConsistencyReport is the outcome of CheckConsistency
+type ConsistencyReport struct {
+	// Constraints is the number of constraints checked
+	Constraints int
+	Violations  []Violation
+	// Incomplete lists the constraints with more than maxViolations
+	// violations, of which only the first are reported
+	Incomplete []string
+	Failures   []ConstraintFailure
+	// Result is the underlying query result, with timings and messages
+	Result *QueryResult
+}
+
+// Consistent reports whether no constraint is violated
+func (r *ConsistencyReport) Consistent() bool {
+	return len(r.Violations) == 0
+}
+
+// ConsistencyError reports the violations a load would introduce
+type ConsistencyError struct {
+	Violations []Violation
+}
+
+func (e *ConsistencyError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "load rejected: it introduces %d violations of integrity constraints", len(e.Violations))
+	for _, v := range e.Violations {
+		fmt.Fprintf(&b, "\n  %s", v.Constraint)
+		if v.Bindings != "" {
+			fmt.Fprintf(&b, " with %s", v.Bindings)
+		}
+		for _, f := range v.Facts {
+			fmt.Fprintf(&b, "\n    %s: %s", f.Source, f.Text)
+		}
+	}
+	return b.String()
+}
+
+// AddConstraints adds integrity constraints, one per line. A constraint is
+// a denial, ":- Body.", violated by every solution of Body, e.g.
+// ":- parent(X, X)." or ":- male(X), female(X).". Constraints already
+// declared are skipped; the number added is returned.
+func (e *Engine) AddConstraints(text string) (int, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.closed {
+		return 0, fmt.Errorf("engine is closed")
+	}
+
+	parsed := parseLines(text, Source{File: "constraints"}, nil)
+	for _, c := range parsed {
+		if !strings.HasPrefix(c.text, ":-") || denialBody(c.text) == "" {
+			return 0, fmt.Errorf("%s: a constraint must be a denial such as ':- parent(X, X).': %s", c.source, c.text)
+		}
+	}
+
+	added := 0
+	for _, c := range parsed {
+		key := clauseKey(c.text)
+		if slices.ContainsFunc(e.constraints, func(d clause) bool { return clauseKey(d.text) == key }) {
+			continue
+		}
+		e.constraints = append(e.constraints, c)
+		added++
+	}
+	return added, nil
+}
+
+// RemoveConstraints removes integrity constraints, compared like loaded
+// clauses. Removing a constraint that is not declared is an error.
+func (e *Engine) RemoveConstraints(texts []string) (int, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.closed {
+		return 0, fmt.Errorf("engine is closed")
+	}
+
+	remove := make(map[string]bool)
+	for _, t := range texts {
+		text := strings.TrimSpace(t)
+		if text == "" {
+			continue
+		}
+		if !strings.HasSuffix(text, ".") {
+			text += "."
+		}
+		key := clauseKey(text)
+		if !slices.ContainsFunc(e.constraints, func(c clause) bool { return clauseKey(c.text) == key }) {
+			return 0, fmt.Errorf("cannot remove %s: it is not a declared constraint", text)
+		}
+		remove[key] = true
+	}
+
+	before := len(e.constraints)
+	e.constraints = slices.DeleteFunc(e.constraints, func(c clause) bool { return remove[clauseKey(c.text)] })
+	return before - len(e.constraints), nil
+}
+
+// Constraints returns the declared integrity constraints
+func (e *Engine) Constraints() []string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	texts := make([]string, len(e.constraints))
+	for i, c := range e.constraints {
+		texts[i] = c.text
+	}
+	return texts
+}
+
+// CheckConsistency checks the knowledge base against every integrity
+// constraint and reports each violation with the facts it rests on.
+// Constraints calling unknown predicates are not violated.
+func (e *Engine) CheckConsistency(ctx context.Context) (*ConsistencyReport, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.closed {
+		return nil, fmt.Errorf("engine is closed")
+	}
+	return e.consistency(ctx, e.facts)
+}
+
+// consistency checks facts against the constraints. The caller must hold
+// the mutex.
+func (e *Engine) consistency(ctx context.Context, facts []clause) (*ConsistencyReport, error) {
+	report := &ConsistencyReport{Constraints: len(e.constraints)}
+	if len(e.constraints) == 0 {
+		report.Result = &QueryResult{Success: true}
+		return report, nil
+	}
+
+	result, err := e.query(ctx, facts, "true.", e.consistencySource(), nil, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if result.Error != "" {
+		return nil, fmt.Errorf("consistency check failed: %s", result.Error)
+	}
+	if !result.Success {
+		return nil, fmt.Errorf("consistency check failed: it stopped before checking every constraint")
+	}
+	report.Result = result
+	e.readConsistency(report, result)
+	return report, nil
+}
+
+// readConsistency adds the violations, incomplete constraints and failures
+// written by the consistency check to report
+func (e *Engine) readConsistency(report *ConsistencyReport, result *QueryResult) {
+	constraint := func(field string) (string, bool) {
+		i, err := strconv.Atoi(field)
+		if err != nil || i < 0 || i >= len(e.constraints) {
+			return "", false
+		}
+		return e.constraints[i].text, true
+	}
+	for _, line := range strings.Split(result.rest, "\n") {
+		fields := strings.Split(line, "\t")
+		switch {
+		case fields[0] == violationMarker && len(fields) == 4:
+			text, ok := constraint(fields[1])
+			if !ok {
+				continue
+			}
+			var bindings []string
+			if err := json.Unmarshal([]byte(fields[3]), &bindings); err != nil {
+				continue
+			}
+			v := Violation{Constraint: text, Bindings: strings.Join(bindings, ", ")}
+			for _, l := range strings.Split(fields[2], ",") {
+				n, err := strconv.Atoi(l)
+				if err != nil {
+					continue
+				}
+				if i := clauseAt(n, result.starts, result.program); i >= 0 {
+					v.Facts = append(v.Facts, result.program[i].export())
+				}
+			}
+			report.Violations = append(report.Violations, v)
+		case fields[0] == constraintMarker && len(fields) >= 3:
+			text, ok := constraint(fields[1])
+			if !ok {
+				continue
+			}
+			if fields[2] == "more" {
+				report.Incomplete = append(report.Incomplete, text)
+			} else if fields[2] == "error" && len(fields) == 4 {
+				var message string
+				if err := json.Unmarshal([]byte(fields[3]), &message); err == nil {
+					report.Failures = append(report.Failures, ConstraintFailure{Constraint: text, Error: message})
+				}
+			}
+		}
+	}
+}
+
+// checkViolations rejects a load that would change the knowledge base to
+// next if next violates a constraint the knowledge base does not. The
+// caller must hold the mutex.
+func (e *Engine) checkViolations(next []clause) error {
+	ctx, cancel := e.loadContext()
+	defer cancel()
+
+	before, err := e.consistency(ctx, e.facts)
+	if err != nil {
+		return err
+	}
+	after, err := e.consistency(ctx, next)
+	if err != nil {
+		return err
+	}
+
+	known := make(map[string]bool, len(before.Violations))
+	for _, v := range before.Violations {
+		known[v.key()] = true
+	}
+	var introduced []Violation
+	for _, v := range after.Violations {
+		if !known[v.key()] {
+			introduced = append(introduced, v)
+		}
+	}
+	if len(introduced) > 0 {
+		return &ConsistencyError{Violations: introduced}
+	}
+	return nil
+}
+
+// denialBody returns Body of the denial ":- Body."
+func denialBody(text string) string {
+	body := strings.TrimSpace(strings.TrimPrefix(text, ":-"))
+	return strings.TrimSpace(strings.TrimSuffix(body, "."))
+}
+
+// consistencySource defines logic_mcp_solve/4 for the consistency check.
+// The bodies of the constraints are data, read when they are checked; for
+// every solution the meta-interpreter of proveSource finds the facts used.
+// Facts of other files, such as the preload library, have line 0 and are
+// left out, so they are never taken for the knowledge base facts on the
+// same lines.
+// Bindings and error messages are written as JSON, so that no value can
+// break the line it is written on.
+// The caller must hold the mutex.
+func (e *Engine) consistencySource() string {
+	var b strings.Builder
+	for i, c := range e.constraints {
+		fmt.Fprintf(&b, "logic_mcp_constraint(%d, %s).\n", i, quoteAtom(denialBody(c.text)))
+	}
+	safe := "true"
+	if e.opts.Sandbox == SandboxRestricted {
+		safe = "safe_goal(user:Body)"
+	}
+
+	return b.String() + fmt.Sprintf(`
+logic_mcp_solve(Out, _, _, true) :-
+    forall(logic_mcp_constraint(I, Text), logic_mcp_check(Out, I, Text)).
+
+logic_mcp_check(Out, I, Text) :-
+    catch(( term_string(Body, Text, [variable_names(Names)]),
+            logic_mcp_safe(Body),
+            exclude(logic_mcp_hidden, Names, Shown),
+            logic_mcp_violations(Out, I, Body, Shown)
+          ), Error, logic_mcp_check_error(Out, I, Error)).
+
+logic_mcp_safe(Body) :-
+    %[1]s.
+
+logic_mcp_violations(Out, I, Body, Names) :-
+    nb_setval(logic_mcp_violations, 0),
+    forall(limit(%[2]d, Body),
+           ( nb_getval(logic_mcp_violations, N0),
+             N is N0 + 1,
+             nb_setval(logic_mcp_violations, N),
+             (   N =< %[3]d
+             ->  logic_mcp_violation(Out, I, Body, Names)
+             ;   format(Out, "~w\t~d\tmore~n", [%[5]s, I])
+             )
+           )).
+
+logic_mcp_violation(Out, I, Body, Names) :-
+    (   catch(call_with_inference_limit(once(logic_mcp_prove(Body, %[6]d, Proof)), %[7]d, R), _, fail),
+        R \== inference_limit_exceeded
+    ->  findall(L, ( logic_mcp_proof_step(Proof, clause(_, L, [])), L > 0 ), Ls),
+        sort(Ls, Lines)
+    ;   Lines = []
+    ),
+    atomic_list_concat(Lines, ',', LineText),
+    findall(T, ( member(Name=Value, Names), format(string(T), "~w = ~q", [Name, Value]) ), Texts),
+    with_output_to(string(Bindings), logic_mcp_json_texts(Texts)),
+    format(Out, "~w\t~d\t~w\t~w~n", [%[4]s, I, LineText, Bindings]).
+
+logic_mcp_json_texts(Texts) :-
+    put_char('['),
+    foldl(logic_mcp_json_text, Texts, '', _),
+    put_char(']').
+
+logic_mcp_json_text(Text, Sep, ',') :-
+    write(Sep),
+    logic_mcp_json_string(Text).
+
+logic_mcp_proof_step(Steps, Step) :-
+    member(S, Steps),
+    (   Step = S
+    ;   S = clause(_, _, Sub),
+        logic_mcp_proof_step(Sub, Step)
+    ).
+
+logic_mcp_check_error(_, _, error(existence_error(procedure, _), _)) :- !.
+logic_mcp_check_error(Out, I, Error) :-
+    (   catch(( translate_message(Error, Lines, []),
+                with_output_to(string(Text), print_message_lines(current_output, '', Lines))
+              ), _, fail)
+    ->  true
+    ;   format(string(Text), "~q", [Error])
+    ),
+    split_string(Text, "\n\t", " ", Parts),
+    exclude(==(""), Parts, Words),
+    atomic_list_concat(Words, ' ', Message),
+    with_output_to(string(Json), logic_mcp_json_string(Message)),
+    format(Out, "~w\t~d\terror\t~w~n", [%[5]s, I, Json]).
+`, safe, maxViolations+1, maxViolations, quoteAtom(violationMarker), quoteAtom(constraintMarker),
+		DefaultMaxDepth, DefaultMaxInferences) + proveSource
+}
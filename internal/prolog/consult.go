@@ -0,0 +1,155 @@
+package prolog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/tomasz-sikora/logic-mcp/internal/metrics"
+)
+
+// ConsultResult reports what consulting a file added to the knowledge base
+type ConsultResult struct {
+	File     string   `json:"file"`
+	Load     int      `json:"load" jsonschema:"Number of the load, as used in messages about its clauses."`
+	Clauses  int      `json:"clauses" jsonschema:"Number of clauses added."`
+	Skipped  int      `json:"skipped,omitempty" jsonschema:"Number of clauses skipped because they were already loaded."`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// ConsultFile adds the clauses of a Prolog source file to the knowledge
+// base. Unlike LoadFacts it keeps clauses that span several lines. The file
+// is read once and the text checked is compiled by swipl: errors reject the
+// whole file, warnings (such as singleton variables) are reported in the
+// result. The clauses are then loaded the way LoadFactsWithOptions loads
+// them with opts, so clauses already loaded are skipped. name is the file
+// name used in messages.
+func (e *Engine) ConsultFile(ctx context.Context, path, name string, opts LoadOptions) (*ConsultResult, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	var clauses []clause
+	for _, c := range splitClausesAt(string(src)) {
+		clauses = append(clauses, clause{text: c.text, source: Source{File: name, Line: c.line, Column: c.column}})
+	}
+	if n := len(clauses); n > 0 && !strings.HasSuffix(clauses[n-1].text, ".") {
+		return nil, fmt.Errorf("%s: clause not terminated by a period at end of file", name)
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.closed {
+		return nil, fmt.Errorf("engine is closed")
+	}
+	// Directives run when the file is compiled, so they are checked first
+	if err := e.checkClauses(clauses); err != nil {
+		return nil, err
+	}
+
+	// A copy of the text checked is compiled, not the file, which may have
+	// changed since it was read
+	file, err := e.createTempFile("consult.pl")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer e.removeTempFile(file)
+	if err := os.WriteFile(file, src, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	warnings, err := e.compileFile(ctx, file, name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	result, err := e.load(clauses, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &ConsultResult{
+		File:     name,
+		Load:     result.Load,
+		Clauses:  result.Added,
+		Skipped:  result.Skipped,
+		Warnings: warnings,
+	}, nil
+}
+
+// compileFile loads a file in a scratch swipl process and returns the
+// warnings it printed, or an error carrying the errors it printed. Messages
+// name the file name rather than its path. The caller must hold the mutex.
+func (e *Engine) compileFile(ctx context.Context, path, name string) ([]string, error) {
+	warnings, errs, runErr := e.compile(ctx, path, "")
+	for i, w := range warnings {
+		warnings[i] = strings.ReplaceAll(w, path, name)
+	}
+	for i, m := range errs {
+		errs[i] = strings.ReplaceAll(m, path, name)
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("compilation failed:\n%s", strings.Join(errs, "\n"))
+	}
+	if runErr != nil {
+		return nil, fmt.Errorf("compilation failed: %w", runErr)
+	}
+	return warnings, nil
+}
+
+// compile loads a file in a scratch swipl process under the session flags
+// and operators, runs goal if not empty, and returns the warnings and
+// errors it printed and how it exited. The run is admitted by the quotas;
+// a refusal is returned as runErr. The caller must hold the mutex.
+func (e *Engine) compile(ctx context.Context, path, goal string) (warnings, errs []string, runErr error) {
+	// The settings are a file of their own, so messages about path keep
+	// its line numbers
+	settings, err := e.createTempFile("settings.pl")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer e.removeTempFile(settings)
+	if err := os.WriteFile(settings, []byte(operatorSource+e.settingsSource()), 0644); err != nil {
+		return nil, nil, fmt.Errorf("failed to write settings: %w", err)
+	}
+
+	release, err := e.admit()
+	if err != nil {
+		return nil, nil, err
+	}
+	if goal == "" {
+		goal = "true"
+	}
+	// swipl restores the flags at the end of each file, so they are applied
+	// again before path is loaded
+	goal = fmt.Sprintf("load_files(%s, []), logic_mcp_settings, load_files(%s, []), %s, halt",
+		quoteAtom(settings), quoteAtom(path), goal)
+	cmd := exec.CommandContext(ctx, "swipl", "--on-error=status", "-q", "-g", goal, "-t", "halt(1)")
+	setProcessGroup(cmd)
+	cmd.WaitDelay = processWaitDelay
+
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	runErr = cmd.Run()
+	killProcessGroup(cmd)
+	if cmd.Process != nil {
+		metrics.SwiplSpawned()
+	}
+	var cpu time.Duration
+	if cmd.ProcessState != nil {
+		cpu = cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime()
+	}
+	release(cpu)
+
+	warnings, errs = parseMessages(stderr.String())
+	return warnings, errs, runErr
+}
+
+// parseMessages groups swipl's "Warning:" and "ERROR:" lines into messages
+func parseMessages(output string) (warnings, errs []string) {
+	_, warnings, errs = splitMessages(output)
+	return warnings, errs
+}
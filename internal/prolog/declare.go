@@ -0,0 +1,628 @@
+package prolog
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// builtinTypes are the types of declarations besides list(T), enumerations
+// such as {red, green} and names defined with ":- type"
+var builtinTypes = []string{"any", "atom", "atomic", "compound", "float", "integer", "number", "string"}
+
+// maxEnumValues bounds the atoms of an inferred enumeration
+const maxEnumValues = 5
+
+var (
+	integerPattern = regexp.MustCompile(`^[+-]?([0-9][0-9_]*|0x[0-9a-fA-F]+|0o[0-7]+|0b[01]+|0'.+)$`)
+	floatPattern   = regexp.MustCompile(`^[+-]?[0-9]+(\.[0-9]+([eE][+-]?[0-9]+)?|[eE][+-]?[0-9]+)$`)
+)
+
+// typeExpr is a parsed type: a builtin or defined name, list(Elem), or an
+// enumeration of atoms
+type typeExpr struct {
+	name   string
+	elem   *typeExpr
+	values []string
+}
+
+func (t *typeExpr) String() string {
+	switch {
+	case t.values != nil:
+		return "{" + strings.Join(t.values, ", ") + "}"
+	case t.elem != nil:
+		return "list(" + t.elem.String() + ")"
+	default:
+		return t.name
+	}
+}
+
+// parseType parses a type such as atom, list(integer) or {red, green}
+func parseType(s string) (*typeExpr, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+		values, ok := splitTopLevel(s[1 : len(s)-1])
+		if !ok || len(values) == 0 {
+			return nil, fmt.Errorf("invalid enumeration %s", s)
+		}
+		t := &typeExpr{values: []string{}}
+		for _, v := range values {
+			if termKind(v) != "atom" {
+				return nil, fmt.Errorf("enumeration %s: %s is not an atom", s, v)
+			}
+			t.values = append(t.values, normalizeAtom(v))
+		}
+		return t, nil
+	}
+
+	name, args, rest, ok := splitGoal(s)
+	if !ok || strings.TrimSpace(rest) != "" {
+		return nil, fmt.Errorf("invalid type %s", s)
+	}
+	switch {
+	case name == "list" && len(args) == 1:
+		elem, err := parseType(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return &typeExpr{name: "list", elem: elem}, nil
+	case args != nil:
+		return nil, fmt.Errorf("invalid type %s: only list takes an argument", s)
+	}
+	return &typeExpr{name: name}, nil
+}
+
+// predDecl is a parsed ":- pred" declaration
+type predDecl struct {
+	name  string
+	modes []string // +, - or ?; empty when not given
+	types []*typeExpr
+}
+
+func (p *predDecl) indicator() string {
+	return predicateIndicator(p.name, len(p.types))
+}
+
+// declaration is a ":- pred" or ":- type" declaration of the knowledge base
+type declaration struct {
+	clause
+	// key is what a later declaration replaces, e.g. pred parent/2
+	key      string
+	pred     *predDecl
+	typeName string
+	typ      *typeExpr
+}
+
+// Declaration is a type or predicate declaration
+type Declaration struct {
+	Text   string `json:"text"`
+	Source Source `json:"source"`
+}
+
+// TypeMismatch is a clause that does not match the declaration of its
+// predicate
+type TypeMismatch struct {
+	Clause string `json:"clause"`
+	Source Source `json:"source"`
+	Reason string `json:"reason"`
+}
+
+// DeclarationError reports every clause of a load that does not match its
+// declaration
+type DeclarationError struct {
+	Mismatches []TypeMismatch
+}
+
+func (e *DeclarationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d clauses do not match their declarations", len(e.Mismatches))
+	for _, m := range e.Mismatches {
+		fmt.Fprintf(&b, "\n  %s: %s: %s", m.Source, m.Reason, m.Clause)
+	}
+	return b.String()
+}
+
+// isDeclaration reports whether a clause is a ":- pred" or ":- type"
+// declaration
+func isDeclaration(text string) bool {
+	if !strings.HasPrefix(text, ":-") {
+		return false
+	}
+	body := strings.TrimSpace(text[2:])
+	for _, keyword := range []string{"pred", "type"} {
+		if rest, ok := strings.CutPrefix(body, keyword); ok && rest != "" && isLayout(rest[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDeclaration parses ":- pred name(Mode Type, ...)." or
+// ":- type name = Type."
+func parseDeclaration(c clause) (*declaration, error) {
+	body := strings.TrimSpace(c.text[2:])
+	body = strings.TrimSpace(strings.TrimSuffix(body, "."))
+	d := &declaration{clause: c}
+
+	if rest, ok := strings.CutPrefix(body, "type"); ok {
+		name, def, ok := strings.Cut(rest, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || termKind(name) != "atom" || !(name[0] >= 'a' && name[0] <= 'z') {
+			return nil, fmt.Errorf("%s: a type declaration has the form ':- type name = Type.': %s", c.source, c.text)
+		}
+		if slices.Contains(builtinTypes, name) || name == "list" {
+			return nil, fmt.Errorf("%s: cannot redefine the type %s", c.source, name)
+		}
+		typ, err := parseType(def)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", c.source, err)
+		}
+		d.key, d.typeName, d.typ = "type "+name, name, typ
+		return d, nil
+	}
+
+	rest, _ := strings.CutPrefix(body, "pred")
+	name, args, tail, ok := splitGoal(strings.TrimSpace(rest))
+	if !ok || strings.TrimSpace(tail) != "" {
+		return nil, fmt.Errorf("%s: a predicate declaration has the form ':- pred name(Type, ...).': %s", c.source, c.text)
+	}
+	p := &predDecl{name: name}
+	for _, arg := range args {
+		mode := ""
+		if arg != "" && strings.ContainsRune("+-?", rune(arg[0])) {
+			mode, arg = arg[:1], arg[1:]
+		}
+		typ, err := parseType(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", c.source, err)
+		}
+		p.modes = append(p.modes, mode)
+		p.types = append(p.types, typ)
+	}
+	d.key, d.pred = "pred "+p.indicator(), p
+	return d, nil
+}
+
+// mergeDeclarations returns decls added to old, each replacing an earlier
+// declaration of the same type or predicate
+func mergeDeclarations(old, decls []*declaration) []*declaration {
+	merged := slices.Clone(old)
+	for _, d := range decls {
+		i := slices.IndexFunc(merged, func(o *declaration) bool { return o.key == d.key })
+		if i >= 0 {
+			merged[i] = d
+		} else {
+			merged = append(merged, d)
+		}
+	}
+	return merged
+}
+
+// splitDeclarations removes the declarations from clauses and parses them
+func splitDeclarations(clauses []clause) ([]clause, []*declaration, error) {
+	var rest []clause
+	var decls []*declaration
+	for _, c := range clauses {
+		if !isDeclaration(c.text) {
+			rest = append(rest, c)
+			continue
+		}
+		d, err := parseDeclaration(c)
+		if err != nil {
+			return nil, nil, err
+		}
+		decls = append(decls, d)
+	}
+	return rest, decls, nil
+}
+
+// checkTypeNames rejects a declaration of decls that uses a type name
+// neither builtin nor defined in declarations, such as a misspelt intger
+func checkTypeNames(decls, declarations []*declaration) error {
+	defined := make(map[string]bool)
+	for _, d := range declarations {
+		if d.typ != nil {
+			defined[d.typeName] = true
+		}
+	}
+	for _, d := range decls {
+		types := []*typeExpr{d.typ}
+		if d.pred != nil {
+			types = d.pred.types
+		}
+		for _, t := range types {
+			if name := unknownType(t, defined); name != "" {
+				return fmt.Errorf("%s: unknown type %s; define it first, e.g. ':- type %s = atom.': %s", d.source, name, name, d.text)
+			}
+		}
+	}
+	return nil
+}
+
+// unknownType returns the first name in t that is neither builtin nor
+// defined, or ""
+func unknownType(t *typeExpr, defined map[string]bool) string {
+	switch {
+	case t.values != nil:
+		return ""
+	case t.elem != nil:
+		return unknownType(t.elem, defined)
+	case slices.Contains(builtinTypes, t.name) || defined[t.name]:
+		return ""
+	}
+	return t.name
+}
+
+// checkDeclared checks clauses against the declarations and returns a
+// mismatch for every clause whose predicate is declared with another arity,
+// or whose head arguments do not have the declared types. Arguments of
+// facts with mode + must be bound.
+func checkDeclared(clauses []clause, decls []*declaration) []TypeMismatch {
+	types := make(map[string]*typeExpr)
+	preds := make(map[string][]*predDecl)
+	for _, d := range decls {
+		if d.typ != nil {
+			types[d.typeName] = d.typ
+		} else {
+			preds[d.pred.name] = append(preds[d.pred.name], d.pred)
+		}
+	}
+	if len(preds) == 0 {
+		return nil
+	}
+
+	var mismatches []TypeMismatch
+	for _, c := range clauses {
+		if isDirective(c.text) {
+			continue
+		}
+		head, fact := ruleHead(c.text)
+		name, args, rest, ok := splitGoal(head)
+		if !ok || strings.TrimSpace(rest) != "" || preds[name] == nil {
+			continue
+		}
+		if reason := checkHead(name, args, fact, preds[name], types); reason != "" {
+			mismatches = append(mismatches, TypeMismatch{Clause: c.text, Source: c.source, Reason: reason})
+		}
+	}
+	return mismatches
+}
+
+// checkHead checks the arguments of a head against the declarations of its
+// predicate name
+func checkHead(name string, args []string, fact bool, decls []*predDecl, types map[string]*typeExpr) string {
+	i := slices.IndexFunc(decls, func(p *predDecl) bool { return len(p.types) == len(args) })
+	if i < 0 {
+		declared := make([]string, len(decls))
+		for j, p := range decls {
+			declared[j] = p.indicator()
+		}
+		return fmt.Sprintf("%s does not match the declaration of %s", predicateIndicator(name, len(args)), strings.Join(declared, ", "))
+	}
+	p := decls[i]
+	for j, arg := range args {
+		if termKind(arg) == "var" {
+			if fact && p.modes[j] == "+" {
+				return fmt.Sprintf("argument %d of %s must be bound (mode +)", j+1, p.indicator())
+			}
+			continue
+		}
+		if !hasType(arg, p.types[j], types, 0) {
+			return fmt.Sprintf("argument %d of %s: expected %s, got %s", j+1, p.indicator(), p.types[j], arg)
+		}
+	}
+	return ""
+}
+
+// hasType reports whether a term has a type. Variables have every type;
+// types defined in terms of themselves have no other terms.
+func hasType(term string, t *typeExpr, types map[string]*typeExpr, depth int) bool {
+	kind := termKind(term)
+	if kind == "var" {
+		return true
+	}
+	switch {
+	case t.values != nil:
+		return kind == "atom" && slices.Contains(t.values, normalizeAtom(term))
+	case t.elem != nil:
+		elems, tail, ok := listElements(term)
+		if !ok || tail != "" && termKind(tail) != "var" {
+			return false
+		}
+		for _, elem := range elems {
+			if !hasType(elem, t.elem, types, depth) {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch t.name {
+	case "any":
+		return true
+	case "atom", "integer", "float", "string", "compound":
+		return kind == t.name
+	case "number":
+		return kind == "integer" || kind == "float"
+	case "atomic":
+		return kind == "atom" || kind == "integer" || kind == "float" || kind == "string"
+	}
+	if def, ok := types[t.name]; ok && depth < 10 {
+		return hasType(term, def, types, depth+1)
+	}
+	return false
+}
+
+// ruleHead returns the head of a clause and whether the clause is a fact
+func ruleHead(text string) (string, bool) {
+	s := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "."))
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\'', '"', '`':
+			end := closingQuote(s, i)
+			if end < 0 {
+				return s, true
+			}
+			i = end
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case ':':
+			if depth == 0 && i+1 < len(s) && s[i+1] == '-' {
+				return strings.TrimSpace(s[:i]), false
+			}
+		}
+	}
+	return s, true
+}
+
+// termKind classifies a term written in Prolog syntax: var, integer, float,
+// string, atom, list or compound. As in swipl, [] is not an atom.
+func termKind(s string) string {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "":
+		return "compound"
+	case s[0] == '_' || s[0] >= 'A' && s[0] <= 'Z':
+		if strings.IndexFunc(s, func(r rune) bool { return r > 127 || !isAtomChar(byte(r)) }) < 0 {
+			return "var"
+		}
+	case integerPattern.MatchString(s):
+		return "integer"
+	case floatPattern.MatchString(s):
+		return "float"
+	case s[0] == '"':
+		if closingQuote(s, 0) == len(s)-1 {
+			return "string"
+		}
+	case s[0] == '\'':
+		if closingQuote(s, 0) == len(s)-1 {
+			return "atom"
+		}
+	case s == "{}" || s == "!" || s == ";":
+		return "atom"
+	case s[0] == '[':
+		if _, _, ok := listElements(s); ok {
+			return "list"
+		}
+	case s[0] >= 'a' && s[0] <= 'z':
+		if strings.IndexFunc(s, func(r rune) bool { return r > 127 || !isAtomChar(byte(r)) }) < 0 {
+			return "atom"
+		}
+	case isSymbolChar(s[0]):
+		if strings.IndexFunc(s, func(r rune) bool { return r > 127 || !isSymbolChar(byte(r)) }) < 0 {
+			return "atom"
+		}
+	}
+	return "compound"
+}
+
+// normalizeAtom writes an atom without quotes where they are not needed
+func normalizeAtom(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > 2 && s[0] == '\'' {
+		inner := s[1 : len(s)-1]
+		if inner[0] >= 'a' && inner[0] <= 'z' && strings.IndexFunc(inner, func(r rune) bool { return r > 127 || !isAtomChar(byte(r)) }) < 0 {
+			return inner
+		}
+	}
+	return s
+}
+
+// listElements returns the elements and the tail, if any, of a list
+func listElements(s string) (elems []string, tail string, ok bool) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != '[' || s[len(s)-1] != ']' {
+		return nil, "", false
+	}
+	inner := strings.TrimSpace(s[1 : len(s)-1])
+	if inner == "" {
+		return nil, "", true
+	}
+	parts, ok := splitTopLevel(inner)
+	if !ok {
+		return nil, "", false
+	}
+	// The tail follows a top-level | in the last element
+	last := parts[len(parts)-1]
+	if i := topLevelIndex(last, '|'); i >= 0 {
+		parts[len(parts)-1], tail = strings.TrimSpace(last[:i]), strings.TrimSpace(last[i+1:])
+	}
+	return parts, tail, true
+}
+
+// splitTopLevel splits a comma-separated sequence of terms
+func splitTopLevel(s string) ([]string, bool) {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\'', '"', '`':
+			end := closingQuote(s, i)
+			if end < 0 {
+				return nil, false
+			}
+			i = end
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+			if depth < 0 {
+				return nil, false
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, false
+	}
+	return append(parts, strings.TrimSpace(s[start:])), true
+}
+
+// topLevelIndex returns the index of c outside quotes and brackets, or -1
+func topLevelIndex(s string, c byte) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\'', '"', '`':
+			end := closingQuote(s, i)
+			if end < 0 {
+				return -1
+			}
+			i = end
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case c:
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Declarations returns the type and predicate declarations
+func (e *Engine) Declarations() []Declaration {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	out := make([]Declaration, len(e.declarations))
+	for i, d := range e.declarations {
+		out[i] = Declaration{Text: d.text, Source: d.source}
+	}
+	return out
+}
+
+// InferDeclarations proposes a declaration for every undeclared predicate
+// with facts, from the arguments of its facts. An argument whose facts hold
+// two to maxEnumValues atoms, each at least twice on average, is proposed
+// as an enumeration.
+func (e *Engine) InferDeclarations() []string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	declared := make(map[string]bool)
+	for _, d := range e.declarations {
+		if d.pred != nil {
+			declared[d.pred.indicator()] = true
+		}
+	}
+
+	var order []string
+	names := make(map[string]string)
+	facts := make(map[string][][]string)
+	for _, c := range e.facts {
+		if isDirective(c.text) {
+			continue
+		}
+		head, fact := ruleHead(c.text)
+		name, args, rest, ok := splitGoal(head)
+		if !fact || !ok || strings.TrimSpace(rest) != "" || len(args) == 0 {
+			continue
+		}
+		indicator := predicateIndicator(name, len(args))
+		if declared[indicator] {
+			continue
+		}
+		if facts[indicator] == nil {
+			order = append(order, indicator)
+			names[indicator] = name
+		}
+		facts[indicator] = append(facts[indicator], args)
+	}
+
+	var proposals []string
+	for _, indicator := range order {
+		rows := facts[indicator]
+		types := make([]string, len(rows[0]))
+		for i := range types {
+			column := make([]string, len(rows))
+			for j, row := range rows {
+				column[j] = row[i]
+			}
+			types[i] = inferType(column, true).String()
+		}
+		proposals = append(proposals, fmt.Sprintf(":- pred %s(%s).", names[indicator], strings.Join(types, ", ")))
+	}
+	return proposals
+}
+
+// inferType returns the most specific type of terms. Enumerations are
+// proposed only if enum is set.
+func inferType(terms []string, enum bool) *typeExpr {
+	kinds := make(map[string]bool)
+	var atoms, elems []string
+	for _, t := range terms {
+		kind := termKind(t)
+		switch kind {
+		case "var":
+			continue
+		case "atom":
+			atoms = append(atoms, normalizeAtom(t))
+		case "list":
+			items, tail, _ := listElements(t)
+			if tail != "" {
+				kind = "any"
+			}
+			elems = append(elems, items...)
+		}
+		kinds[kind] = true
+	}
+
+	switch {
+	case len(kinds) == 0:
+		return &typeExpr{name: "any"}
+	case len(kinds) == 1 && kinds["atom"]:
+		values := slices.Compact(slices.Sorted(slices.Values(atoms)))
+		if enum && len(values) >= 2 && len(values) <= maxEnumValues && len(atoms) >= 2*len(values) {
+			return &typeExpr{values: values}
+		}
+		return &typeExpr{name: "atom"}
+	case len(kinds) == 1 && kinds["list"]:
+		return &typeExpr{name: "list", elem: inferType(elems, false)}
+	case len(kinds) == 1:
+		return &typeExpr{name: slices.Collect(maps.Keys(kinds))[0]}
+	}
+
+	delete(kinds, "integer")
+	delete(kinds, "float")
+	if len(kinds) == 0 {
+		return &typeExpr{name: "number"}
+	}
+	delete(kinds, "atom")
+	delete(kinds, "string")
+	if len(kinds) == 0 {
+		return &typeExpr{name: "atomic"}
+	}
+	return &typeExpr{name: "any"}
+}
@@ -0,0 +1,373 @@
+package prolog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultAllowedLibraries are the libraries directives may load when
+// EngineOptions.AllowedLibraries is empty
+var DefaultAllowedLibraries = []string{
+	"aggregate", "apply", "assoc", "clpb", "clpfd", "dcg/basics", "lists",
+	"ordsets", "pairs", "solution_sequences", "strings", "ugraphs", "yall",
+}
+
+// loadTimeout bounds the swipl runs of a load, such as the scratch run of
+// new directives, when the engine has no query timeout
+const loadTimeout = 10 * time.Second
+
+// RejectedDirective is a directive the allowlist does not permit
+type RejectedDirective struct {
+	Directive string `json:"directive"`
+	Source    Source `json:"source"`
+	Reason    string `json:"reason"`
+}
+
+// DirectiveError reports every directive of a load that was rejected
+type DirectiveError struct {
+	Rejected []RejectedDirective
+}
+
+func (e *DirectiveError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d directives rejected; allowed are use_module and ensure_loaded of permitted libraries, dynamic, discontiguous, table, op and set_prolog_flag of permitted flags", len(e.Rejected))
+	for _, r := range e.Rejected {
+		fmt.Fprintf(&b, "\n  %s: %s: %s", r.Source, r.Reason, r.Directive)
+	}
+	return b.String()
+}
+
+// isDirective reports whether a clause is a directive
+func isDirective(text string) bool {
+	_, ok := directiveBody(text)
+	return ok
+}
+
+// directiveBody returns Body of a directive as swipl reads it: ":- Body."
+// or "?- Body.", also with the clause in parentheses, as in "(:- Body).",
+// or with the functor quoted or in parentheses, as in "':-'(Body).",
+// "'?-' Body." or "(:-)(Body).".
+func directiveBody(text string) (string, bool) {
+	s := stripParens(strings.TrimSuffix(strings.TrimSpace(text), "."))
+	var name, rest string
+	switch {
+	case strings.HasPrefix(s, ":-") || strings.HasPrefix(s, "?-"):
+		name, rest = s[:2], s[2:]
+	case strings.HasPrefix(s, "'"):
+		end := closingQuote(s, 0)
+		if end < 0 {
+			return "", false
+		}
+		name, _ = unquoteAtom(s[:end+1])
+		rest = s[end+1:]
+	case strings.HasPrefix(s, "("):
+		end := matchingParen(s, 0)
+		if end < 0 {
+			return "", false
+		}
+		name = stripParens(s[:end+1])
+		if unquoted, ok := unquoteAtom(name); ok {
+			name = unquoted
+		}
+		rest = s[end+1:]
+	}
+	if name != ":-" && name != "?-" {
+		return "", false
+	}
+	return stripParens(rest), true
+}
+
+// stripParens removes the parentheses around all of s, as in "((a, b))"
+func stripParens(s string) string {
+	s = strings.TrimSpace(s)
+	for s != "" && s[0] == '(' && matchingParen(s, 0) == len(s)-1 {
+		s = strings.TrimSpace(s[1 : len(s)-1])
+	}
+	return s
+}
+
+// matchingParen returns the index of the bracket closing the one at start,
+// or -1
+func matchingParen(s string, start int) int {
+	depth := 0
+	for j := start; j < len(s); j++ {
+		switch s[j] {
+		case '\'', '"', '`':
+			end := closingQuote(s, j)
+			if end < 0 {
+				return -1
+			}
+			j = end
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// unquoteAtom returns the name of a quoted atom such as 'don\'t' or
+// '\x3A\-', or false if it has an escape swipl would not accept
+func unquoteAtom(s string) (string, bool) {
+	if len(s) < 2 || s[0] != '\'' || s[len(s)-1] != '\'' {
+		return "", false
+	}
+	var b strings.Builder
+	inner := s[1 : len(s)-1]
+	for i := 0; i < len(inner); i++ {
+		c := inner[i]
+		switch {
+		case c == '\'' && i+1 < len(inner) && inner[i+1] == '\'':
+			b.WriteByte('\'')
+			i++
+		case c != '\\':
+			b.WriteByte(c)
+		case i+1 >= len(inner):
+			return "", false
+		default:
+			i++
+			switch e := inner[i]; {
+			case e == 'x' || e >= '0' && e <= '7':
+				// \xHex\ or \Octal\
+				base, start := 8, i
+				if e == 'x' {
+					base, start = 16, i+1
+				}
+				end := strings.IndexByte(inner[start:], '\\')
+				if end <= 0 {
+					return "", false
+				}
+				r, err := strconv.ParseInt(inner[start:start+end], base, 32)
+				if err != nil {
+					return "", false
+				}
+				b.WriteRune(rune(r))
+				i = start + end
+			case e == 'u' || e == 'U':
+				n := 4
+				if e == 'U' {
+					n = 8
+				}
+				if i+n >= len(inner) {
+					return "", false
+				}
+				r, err := strconv.ParseInt(inner[i+1:i+1+n], 16, 32)
+				if err != nil {
+					return "", false
+				}
+				b.WriteRune(rune(r))
+				i += n
+			case e == '\n':
+				// Line continuation
+			case strings.IndexByte(`\'"`+"`", e) >= 0:
+				b.WriteByte(e)
+			default:
+				r, ok := map[byte]rune{'a': '\a', 'b': '\b', 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t', 'v': '\v', 'e': 0x1b, 's': ' '}[e]
+				if !ok {
+					return "", false
+				}
+				b.WriteRune(r)
+			}
+		}
+	}
+	return b.String(), true
+}
+
+// checkDirective returns why a directive is not allowed, or "" if it is.
+// Directives must be a single declaration: use_module/1,2 or
+// ensure_loaded/1 of a library in libs, dynamic, discontiguous, table,
+// op/3 of an operator that is not protected or set_prolog_flag/2 of an
+// allowed flag.
+func checkDirective(text string, libs []string) string {
+	body, _ := directiveBody(text)
+
+	name, args, rest, ok := splitGoal(body)
+	if !ok {
+		return "not a declaration"
+	}
+	switch name {
+	case "dynamic", "discontiguous", "table":
+		// The prefix form takes a comma list: dynamic a/1, b/2
+		if args == nil && rest != "" && (isLayout(rest[0]) || rest[0] == '(') {
+			return ""
+		}
+	}
+	if strings.TrimSpace(rest) != "" {
+		return "a directive must be a single declaration"
+	}
+
+	switch indicator := predicateIndicator(name, len(args)); indicator {
+	case "dynamic/1", "discontiguous/1", "table/1":
+		return ""
+	case "op/3":
+		for _, op := range operatorNames(args[2]) {
+			if slices.Contains(protectedOperators, op) {
+				return fmt.Sprintf("operator %s cannot be changed", op)
+			}
+		}
+		return ""
+	case "use_module/1", "use_module/2", "ensure_loaded/1":
+		lib, ok := libraryName(args[0])
+		if !ok {
+			return "only libraries can be loaded, as library(Name)"
+		}
+		if !slices.Contains(libs, lib) {
+			return fmt.Sprintf("library(%s) is not a permitted library", lib)
+		}
+		return ""
+	case "set_prolog_flag/2":
+		if flag := strings.TrimSpace(args[0]); flagValues[flag] == nil {
+			return fmt.Sprintf("flag %s cannot be set", flag)
+		}
+		return ""
+	default:
+		return fmt.Sprintf("%s is not an allowed directive", indicator)
+	}
+}
+
+// splitGoal splits a goal into its functor name, its top-level arguments
+// (nil without parentheses) and the text after it
+func splitGoal(s string) (name string, args []string, rest string, ok bool) {
+	i := 0
+	for i < len(s) && isAtomChar(s[i]) {
+		i++
+	}
+	name = s[:i]
+	if name == "" || !(s[0] >= 'a' && s[0] <= 'z') {
+		return "", nil, "", false
+	}
+	if i >= len(s) || s[i] != '(' {
+		return name, nil, s[i:], true
+	}
+
+	depth, start := 0, i+1
+	for j := i; j < len(s); j++ {
+		switch s[j] {
+		case '\'', '"', '`':
+			end := closingQuote(s, j)
+			if end < 0 {
+				return "", nil, "", false
+			}
+			j = end
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+			if depth == 0 {
+				args = append(args, strings.TrimSpace(s[start:j]))
+				return name, args, s[j+1:], true
+			}
+		case ',':
+			if depth == 1 {
+				args = append(args, strings.TrimSpace(s[start:j]))
+				start = j + 1
+			}
+		}
+	}
+	return "", nil, "", false
+}
+
+// operatorNames returns the names the third argument of op/3 defines: an
+// atom, possibly quoted or in parentheses, or a list of them
+func operatorNames(arg string) []string {
+	arg = strings.TrimSpace(arg)
+	for len(arg) > 1 && arg[0] == '(' && arg[len(arg)-1] == ')' {
+		arg = strings.TrimSpace(arg[1 : len(arg)-1])
+	}
+	if len(arg) > 2 && arg[0] == '[' && arg[len(arg)-1] == ']' {
+		if _, items, rest, ok := splitGoal("l(" + arg[1:len(arg)-1] + ")"); ok && rest == "" {
+			var names []string
+			for _, item := range items {
+				names = append(names, operatorNames(item)...)
+			}
+			return names
+		}
+	}
+	if len(arg) > 1 && arg[0] == '\'' && arg[len(arg)-1] == '\'' {
+		arg = strings.ReplaceAll(arg[1:len(arg)-1], "''", "'")
+		arg = strings.ReplaceAll(arg, `\\`, `\`)
+	}
+	return []string{arg}
+}
+
+// libraryName returns Name of library(Name), e.g. dcg/basics
+func libraryName(arg string) (string, bool) {
+	name, args, rest, ok := splitGoal(arg)
+	if !ok || name != "library" || len(args) != 1 || strings.TrimSpace(rest) != "" {
+		return "", false
+	}
+	return strings.ReplaceAll(args[0], " ", ""), true
+}
+
+// allowedLibraries returns the libraries directives may load
+func (e *Engine) allowedLibraries() []string {
+	if len(e.opts.AllowedLibraries) > 0 {
+		return e.opts.AllowedLibraries
+	}
+	return DefaultAllowedLibraries
+}
+
+// runDirectives runs directives new to the knowledge base once in a
+// scratch swipl, so a failing import or operator definition is reported by
+// the load instead of by every query. The caller must hold the mutex.
+func (e *Engine) runDirectives(directives []clause) error {
+	if len(directives) == 0 {
+		return nil
+	}
+
+	ctx, cancel := e.loadContext()
+	defer cancel()
+
+	file, err := e.createTempFile("directives.pl")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer e.removeTempFile(file)
+
+	// One directive per line, so messages map back by line
+	var src strings.Builder
+	starts := make([]int, len(directives))
+	line := 1
+	for i, d := range directives {
+		starts[i] = line
+		line += strings.Count(d.text, "\n") + 1
+		src.WriteString(d.text)
+		src.WriteByte('\n')
+	}
+	if err := os.WriteFile(file, []byte(src.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write directives: %w", err)
+	}
+
+	_, errs, runErr := e.compile(ctx, file, "")
+	if len(errs) > 0 {
+		msgs := mapMessages(errs, file, starts, directives)
+		texts := make([]string, len(msgs))
+		for i, m := range msgs {
+			texts[i] = m.Text
+		}
+		return fmt.Errorf("directives failed:\n%s", strings.Join(texts, "\n"))
+	}
+	if runErr != nil {
+		return fmt.Errorf("directives failed: %w", runErr)
+	}
+	return nil
+}
+
+// loadContext returns the context of the swipl runs of a load: bounded by
+// the query timeout, or loadTimeout, and cancelled by Close
+func (e *Engine) loadContext() (context.Context, context.CancelFunc) {
+	timeout := e.opts.QueryTimeout
+	if timeout <= 0 {
+		timeout = loadTimeout
+	}
+	return context.WithTimeout(e.ctx, timeout)
+}
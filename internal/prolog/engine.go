@@ -1,50 +1,217 @@
 package prolog
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/tomasz-sikora/logic-mcp/internal/metrics"
+	"github.com/tomasz-sikora/logic-mcp/internal/quota"
+	"github.com/tomasz-sikora/logic-mcp/internal/termjson"
 )
 
 // QueryResult represents the result of a Prolog query
 type QueryResult struct {
 	Success       bool             `json:"success"`
 	Solutions     []map[string]any `json:"solutions,omitempty"`
-	Output        string           `json:"output,omitempty"`
 	Error         string           `json:"error,omitempty"`
 	ExecutionTime time.Duration    `json:"execution_time"`
+	CPUTime       time.Duration    `json:"cpu_time"`
+	TimedOut      bool             `json:"timed_out,omitempty"`
+	// Variables are the named variables of the query, in order
+	Variables []string `json:"variables,omitempty"`
+	// MoreSolutions is set when Solutions stopped at the MaxSolutions limit
+	MoreSolutions bool `json:"more_solutions,omitempty"`
+	// Terms holds the bindings of each solution as terms, parallel to Solutions
+	Terms []map[string]termjson.Term `json:"terms,omitempty"`
+	// Stdout is what the query printed to standard output
+	Stdout string `json:"stdout,omitempty"`
+	// Stderr is what the query printed to user_error, without messages
+	Stderr string `json:"stderr,omitempty"`
+	// Warnings and Errors are the messages swipl printed while loading the
+	// knowledge base and running the query
+	Warnings []Message `json:"warnings,omitempty"`
+	Errors   []Message `json:"errors,omitempty"`
+
+	// rest is the result file without the variables and solutions, and
+	// program the clauses of the query file, starting on lines starts
+	rest    string
+	program []clause
+	starts  []int
+}
+
+// Output returns everything the query printed, without messages
+func (r *QueryResult) Output() string {
+	return r.Stdout + r.Stderr
+}
+
+// Sandbox levels
+const (
+	// SandboxNone executes queries and directives without restriction
+	SandboxNone = "none"
+	// SandboxRestricted rejects directives and only runs goals that
+	// library(sandbox) proves safe
+	SandboxRestricted = "restricted"
+)
+
+// EngineOptions configures a Prolog engine
+type EngineOptions struct {
+	// Sandbox is the sandbox level; empty means SandboxNone
+	Sandbox string
+	// MaxClauses limits the number of clauses in the knowledge base; zero means unlimited
+	MaxClauses int
+	// MaxBytes limits the total size of loaded clauses; zero means unlimited
+	MaxBytes int64
+	// QueryTimeout bounds every query; zero means only the caller's context applies
+	QueryTimeout time.Duration
+	// TempDir holds the generated Prolog files; empty means os.TempDir()
+	TempDir string
+	// Library is loaded read-only before the knowledge base of every query
+	Library *Library
+	// MaxSolutions caps the solutions collected per query; zero means DefaultMaxSolutions
+	MaxSolutions int
+	// AllowedLibraries are the libraries directives may load; empty means
+	// DefaultAllowedLibraries
+	AllowedLibraries []string
+	// Quotas admit every swipl run, queries and the scratch runs of loads,
+	// consults and syntax checks alike, and are charged its CPU time
+	Quotas []*quota.Tracker
 }
 
+// DefaultMaxSolutions is the solution cap when EngineOptions.MaxSolutions is zero
+const DefaultMaxSolutions = 100
+
+// solutionMarker starts the output lines carrying the bindings of a solution
+const solutionMarker = "__LOGIC_MCP_SOLUTION__"
+
+// termsMarker starts the line after each solution line carrying the same
+// bindings as tagged JSON
+const termsMarker = "__LOGIC_MCP_TERMS__"
+
+// variablesMarker starts the output line listing the named variables of
+// the query, as read by swipl
+const variablesMarker = "__LOGIC_MCP_VARIABLES__"
+
+// statusMarker starts the last line of the result file, which says whether
+// the query succeeded
+const statusMarker = "__LOGIC_MCP_STATUS__"
+
+// processWaitDelay bounds how long a finished swipl may keep its output
+// pipes open through processes it spawned
+const processWaitDelay = 2 * time.Second
+
 // Engine manages SWI-Prolog execution
 type Engine struct {
-	tempFiles []string
 	mutex     sync.Mutex
 	closed    bool
-	facts     []string // Store loaded facts
+	facts     []clause       // Store loaded facts
+	factBytes int64          // Total size of loaded facts
+	factKeys  map[string]int // clauseKey of loaded facts, with counts
+	loads     int            // Number of loads so far, for Source.Load
+	flags     map[string]string
+	operators []Operator
+	opts      EngineOptions
+
+	// constraints are the integrity constraints, as denials
+	constraints []clause
+	// declarations are the type and predicate declarations
+	declarations []*declaration
+
+	// tempFiles has its own lock because the queries of a batch create
+	// files concurrently
+	filesMu   sync.Mutex
+	tempFiles []string
+	tempSeq   int
+
+	// ctx is cancelled by Close to abort the running query
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 // NewEngine creates a new Prolog engine instance
 func NewEngine() (*Engine, error) {
+	return NewEngineWithOptions(EngineOptions{})
+}
+
+// NewEngineWithOptions creates a new Prolog engine instance with the given options
+func NewEngineWithOptions(opts EngineOptions) (*Engine, error) {
+	switch opts.Sandbox {
+	case "":
+		opts.Sandbox = SandboxNone
+	case SandboxNone, SandboxRestricted:
+	default:
+		return nil, fmt.Errorf("invalid sandbox level %q: use %s or %s", opts.Sandbox, SandboxNone, SandboxRestricted)
+	}
+	if opts.MaxSolutions <= 0 {
+		opts.MaxSolutions = DefaultMaxSolutions
+	}
+
 	// Check if SWI-Prolog is available
 	if _, err := exec.LookPath("swipl"); err != nil {
 		return nil, fmt.Errorf("SWI-Prolog not found: %w", err)
 	}
 
 	engine := &Engine{
-		facts: make([]string, 0),
+		facts:    make([]clause, 0),
+		factKeys: make(map[string]int),
+		opts:     opts,
 	}
+	engine.ctx, engine.cancel = context.WithCancel(context.Background())
+	metrics.SessionOpened()
 
 	return engine, nil
 }
 
 // Query executes a Prolog query and returns the result
 func (e *Engine) Query(ctx context.Context, query string) (*QueryResult, error) {
+	return e.QueryWithProgress(ctx, query, nil)
+}
+
+// QueryWithProgress executes a query like Query and, unless progress is nil,
+// calls it about once a second while the query runs. Cancelling ctx kills
+// swipl and everything it started.
+func (e *Engine) QueryWithProgress(ctx context.Context, query string, progress func(Progress)) (*QueryResult, error) {
+	startTime := time.Now()
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.closed {
+		return nil, fmt.Errorf("engine is closed")
+	}
+	// The caller may have given up while waiting for the previous query
+	if ctx.Err() != nil {
+		return &QueryResult{
+			Success:       false,
+			Error:         "query cancelled before it started",
+			ExecutionTime: time.Since(startTime),
+		}, nil
+	}
+
+	return e.query(ctx, e.facts, query, "", progress, startTime)
+}
+
+// QueryBatch runs queries against the current knowledge base, at most
+// concurrency of them at a time. The knowledge base cannot change while the
+// batch runs. Results are in the order of queries; a query not run because
+// ctx was cancelled reports so in its result. Every query is admitted by
+// the quotas; if one is refused, the queries not yet started are not run
+// and the refusal is returned with the results, which are nil for the
+// queries not run.
+func (e *Engine) QueryBatch(ctx context.Context, queries []string, concurrency int) ([]*QueryResult, error) {
 	startTime := time.Now()
 
 	e.mutex.Lock()
@@ -53,7 +220,69 @@ func (e *Engine) Query(ctx context.Context, query string) (*QueryResult, error)
 	if e.closed {
 		return nil, fmt.Errorf("engine is closed")
 	}
+	concurrency = e.parallelism(concurrency)
+
+	var (
+		refusedOnce sync.Once
+		refused     error
+		stopped     = make(chan struct{})
+	)
+	results := make([]*QueryResult, len(queries))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, query := range queries {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			select {
+			case <-stopped:
+				return
+			default:
+			}
+			if ctx.Err() != nil {
+				results[i] = &QueryResult{Success: false, Error: "query cancelled before it started"}
+				return
+			}
+			result, err := e.query(ctx, e.facts, query, "", nil, time.Now())
+			if err != nil {
+				refusedOnce.Do(func() {
+					refused = err
+					close(stopped)
+				})
+				return
+			}
+			results[i] = result
+		}()
+	}
+	wg.Wait()
 
+	slog.DebugContext(ctx, "query batch finished", "queries", len(queries), "concurrency", concurrency,
+		"duration", time.Since(startTime))
+	return results, refused
+}
+
+// parallelism caps n, the number of queries to run at once, at the
+// strictest concurrency quota, so that a batch is not refused by itself
+func (e *Engine) parallelism(n int) int {
+	for _, t := range e.opts.Quotas {
+		if t == nil {
+			continue
+		}
+		if limit := t.Limits().ConcurrentQueries; limit > 0 {
+			n = min(n, limit)
+		}
+	}
+	return max(n, 1)
+}
+
+// query runs one query against facts, usually the knowledge base. solve
+// defines logic_mcp_solve/4, which runs the goal and unifies its last
+// argument with whether it succeeded; empty collects its solutions. The run is admitted by the quotas and charged its CPU time;
+// the only error returned is their refusal. The caller must hold the mutex;
+// queries of one batch run concurrently.
+func (e *Engine) query(ctx context.Context, facts []clause, query, solve string, progress func(Progress), startTime time.Time) (*QueryResult, error) {
 	// Validate query
 	if strings.TrimSpace(query) == "" {
 		return &QueryResult{
@@ -63,101 +292,721 @@ func (e *Engine) Query(ctx context.Context, query string) (*QueryResult, error)
 		}, nil
 	}
 
+	release, err := e.admit()
+	if err != nil {
+		return nil, err
+	}
+
 	// Ensure query ends with a period
 	if !strings.HasSuffix(strings.TrimSpace(query), ".") {
 		query = strings.TrimSpace(query) + "."
 	}
 
+	if e.opts.QueryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.opts.QueryTimeout)
+		defer cancel()
+	}
+
+	// Closing the engine cancels the query as well
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(e.ctx, cancel)
+	defer stop()
+
 	// Execute query using batch mode
-	result, err := e.executeQueryBatch(ctx, query)
+	result, err := e.executeQueryBatch(ctx, facts, query, solve, progress)
 	if err != nil {
+		release(0)
 		return &QueryResult{
 			Success:       false,
 			Error:         err.Error(),
 			ExecutionTime: time.Since(startTime),
 		}, nil
 	}
+	release(result.CPUTime)
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		result.Success = false
+		result.TimedOut = true
+		result.Error = fmt.Sprintf("query timed out after %s", time.Since(startTime).Round(time.Millisecond))
+	} else if e.ctx.Err() != nil {
+		result.Success = false
+		result.Error = "query cancelled: engine is shutting down"
+	} else if ctx.Err() != nil {
+		result.Success = false
+		result.Error = "query cancelled"
+	}
 
 	result.ExecutionTime = time.Since(startTime)
 	return result, nil
 }
 
-// executeQueryBatch executes a query in batch mode
-func (e *Engine) executeQueryBatch(ctx context.Context, query string) (*QueryResult, error) {
-	// Create temporary file for the query
+// executeQueryBatch executes a query in batch mode. The driver writes the
+// variables, solutions and outcome to a private result file, so nothing the
+// query prints can be mistaken for a result. The file is opened before the
+// program is loaded and handed to logic_mcp_main/1 as a stream, so no
+// clause names it, and the outcome is read only from the line
+// logic_mcp_main/1 writes last.
+func (e *Engine) executeQueryBatch(ctx context.Context, facts []clause, query, solve string, progress func(Progress)) (*QueryResult, error) {
+	// Create temporary files for the program and its results
 	tempFile, err := e.createTempFile("query.pl")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create temp file: %w", err)
 	}
-	defer os.Remove(tempFile)
+	defer e.removeTempFile(tempFile)
+	resultFile, err := e.createTempFile("result.txt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer e.removeTempFile(resultFile)
 
 	// Write facts and query to file
-	content := strings.Join(e.facts, "\n")
-	if content != "" {
-		content += "\n"
+	content := ""
+	if e.opts.Sandbox == SandboxRestricted {
+		content = ":- use_module(library(sandbox)).\n"
+	}
+	if progress != nil {
+		content += ":- use_module(library(time)).\n"
+	}
+	if e.opts.Library != nil {
+		content += e.opts.Library.loadDirective()
+	}
+	content += operatorSource
+	content += e.settingsSource()
+
+	// Remember the line each clause starts on to map messages back to it.
+	// Clauses keep their load order, so a directive such as op/3 or
+	// set_prolog_flag/2 affects only the clauses loaded after it.
+	program := facts
+	line := strings.Count(content, "\n") + 1
+	var kb strings.Builder
+	starts := make([]int, len(program))
+	for i, fact := range program {
+		starts[i] = line
+		line += strings.Count(fact.text, "\n") + 1
+		kb.WriteString(fact.text)
+		kb.WriteByte('\n')
+	}
+	content += kb.String()
+	content += restoreSyntax
+
+	// In restricted mode the goal must pass safe_goal/1 before it runs
+	check := ""
+	if e.opts.Sandbox == SandboxRestricted {
+		check = `
+    catch(safe_goal(user:Goal), SandboxError,
+          ( print_message(error, SandboxError), halt(1) )),`
+	}
+
+	// Progress is printed by an alarm that re-arms itself
+	startProgress := ""
+	if progress != nil {
+		content += progressSource
+		startProgress = fmt.Sprintf("\n    alarm(%g, logic_mcp_progress, _, [remove(true)]),", progressInterval.Seconds())
+	}
+
+	// By default solutions are written on marker lines, at most
+	// MaxSolutions plus one to detect that there are more; a query without
+	// variables is proven once.
+	if solve == "" {
+		solve = fmt.Sprintf(`
+logic_mcp_solve(Out, Goal, Bindings, Success) :-
+    (   Bindings == [] -> Limit = 1 ; Limit = %d ),
+    (   limit(Limit, Goal),
+        logic_mcp_solution(Out, Bindings),
+        fail
+    ;   true
+    ),
+    nb_getval(logic_mcp_solutions, Count),
+    (   Count > 0 -> Success = true ; Success = false ).
+`, e.opts.MaxSolutions+1)
 	}
 
-	// Create a goal that will test the query and print result
+	// The query is data: the driver reads it as exactly one term, so it
+	// cannot close the driver clause or add clauses of its own
 	testGoal := fmt.Sprintf(`
-main :-
-    (   (%s) ->
-        write('SUCCESS: true')
-    ;   write('SUCCESS: false')
+logic_mcp_query_text(%s).
+
+logic_mcp_query(Goal, Bindings) :-
+    logic_mcp_query_text(Text),
+    catch(( open_string(Text, In),
+            read_term(In, Goal, [variable_names(Names)]),
+            read_term(In, Next, [])
+          ), Error,
+          ( print_message(error, Error), halt(1) )),
+    (   Goal == end_of_file ->
+        logic_mcp_reject('the query is empty')
+    ;   Next \== end_of_file ->
+        logic_mcp_reject('the query must be exactly one goal')
+    ;   \+ callable(Goal) ->
+        logic_mcp_reject('the query is not a callable goal')
+    ;   true
     ),
-    nl,
+    exclude(logic_mcp_hidden, Names, Bindings).
+
+logic_mcp_reject(Message) :-
+    format(user_error, "ERROR: ~w~n", [Message]),
+    halt(1).
+
+logic_mcp_hidden(Name=_) :-
+    sub_atom(Name, 0, 1, _, '_').
+
+logic_mcp_solution(Out, Bindings) :-
+    nb_getval(logic_mcp_solutions, N0),
+    N is N0 + 1,
+    nb_setval(logic_mcp_solutions, N),
+    format(Out, "~w", [%s]),
+    forall(member(Name=Value, Bindings), format(Out, "\t~w=~q", [Name, Value])),
+    nl(Out),
+    with_output_to(string(Terms), logic_mcp_json_bindings(Bindings)),
+    format(Out, "~w~w~n", [%s, Terms]),
+    flush_output(Out).
+%s
+
+logic_mcp_main(Out) :-
+    nb_setval(logic_mcp_solutions, 0),
+    logic_mcp_settings,
+    logic_mcp_user_operators,
+    logic_mcp_query(Goal, Bindings),%s%s
+    format(Out, "~w", [%s]),
+    forall(member(Name=_, Bindings), format(Out, "\t~w", [Name])),
+    nl(Out),
+    logic_mcp_solve(Out, Goal, Bindings, Success),
+    format(Out, "~w\t~w~n", [%s, Success]),
+    close(Out),
     halt.
-`, strings.TrimSuffix(query, "."))
+%s`, quoteAtom(query), quoteAtom(solutionMarker), quoteAtom(termsMarker), termjson.PrologSource,
+		check, startProgress, quoteAtom(variablesMarker), quoteAtom(statusMarker), solve)
 
 	content += testGoal
 
 	if err := ioutil.WriteFile(tempFile, []byte(content), 0644); err != nil {
 		return nil, fmt.Errorf("failed to write query file: %w", err)
 	}
+	metrics.TempFileCreated()
+	if err := ioutil.WriteFile(resultFile, nil, 0600); err != nil {
+		return nil, fmt.Errorf("failed to create result file: %w", err)
+	}
+	metrics.TempFileCreated()
 
 	// Execute SWI-Prolog with the file
-	cmd := exec.CommandContext(ctx, "swipl", "-q", "-g", "main", "-t", "halt", tempFile)
+	goal := fmt.Sprintf("open(%s, write, Out, [encoding(utf8)]), load_files(%s, []), logic_mcp_main(Out)",
+		quoteAtom(resultFile), quoteAtom(tempFile))
+	cmd := exec.CommandContext(ctx, "swipl", "-q", "-g", goal, "-t", "halt")
+	setProcessGroup(cmd)
+	cmd.WaitDelay = processWaitDelay
 
-	output, err := cmd.CombinedOutput()
+	var stdout bytes.Buffer
+	stderr := &outputWriter{start: time.Now(), progress: progress, limit: e.opts.MaxSolutions}
+	cmd.Stdout = &stdout
+	cmd.Stderr = stderr
+	err = cmd.Run()
+	// Reap anything swipl left running in its process group
+	if kerr := killProcessGroup(cmd); kerr != nil {
+		slog.WarnContext(ctx, "failed to kill swipl process group", "pid", cmd.Process.Pid, "error", kerr)
+	}
+	var cpuTime time.Duration
+	if cmd.ProcessState != nil {
+		cpuTime = cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime()
+	}
+	if cmd.Process != nil {
+		metrics.SwiplSpawned()
+		slog.DebugContext(ctx, "swipl finished", "pid", cmd.Process.Pid, "file", tempFile, "error", err)
+	}
+	if cmd.ProcessState != nil && !cmd.ProcessState.Exited() {
+		metrics.SwiplKilled()
+		slog.WarnContext(ctx, "swipl terminated by signal", "pid", cmd.Process.Pid, "state", cmd.ProcessState.String())
+	}
+
+	text, warnings, errs := splitMessages(string(stderr.Bytes()))
+	result := &QueryResult{
+		Stdout:   stdout.String(),
+		Stderr:   text,
+		Warnings: mapMessages(warnings, tempFile, starts, program),
+		Errors:   mapMessages(errs, tempFile, starts, program),
+		CPUTime:  cpuTime,
+		program:  program,
+		starts:   starts,
+	}
 	if err != nil {
-		return &QueryResult{
-			Success: false,
-			Output:  string(output),
-			Error:   fmt.Sprintf("execution failed: %v", err),
-		}, nil
+		result.Error = fmt.Sprintf("execution failed: %v", err)
+		if len(result.Errors) > 0 {
+			result.Error += ": " + result.Errors[0].Text
+		}
+		return result, nil
 	}
 
-	// Parse output
-	outputStr := string(output)
-	success := strings.Contains(outputStr, "SUCCESS: true")
+	// Parse the results; a goal that halted itself leaves no outcome
+	data, err := os.ReadFile(resultFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read query results: %w", err)
+	}
+	rest, success := parseStatus(string(data))
+	rest, vars := parseVariables(rest)
+	rest, solutions, terms := parseSolutions(rest)
+	result.Success = success
+	result.rest = rest
+	result.Variables = vars
+	if len(vars) > 0 {
+		if len(solutions) > e.opts.MaxSolutions {
+			solutions = solutions[:e.opts.MaxSolutions]
+			if terms != nil {
+				terms = terms[:e.opts.MaxSolutions]
+			}
+			result.MoreSolutions = true
+		}
+		result.Solutions = solutions
+		result.Terms = terms
+	}
+	return result, nil
+}
+
+// parseStatus removes the status line logic_mcp_main/1 writes last and
+// returns whether it reports success. Output that does not end with one,
+// as left by a goal that halted, did not succeed, whatever it contains.
+func parseStatus(output string) (string, bool) {
+	body := strings.TrimSuffix(output, "\n")
+	i := strings.LastIndexByte(body, '\n')
+	switch body[i+1:] {
+	case statusMarker + "\ttrue":
+		return body[:i+1], true
+	case statusMarker + "\tfalse":
+		return body[:i+1], false
+	}
+	return output, false
+}
+
+// parseVariables removes the variables marker line from the output and
+// returns the variable names it lists
+func parseVariables(output string) (string, []string) {
+	var rest strings.Builder
+	var vars []string
+	for _, line := range strings.SplitAfter(output, "\n") {
+		names, ok := strings.CutPrefix(strings.TrimRight(line, "\n"), variablesMarker)
+		if !ok {
+			rest.WriteString(line)
+			continue
+		}
+		for _, name := range strings.Split(names, "\t") {
+			if name != "" {
+				vars = append(vars, name)
+			}
+		}
+	}
+	return rest.String(), vars
+}
+
+// parseSolutions removes the solution marker lines from the output and
+// returns the bindings they carry, as text and as terms. Terms is nil if
+// any solution lacks a valid terms line.
+func parseSolutions(output string) (string, []map[string]any, []map[string]termjson.Term) {
+	var rest strings.Builder
+	var solutions []map[string]any
+	var terms []map[string]termjson.Term
+	termsValid := true
+	for _, line := range strings.SplitAfter(output, "\n") {
+		if data, ok := strings.CutPrefix(strings.TrimRight(line, "\n"), termsMarker); ok {
+			bindings, err := decodeBindings(data)
+			if err != nil || len(terms) != len(solutions)-1 {
+				termsValid = false
+				continue
+			}
+			terms = append(terms, bindings)
+			continue
+		}
+		fields, ok := strings.CutPrefix(strings.TrimRight(line, "\n"), solutionMarker)
+		if !ok {
+			rest.WriteString(line)
+			continue
+		}
 
-	return &QueryResult{
-		Success: success,
-		Output:  outputStr,
-	}, nil
+		solution := make(map[string]any)
+		for _, field := range strings.Split(fields, "\t") {
+			if name, value, ok := strings.Cut(field, "="); ok {
+				solution[name] = value
+			}
+		}
+		solutions = append(solutions, solution)
+	}
+	if !termsValid || len(terms) != len(solutions) {
+		terms = nil
+	}
+	return rest.String(), solutions, terms
 }
 
-// LoadFacts loads Prolog facts and rules into the knowledge base
+// decodeBindings decodes a JSON object of variable names to tagged terms
+func decodeBindings(data string) (map[string]termjson.Term, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(data), &raw); err != nil {
+		return nil, err
+	}
+	bindings := make(map[string]termjson.Term, len(raw))
+	for name, r := range raw {
+		t, err := termjson.Decode(r)
+		if err != nil {
+			return nil, fmt.Errorf("binding %s: %w", name, err)
+		}
+		bindings[name] = t
+	}
+	return bindings, nil
+}
+
+// Load modes
+const (
+	// LoadAppend adds the clauses that are not loaded yet
+	LoadAppend = "append"
+	// LoadReplace makes the given clauses the only clauses of their
+	// predicates, removing the other clauses of those predicates
+	LoadReplace = "replace"
+)
+
+// LoadOptions configures LoadFactsWithOptions
+type LoadOptions struct {
+	// Mode is LoadAppend or LoadReplace; empty means LoadAppend
+	Mode string
+	// Provenance is recorded with the added clauses; a zero Time means now
+	Provenance Provenance
+	// RejectViolations rejects the load with a *ConsistencyError if it
+	// introduces violations of the integrity constraints
+	RejectViolations bool
+}
+
+// LoadResult reports how a load changed the knowledge base
+type LoadResult struct {
+	// Added is the number of clauses added
+	Added int `json:"added"`
+	// Skipped is the number of clauses already loaded, or given twice
+	Skipped int `json:"skipped"`
+	// Replaced is the number of clauses removed in replace mode
+	Replaced int `json:"replaced"`
+	// Hash is the KnowledgeBaseHash after the load
+	Hash string `json:"hash"`
+	// Load is the number of this load, as used in Source
+	Load int `json:"load"`
+	// Declared is the number of type and predicate declarations given
+	Declared int `json:"declared"`
+}
+
+// LoadFacts loads Prolog facts and rules into the knowledge base. Clauses
+// already loaded are skipped, so loading the same facts twice is harmless.
 func (e *Engine) LoadFacts(facts string) error {
+	_, err := e.LoadFactsWithOptions(facts, LoadOptions{})
+	return err
+}
+
+// LoadFactsWithOptions loads facts and rules like LoadFacts in the given
+// mode. Clauses are compared by clauseKey, so layout and variable names do
+// not make a clause new.
+func (e *Engine) LoadFactsWithOptions(facts string, opts LoadOptions) (*LoadResult, error) {
 	e.mutex.Lock()
 	defer e.mutex.Unlock()
 
 	if e.closed {
-		return fmt.Errorf("engine is closed")
+		return nil, fmt.Errorf("engine is closed")
+	}
+	return e.load(parseLines(facts, Source{}, nil), opts)
+}
+
+// load adds clauses to the knowledge base as the next load, in the mode
+// and with the provenance of opts. It is the pipeline of every load: the
+// clauses are checked, matched against the declarations and deduplicated,
+// the result is checked for violations if asked, new directives are run and
+// the load is numbered. The caller must hold the mutex.
+func (e *Engine) load(clauses []clause, opts LoadOptions) (*LoadResult, error) {
+	switch opts.Mode {
+	case "", LoadAppend, LoadReplace:
+	default:
+		return nil, fmt.Errorf("invalid load mode %q: use %s or %s", opts.Mode, LoadAppend, LoadReplace)
+	}
+
+	// The load is numbered once it is accepted, so a rejected load does
+	// not use up a number; until then messages give lines alone
+	prov := newProvenance(opts.Provenance)
+	for i := range clauses {
+		clauses[i].provenance = prov
+	}
+
+	parsed, decls, err := splitDeclarations(clauses)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.checkClauses(parsed); err != nil {
+		return nil, err
 	}
 
-	// Parse facts line by line
+	// In replace mode every predicate given is replaced as a whole
+	replacing := make(map[string]bool)
+	if opts.Mode == LoadReplace {
+		for _, c := range parsed {
+			if head, ok := clauseHead(c.text); ok {
+				replacing[head] = true
+			}
+		}
+	}
+
+	// Clauses must match the declarations; new declarations must also
+	// match the clauses already loaded
+	declarations := mergeDeclarations(e.declarations, decls)
+	if err := checkTypeNames(decls, declarations); err != nil {
+		return nil, err
+	}
+	mismatches := checkDeclared(parsed, declarations)
+	if len(decls) > 0 {
+		loaded := slices.DeleteFunc(slices.Clone(e.facts), func(c clause) bool {
+			head, ok := clauseHead(c.text)
+			return ok && replacing[head]
+		})
+		mismatches = append(checkDeclared(loaded, declarations), mismatches...)
+	}
+	if len(mismatches) > 0 {
+		return nil, &DeclarationError{Mismatches: mismatches}
+	}
+
+	result := &LoadResult{Declared: len(decls)}
+	given := make(map[string]bool)
+	var add, directives []clause
+	for _, c := range parsed {
+		key := clauseKey(c.text)
+		if given[key] {
+			result.Skipped++
+			continue
+		}
+		given[key] = true
+		if e.factKeys[key] > 0 {
+			result.Skipped++
+			head, ok := clauseHead(c.text)
+			if !ok || !replacing[head] {
+				continue
+			}
+			// Removed with its predicate below and added back in order
+		} else {
+			result.Added++
+			if isDirective(c.text) {
+				directives = append(directives, c)
+			}
+		}
+		add = append(add, c)
+	}
+
+	var kept []clause
+	if len(replacing) > 0 {
+		kept = make([]clause, 0, len(e.facts))
+		for _, c := range e.facts {
+			if head, ok := clauseHead(c.text); ok && replacing[head] {
+				if !given[clauseKey(c.text)] {
+					result.Replaced++
+				}
+				continue
+			}
+			kept = append(kept, c)
+		}
+	}
+
+	if opts.RejectViolations && len(e.constraints) > 0 {
+		next := append(slices.Clone(e.facts), add...)
+		if len(replacing) > 0 {
+			next = append(slices.Clone(kept), add...)
+		}
+		if err := e.checkViolations(next); err != nil {
+			return nil, err
+		}
+	}
+
+	// New directives run last, so a load rejected anyway does not run them
+	if err := e.runDirectives(directives); err != nil {
+		return nil, err
+	}
+
+	load := e.loads + 1
+	for i := range add {
+		add[i].source.Load = load
+	}
+	for _, d := range decls {
+		d.source.Load = load
+	}
+	if len(replacing) == 0 {
+		if err := e.addClauses(add); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := e.setClauses(append(kept, add...)); err != nil {
+			return nil, err
+		}
+	}
+
+	e.loads = load
+	result.Load = load
+	e.declarations = declarations
+	result.Hash = e.knowledgeBaseHash()
+	return result, nil
+}
+
+// parseLines parses facts and rules given one per line, as LoadFacts takes
+// them. A line holding several clauses, such as "a. b.", is split so each
+// is checked on its own. Clauses get source with their line and column.
+func parseLines(facts string, source Source, prov *Provenance) []clause {
+	var parsed []clause
 	lines := strings.Split(facts, "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line != "" && !strings.HasPrefix(line, "%") {
-			// Ensure line ends with period
-			if !strings.HasSuffix(line, ".") {
-				line += "."
+	for i, line := range lines {
+		for _, c := range splitClausesAt(line) {
+			// The period may be left out at the end of the line
+			text := c.text
+			if !strings.HasSuffix(text, ".") {
+				text += "."
+			}
+			source.Line, source.Column = i+1, c.column
+			parsed = append(parsed, clause{text: text, source: source, provenance: prov})
+		}
+	}
+	return parsed
+}
+
+// newProvenance returns the shared provenance of the clauses of one load
+func newProvenance(p Provenance) *Provenance {
+	if p.Time.IsZero() {
+		p.Time = time.Now()
+	}
+	p.Tags = slices.Clone(p.Tags)
+	return &p
+}
+
+// hookPredicates are the predicates swipl calls while it loads or runs
+// code, outside of library(sandbox)
+var hookPredicates = []string{
+	"term_expansion", "goal_expansion", "message_hook", "prolog_load_file",
+	"exception", "portray", "prolog_exception_hook", "message_property",
+}
+
+// checkClauses rejects clauses the sandbox or the preload library forbid.
+// Directives outside the allowlist are reported together.
+func (e *Engine) checkClauses(clauses []clause) error {
+	var rejected []RejectedDirective
+	for _, c := range clauses {
+		if e.opts.Sandbox == SandboxRestricted {
+			if err := checkRestricted(c); err != nil {
+				return fmt.Errorf("%s: %w in the %s sandbox: %s", c.source, err, e.opts.Sandbox, c.text)
+			}
+		}
+		if isDirective(c.text) {
+			if reason := checkDirective(c.text, e.allowedLibraries()); reason != "" {
+				rejected = append(rejected, RejectedDirective{Directive: c.text, Source: c.source, Reason: reason})
 			}
-			e.facts = append(e.facts, line)
 		}
+		if head, ok := clauseHead(c.text); ok && e.opts.Library != nil && e.opts.Library.Defines(head) {
+			return fmt.Errorf("%s: cannot redefine %s: it is defined by the preload library", c.source, head)
+		}
+	}
+	if len(rejected) > 0 {
+		return &DirectiveError{Rejected: rejected}
 	}
+	return nil
+}
 
+// checkRestricted returns why the restricted sandbox forbids a clause:
+// directives, and clauses of hook predicates or of other modules, which
+// swipl would run while loading the knowledge base
+func checkRestricted(c clause) error {
+	if isDirective(c.text) {
+		return fmt.Errorf("directives are not allowed")
+	}
+	text := strings.TrimSpace(c.text)
+	if strings.HasPrefix(text, "(") {
+		return fmt.Errorf("parenthesised clauses are not allowed")
+	}
+	if module, ok := headModule(text); ok {
+		return fmt.Errorf("clauses of module %s are not allowed", module)
+	}
+	if head, ok := clauseHead(text); ok {
+		name, _, _ := strings.Cut(head, "/")
+		if slices.Contains(hookPredicates, name) {
+			return fmt.Errorf("clauses of the hook %s are not allowed", name)
+		}
+	}
+	return nil
+}
+
+// headModule returns Module of a clause whose head is qualified, as in
+// "Module:Head :- Body."
+func headModule(text string) (string, bool) {
+	i := 0
+	if text != "" && text[0] == '\'' {
+		i = closingQuote(text, 0) + 1
+		if i == 0 {
+			return "", false
+		}
+	} else {
+		for i < len(text) && isAtomChar(text[i]) {
+			i++
+		}
+	}
+	module := text[:i]
+	for i < len(text) && isLayout(text[i]) {
+		i++
+	}
+	if module == "" || i >= len(text) || text[i] != ':' || strings.HasPrefix(text[i:], ":-") {
+		return "", false
+	}
+	return module, true
+}
+
+// addClauses appends clauses to the knowledge base within the size quotas.
+// The caller must hold the mutex.
+func (e *Engine) addClauses(clauses []clause) error {
+	var size int64
+	for _, c := range clauses {
+		size += int64(len(c.text))
+	}
+
+	if err := e.checkSize(len(e.facts)+len(clauses), e.factBytes+size); err != nil {
+		return err
+	}
+	e.facts = append(e.facts, clauses...)
+	e.factBytes += size
+	for _, c := range clauses {
+		e.factKeys[clauseKey(c.text)]++
+	}
+	metrics.ObserveKBSize(len(e.facts))
+
+	return nil
+}
+
+// setClauses replaces the knowledge base within the size quotas. The caller
+// must hold the mutex.
+func (e *Engine) setClauses(clauses []clause) error {
+	var size int64
+	for _, c := range clauses {
+		size += int64(len(c.text))
+	}
+
+	if err := e.checkSize(len(clauses), size); err != nil {
+		return err
+	}
+	e.facts = clauses
+	e.factBytes = size
+	e.factKeys = make(map[string]int, len(clauses))
+	for _, c := range clauses {
+		e.factKeys[clauseKey(c.text)]++
+	}
+	metrics.ObserveKBSize(len(e.facts))
+
+	return nil
+}
+
+// admit admits one swipl run against the quotas. release must be called
+// when it finishes, with the CPU time it used.
+func (e *Engine) admit() (release func(cpu time.Duration), err error) {
+	return quota.AcquireAll(e.opts.Quotas...)
+}
+
+// checkSize checks a knowledge base size against the size quotas
+func (e *Engine) checkSize(clauses int, size int64) error {
+	if e.opts.MaxClauses > 0 && clauses > e.opts.MaxClauses {
+		return &quota.ExceededError{Quota: quota.MaxClauses, Scope: "session", Limit: float64(e.opts.MaxClauses)}
+	}
+	if e.opts.MaxBytes > 0 && size > e.opts.MaxBytes {
+		return &quota.ExceededError{Quota: quota.MaxBytes, Scope: "session", Limit: float64(e.opts.MaxBytes)}
+	}
 	return nil
 }
 
@@ -205,7 +1054,8 @@ func (e *Engine) validateBalanced(s string, open, close rune) error {
 	return nil
 }
 
-// ClearKnowledgeBase clears all loaded facts and rules
+// ClearKnowledgeBase clears all loaded facts and rules, the integrity
+// constraints and the declarations
 func (e *Engine) ClearKnowledgeBase() error {
 	e.mutex.Lock()
 	defer e.mutex.Unlock()
@@ -214,12 +1064,30 @@ func (e *Engine) ClearKnowledgeBase() error {
 		return fmt.Errorf("engine is closed")
 	}
 
-	e.facts = make([]string, 0)
+	e.facts = make([]clause, 0)
+	e.factBytes = 0
+	e.factKeys = make(map[string]int)
+	e.constraints = nil
+	e.declarations = nil
+	metrics.ObserveKBSize(0)
 	return nil
 }
 
-// Close cleans up the engine resources
+// Close cancels the running query, if any, and cleans up the engine resources
 func (e *Engine) Close() error {
+	e.cancel()
+	return e.close()
+}
+
+// Shutdown closes the engine after its running query finishes. If ctx is
+// done first, the query is cancelled.
+func (e *Engine) Shutdown(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, e.cancel)
+	defer stop()
+	return e.close()
+}
+
+func (e *Engine) close() error {
 	e.mutex.Lock()
 	defer e.mutex.Unlock()
 
@@ -228,30 +1096,79 @@ func (e *Engine) Close() error {
 	}
 
 	// Clean up temporary files
-	for _, file := range e.tempFiles {
-		os.Remove(file)
-	}
+	e.filesMu.Lock()
+	files := e.tempFiles
 	e.tempFiles = nil
+	e.filesMu.Unlock()
+	for _, file := range files {
+		if err := os.Remove(file); err == nil {
+			metrics.TempFileRemoved()
+		}
+	}
 
 	e.closed = true
+	e.cancel()
+	metrics.SessionClosed()
 	return nil
 }
 
 // createTempFile creates a temporary file with the given name
 func (e *Engine) createTempFile(name string) (string, error) {
-	tempDir := os.TempDir()
-	tempFile := filepath.Join(tempDir, fmt.Sprintf("logic_mcp_%d_%s", time.Now().UnixNano(), name))
+	tempDir := e.opts.TempDir
+	if tempDir == "" {
+		tempDir = os.TempDir()
+	}
+
+	e.filesMu.Lock()
+	defer e.filesMu.Unlock()
+	e.tempSeq++
+	tempFile := filepath.Join(tempDir, fmt.Sprintf("logic_mcp_%d_%d_%s", time.Now().UnixNano(), e.tempSeq, name))
 
 	e.tempFiles = append(e.tempFiles, tempFile)
 	return tempFile, nil
 }
 
+// removeTempFile deletes a temporary file and forgets about it
+func (e *Engine) removeTempFile(file string) {
+	if err := os.Remove(file); err == nil {
+		metrics.TempFileRemoved()
+	}
+	e.filesMu.Lock()
+	defer e.filesMu.Unlock()
+	for i, f := range e.tempFiles {
+		if f == file {
+			e.tempFiles = append(e.tempFiles[:i], e.tempFiles[i+1:]...)
+			break
+		}
+	}
+}
+
 // GetLoadedFacts returns currently loaded facts (for debugging)
 func (e *Engine) GetLoadedFacts() []string {
 	e.mutex.Lock()
 	defer e.mutex.Unlock()
 
 	result := make([]string, len(e.facts))
-	copy(result, e.facts)
+	for i, c := range e.facts {
+		result[i] = c.text
+	}
 	return result
 }
+
+// KnowledgeBaseHash returns a SHA-256 digest of the loaded facts and rules
+func (e *Engine) KnowledgeBaseHash() string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.knowledgeBaseHash()
+}
+
+// knowledgeBaseHash returns the hash of the knowledge base. The caller must
+// hold the mutex.
+func (e *Engine) knowledgeBaseHash() string {
+	h := sha256.New()
+	for _, fact := range e.facts {
+		h.Write([]byte(fact.text))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
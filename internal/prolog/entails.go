@@ -0,0 +1,322 @@
+package prolog
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Verdicts of Entails
+const (
+	// VerdictProvable means the goal has a proof
+	VerdictProvable = "provable"
+	// VerdictUnprovable means the goal has no proof: it is false under the
+	// closed-world assumption
+	VerdictUnprovable = "unprovable"
+	// VerdictUndetermined means no answer was found within the resource
+	// limits, or the goal raised an error
+	VerdictUndetermined = "undetermined"
+)
+
+// Entailment limits when EntailOptions leaves them zero
+const (
+	DefaultMaxInferences = 10_000_000
+	DefaultMaxDepth      = 100
+)
+
+// maxProofSteps and maxFrontier bound the explanation of an entailment
+const (
+	maxProofSteps = 500
+	maxFrontier   = 50
+)
+
+// Markers of the result file lines written by the entailment driver
+const (
+	verdictMarker  = "__LOGIC_MCP_VERDICT__"
+	proofMarker    = "__LOGIC_MCP_PROOF__"
+	frontierMarker = "__LOGIC_MCP_FRONTIER__"
+)
+
+// EntailOptions bounds an entailment check
+type EntailOptions struct {
+	// MaxInferences bounds the proof search; zero means DefaultMaxInferences
+	MaxInferences int64
+	// MaxDepth bounds the depth of proofs and of the failure search; zero
+	// means DefaultMaxDepth
+	MaxDepth int
+}
+
+// ProofStep is a goal of a proof. Steps are listed depth first; the steps
+// proving a goal follow it one level deeper.
+type ProofStep struct {
+	Depth int    `json:"depth"`
+	Goal  string `json:"goal"`
+	// Kind is clause, builtin or negation (a goal proven by failing to
+	// prove its argument)
+	Kind string `json:"kind"`
+	// Clause and Source are the knowledge base clause used, if known
+	Clause string  `json:"clause,omitempty"`
+	Source *Source `json:"source,omitempty"`
+}
+
+// FrontierGoal is a goal where the search for a proof failed
+type FrontierGoal struct {
+	Goal   string `json:"goal"`
+	Reason string `json:"reason"`
+}
+
+// Entailment is the outcome of Entails
+type Entailment struct {
+	Verdict string
+	// Reason explains an undetermined verdict
+	Reason string
+	// Variables and Bindings are those of the first proof
+	Variables []string
+	Bindings  map[string]any
+	// Proof is a proof of a provable goal; it may be missing when the proof
+	// could not be rebuilt within the limits
+	Proof          []ProofStep
+	ProofTruncated bool
+	// Frontier holds the goals that failed in the search for a proof of an
+	// unprovable goal
+	Frontier []FrontierGoal
+	// Result is the underlying query result, with timings and messages
+	Result *QueryResult
+}
+
+// Entails decides whether goal follows from the knowledge base. A goal is
+// provable if it has a proof, which is returned; unprovable if it has none,
+// in which case the goals where the search failed are returned; and
+// undetermined if the limits were reached or the goal raised an error.
+// Existence errors count as failure, under the closed-world assumption.
+func (e *Engine) Entails(ctx context.Context, goal string, opts EntailOptions) (*Entailment, error) {
+	startTime := time.Now()
+	if opts.MaxInferences <= 0 {
+		opts.MaxInferences = DefaultMaxInferences
+	}
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = DefaultMaxDepth
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.closed {
+		return nil, fmt.Errorf("engine is closed")
+	}
+	if ctx.Err() != nil {
+		return &Entailment{Verdict: VerdictUndetermined, Reason: "cancelled before it started",
+			Result: &QueryResult{Error: "query cancelled before it started", ExecutionTime: time.Since(startTime)}}, nil
+	}
+
+	result, err := e.query(ctx, e.facts, goal, entailSource(opts), nil, startTime)
+	if err != nil {
+		return nil, err
+	}
+	return parseEntailment(result), nil
+}
+
+// entailSource defines logic_mcp_solve/4 for Entails. The verdict comes
+// from running the goal itself; the meta-interpreter of proveSource then
+// rebuilds the proof of the first solution, or searches for a proof once
+// more and records the goals that fail. That it ignores cuts only affects
+// the explanation.
+func entailSource(opts EntailOptions) string {
+	return fmt.Sprintf(`
+logic_mcp_solve(Out, Goal, Bindings, Success) :-
+    copy_term(Goal, Fresh),
+    (   catch(call_with_inference_limit(Goal, %[1]d, Result), Error, Result = error(Error))
+    ->  true
+    ;   Result = failed
+    ),
+    logic_mcp_verdict(Result, Out, Goal, Fresh, Bindings),
+    (   memberchk(Result, [true, !]) -> Success = true ; Success = false ).
+
+logic_mcp_verdict(inference_limit_exceeded, Out, _, _, _) :- !,
+    format(Out, "~w\tundetermined\tinference limit of ~d exceeded~n", [%[3]s, %[1]d]).
+logic_mcp_verdict(failed, Out, _, Fresh, _) :- !,
+    format(Out, "~w\tunprovable\t~n", [%[3]s]),
+    logic_mcp_frontier(Out, Fresh).
+logic_mcp_verdict(error(error(existence_error(procedure, PI), _)), Out, _, _, _) :- !,
+    format(Out, "~w\tunprovable\t~n", [%[3]s]),
+    format(Out, "~w\t~q\tunknown predicate~n", [%[5]s, PI]).
+logic_mcp_verdict(error(Error), Out, _, _, _) :- !,
+    print_message(error, Error),
+    format(Out, "~w\tundetermined\tthe goal raised an error~n", [%[3]s]).
+logic_mcp_verdict(_, Out, Goal, _, Bindings) :-
+    logic_mcp_solution(Out, Bindings),
+    format(Out, "~w\tprovable\t~n", [%[3]s]),
+    (   catch(call_with_inference_limit(once(logic_mcp_prove(Goal, %[2]d, Proof)), %[1]d, R), _, fail),
+        R \== inference_limit_exceeded
+    ->  logic_mcp_write_proof(Out, Proof, 0)
+    ;   true
+    ).
+
+logic_mcp_frontier(Out, Goal) :-
+    nb_setval(logic_mcp_recording, true),
+    catch(call_with_inference_limit(\+ logic_mcp_prove(Goal, %[2]d, _), %[1]d, _), _, true),
+    nb_setval(logic_mcp_recording, false),
+    forall(logic_mcp_frontier_goal(G, Reason),
+           ( format(Out, "~w\t", [%[5]s]),
+             logic_mcp_write_goal(Out, G),
+             format(Out, "\t~w~n", [Reason])
+           )).
+
+logic_mcp_write_proof(Out, Steps, Depth) :-
+    forall(member(Step, Steps), logic_mcp_write_step(Out, Step, Depth)).
+
+logic_mcp_write_step(Out, clause(G, Line, Sub), Depth) :-
+    logic_mcp_step(Out, Depth, clause, Line, G),
+    Depth1 is Depth + 1,
+    logic_mcp_write_proof(Out, Sub, Depth1).
+logic_mcp_write_step(Out, builtin(G), Depth) :-
+    logic_mcp_step(Out, Depth, builtin, 0, G).
+logic_mcp_write_step(Out, negation(G), Depth) :-
+    logic_mcp_step(Out, Depth, negation, 0, G).
+
+logic_mcp_step(Out, Depth, Kind, Line, G) :-
+    format(Out, "~w\t~d\t~w\t~d\t", [%[4]s, Depth, Kind, Line]),
+    logic_mcp_write_goal(Out, G),
+    nl(Out).
+`, opts.MaxInferences, opts.MaxDepth,
+		quoteAtom(verdictMarker), quoteAtom(proofMarker), quoteAtom(frontierMarker)) + proveSource
+}
+
+// proveSource defines the meta-interpreter logic_mcp_prove(Goal, Depth,
+// Proof), which proves Goal like call/1 and returns the proof as a list of
+// clause(Goal, Line, Subproof), builtin(Goal) and negation(Goal) steps;
+// Line is the line of the clause used in the query file, or 0 for clauses
+// of other files such as the preload library. While the global
+// variable logic_mcp_recording is true, goals that fail are recorded in
+// logic_mcp_frontier_goal/2. Cuts in clause bodies are ignored.
+var proveSource = fmt.Sprintf(`
+:- dynamic logic_mcp_frontier_goal/2.
+
+logic_mcp_prove(G, _, _) :-
+    var(G), !,
+    fail.
+logic_mcp_prove(true, _, []) :- !.
+logic_mcp_prove(!, _, []) :- !.
+logic_mcp_prove((A, B), D, P) :- !,
+    logic_mcp_prove(A, D, PA),
+    logic_mcp_prove(B, D, PB),
+    append(PA, PB, P).
+logic_mcp_prove((C -> T ; E), D, P) :- !,
+    (   logic_mcp_prove(C, D, PC)
+    ->  logic_mcp_prove(T, D, PT),
+        append(PC, PT, P)
+    ;   logic_mcp_prove(E, D, P)
+    ).
+logic_mcp_prove((A ; B), D, P) :- !,
+    (   logic_mcp_prove(A, D, P)
+    ;   logic_mcp_prove(B, D, P)
+    ).
+logic_mcp_prove((C -> T), D, P) :- !,
+    (   logic_mcp_prove(C, D, PC)
+    ->  logic_mcp_prove(T, D, PT),
+        append(PC, PT, P)
+    ).
+logic_mcp_prove(\+ G, D, [negation(\+ G)]) :- !,
+    \+ logic_mcp_prove(G, D, _).
+logic_mcp_prove(G, D, [clause(G, Line, Sub)]) :-
+    logic_mcp_user_predicate(G), !,
+    (   D =< 0
+    ->  logic_mcp_failed(G, 'depth limit reached'),
+        fail
+    ;   \+ clause(G, _)
+    ->  logic_mcp_failed(G, 'no matching clause'),
+        fail
+    ;   D1 is D - 1,
+        clause(G, Body, Ref),
+        logic_mcp_clause_line(Ref, Line),
+        logic_mcp_prove(Body, D1, Sub)
+    ).
+logic_mcp_prove(G, _, [builtin(G)]) :-
+    catch(G, error(existence_error(procedure, _), _),
+          ( logic_mcp_failed(G, 'unknown predicate'), fail ))
+    *-> true
+    ;   logic_mcp_failed(G, failed),
+        fail.
+
+logic_mcp_clause_line(Ref, Line) :-
+    clause_property(Ref, file(File)),
+    source_file(logic_mcp_prove(_, _, _), File),
+    clause_property(Ref, line_count(Line)), !.
+logic_mcp_clause_line(_, 0).
+
+logic_mcp_user_predicate(G) :-
+    predicate_property(user:G, number_of_clauses(_)),
+    \+ predicate_property(user:G, imported_from(_)).
+
+logic_mcp_failed(G, Reason) :-
+    nb_current(logic_mcp_recording, true),
+    \+ ( logic_mcp_frontier_goal(G0, _), G0 =@= G ),
+    aggregate_all(count, logic_mcp_frontier_goal(_, _), N),
+    N < %d, !,
+    copy_term(G, C),
+    assertz(logic_mcp_frontier_goal(C, Reason)).
+logic_mcp_failed(_, _).
+
+logic_mcp_write_goal(Out, G) :-
+    copy_term(G, C),
+    numbervars(C, 0, _),
+    format(Out, "~W", [C, [quoted(true), numbervars(true)]]).
+`, maxFrontier)
+
+// parseEntailment reads the verdict, proof and frontier lines of an
+// entailment result
+func parseEntailment(result *QueryResult) *Entailment {
+	ent := &Entailment{Verdict: VerdictUndetermined, Variables: result.Variables, Result: result}
+	if result.Error != "" {
+		ent.Reason = result.Error
+		return ent
+	}
+
+	verdict := false
+	for _, line := range strings.Split(result.rest, "\n") {
+		fields := strings.Split(line, "\t")
+		switch fields[0] {
+		case verdictMarker:
+			if len(fields) == 3 {
+				ent.Verdict, ent.Reason = fields[1], fields[2]
+				verdict = true
+			}
+		case proofMarker:
+			if len(fields) != 5 {
+				continue
+			}
+			if len(ent.Proof) == maxProofSteps {
+				ent.ProofTruncated = true
+				continue
+			}
+			depth, _ := strconv.Atoi(fields[1])
+			step := ProofStep{Depth: depth, Kind: fields[2], Goal: fields[4]}
+			if line, err := strconv.Atoi(fields[3]); err == nil && line > 0 {
+				if i := clauseAt(line, result.starts, result.program); i >= 0 {
+					source := result.program[i].source
+					step.Clause = result.program[i].text
+					step.Source = &source
+				}
+			}
+			ent.Proof = append(ent.Proof, step)
+		case frontierMarker:
+			if len(fields) == 3 {
+				ent.Frontier = append(ent.Frontier, FrontierGoal{Goal: fields[1], Reason: fields[2]})
+			}
+		}
+	}
+
+	switch {
+	case !verdict:
+		ent.Verdict = VerdictUndetermined
+		ent.Reason = "no verdict was reached"
+	case ent.Verdict == VerdictUndetermined && len(result.Errors) > 0:
+		ent.Reason += ": " + result.Errors[0].Text
+	}
+	if ent.Verdict == VerdictProvable && len(result.Solutions) > 0 {
+		ent.Bindings = result.Solutions[0]
+	}
+	return ent
+}
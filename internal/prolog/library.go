@@ -0,0 +1,263 @@
+package prolog
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Library is a set of Prolog files compiled once into a quick load file
+// (.qlf) and loaded read-only into every query of the engines sharing it.
+// Reload recompiles it when the files change; engines pick up the new
+// version at their next query.
+type Library struct {
+	paths   []string
+	workDir string
+
+	mu       sync.RWMutex
+	current  *libraryVersion
+	previous *libraryVersion // kept until the next swap for queries still starting on it
+	seq      int
+}
+
+// libraryVersion is one compiled state of a Library
+type libraryVersion struct {
+	version     int
+	qlf         string
+	files       []string
+	fingerprint string
+	predicates  map[string]bool // name/arity defined by the library
+}
+
+// LibraryInfo describes the loaded version of a Library
+type LibraryInfo struct {
+	Version    int      `json:"version"`
+	Files      []string `json:"files"`
+	Predicates []string `json:"predicates"`
+}
+
+// NewLibrary compiles the .pl files found at paths (files, or directories
+// searched recursively). Compiled files are kept in a private directory
+// under tempDir, or os.TempDir() if empty.
+func NewLibrary(paths []string, tempDir string) (*Library, error) {
+	if _, err := exec.LookPath("swipl"); err != nil {
+		return nil, fmt.Errorf("SWI-Prolog not found: %w", err)
+	}
+
+	workDir, err := os.MkdirTemp(tempDir, "logic_mcp_preload_")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create preload directory: %w", err)
+	}
+
+	l := &Library{paths: paths, workDir: workDir}
+	if _, err := l.Reload(); err != nil {
+		os.RemoveAll(workDir)
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reload recompiles the library if any of its files was added, removed or
+// modified. On failure the previous version stays in use.
+func (l *Library) Reload() (bool, error) {
+	files, err := l.files()
+	if err != nil {
+		return false, err
+	}
+	fingerprint, err := fingerprintFiles(files)
+	if err != nil {
+		return false, err
+	}
+
+	l.mu.RLock()
+	unchanged := l.current != nil && l.current.fingerprint == fingerprint
+	l.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	l.mu.Lock()
+	l.seq++
+	seq := l.seq
+	l.mu.Unlock()
+
+	v, err := l.compile(seq, files)
+	if err != nil {
+		return false, err
+	}
+	v.fingerprint = fingerprint
+
+	l.mu.Lock()
+	stale := l.previous
+	l.previous, l.current = l.current, v
+	l.mu.Unlock()
+
+	if stale != nil {
+		stale.remove()
+	}
+	slog.Info("Preload library compiled", "version", v.version, "files", len(v.files), "predicates", len(v.predicates))
+	return true, nil
+}
+
+// Watch polls the library files every interval and reloads on change
+// until ctx is done
+func (l *Library) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := l.Reload(); err != nil {
+				slog.Error("Failed to reload preload library, keeping the previous version", "error", err)
+			}
+		}
+	}
+}
+
+// Info describes the version in use
+func (l *Library) Info() LibraryInfo {
+	v := l.version()
+	info := LibraryInfo{Version: v.version, Files: slices.Clone(v.files)}
+	for p := range v.predicates {
+		info.Predicates = append(info.Predicates, p)
+	}
+	slices.Sort(info.Predicates)
+	return info
+}
+
+// Defines reports whether the library defines the predicate name/arity
+func (l *Library) Defines(indicator string) bool {
+	return l.version().predicates[indicator]
+}
+
+// Close removes the compiled files
+func (l *Library) Close() error {
+	return os.RemoveAll(l.workDir)
+}
+
+func (l *Library) version() *libraryVersion {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.current
+}
+
+// loadDirective returns the directive that loads the current version
+func (l *Library) loadDirective() string {
+	return fmt.Sprintf(":- load_files(%s, [silent(true)]).\n", quoteAtom(l.version().qlf))
+}
+
+// files lists the .pl files of the library in a stable order
+func (l *Library) files() ([]string, error) {
+	var files []string
+	for _, p := range l.paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(abs)
+		if err != nil {
+			return nil, fmt.Errorf("preload path: %w", err)
+		}
+		if !info.IsDir() {
+			files = append(files, abs)
+			continue
+		}
+
+		err = filepath.WalkDir(abs, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && filepath.Ext(path) == ".pl" {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("preload path: %w", err)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .pl files found in preload paths %s", strings.Join(l.paths, ", "))
+	}
+
+	slices.Sort(files)
+	return slices.Compact(files), nil
+}
+
+// compile turns files into a quick load file and lists the predicates
+// they define
+func (l *Library) compile(seq int, files []string) (*libraryVersion, error) {
+	loader := filepath.Join(l.workDir, fmt.Sprintf("preload_%d.pl", seq))
+
+	var src strings.Builder
+	for _, f := range files {
+		fmt.Fprintf(&src, ":- include(%s).\n", quoteAtom(f))
+	}
+	if err := os.WriteFile(loader, []byte(src.String()), 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write preload loader: %w", err)
+	}
+
+	// qcompile/1 also loads the file, so the defined predicates can be
+	// listed in the same run. Any error makes swipl exit non-zero.
+	goal := fmt.Sprintf(`qcompile(%s),
+forall(setof(N/A, H^G^M^(source_file(H, %s), (H = M:G -> true ; G = H), functor(G, N, A)), PIs),
+       forall(member(PI, PIs), format("~w~n", [PI]))),
+halt`, quoteAtom(loader), quoteAtom(loader))
+	cmd := exec.Command("swipl", "--on-error=status", "-q", "-g", goal, "-t", "halt(1)")
+	cmd.Dir = l.workDir
+	var stdout, stderr strings.Builder
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(loader)
+		return nil, fmt.Errorf("failed to compile preload library: %v\n%s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	v := &libraryVersion{
+		version:    seq,
+		qlf:        strings.TrimSuffix(loader, ".pl") + ".qlf",
+		files:      files,
+		predicates: make(map[string]bool),
+	}
+	scanner := bufio.NewScanner(strings.NewReader(stdout.String()))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			v.predicates[line] = true
+		}
+	}
+	return v, nil
+}
+
+// remove deletes the compiled files of a version
+func (v *libraryVersion) remove() {
+	loader := strings.TrimSuffix(v.qlf, ".qlf") + ".pl"
+	os.Remove(v.qlf)
+	os.Remove(loader)
+}
+
+// fingerprintFiles hashes the names, sizes and modification times of files
+func fingerprintFiles(files []string) (string, error) {
+	h := sha256.New()
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return "", fmt.Errorf("preload path: %w", err)
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\n", f, info.Size(), info.ModTime().UnixNano())
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
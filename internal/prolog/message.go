@@ -0,0 +1,136 @@
+package prolog
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Message is a warning or error printed by swipl
+type Message struct {
+	Text string `json:"text"`
+	// Clause is the knowledge base clause the message is about, if known
+	Clause string `json:"clause,omitempty"`
+	// Source is where the message points in the text Clause was loaded from
+	Source *Source `json:"source,omitempty"`
+	// Snippet is the source line the message points at
+	Snippet string `json:"snippet,omitempty"`
+}
+
+// splitMessages separates swipl's "Warning:" and "ERROR:" lines from other
+// output and groups them into messages. Continuation lines repeat the
+// prefix followed by extra indentation.
+func splitMessages(output string) (text string, warnings, errs []string) {
+	var rest strings.Builder
+	var current *[]string
+	for _, line := range strings.SplitAfter(output, "\n") {
+		var list *[]string
+		var msg string
+		switch {
+		case strings.HasPrefix(line, "Warning:"):
+			list, msg = &warnings, strings.TrimPrefix(line, "Warning:")
+		case strings.HasPrefix(line, "ERROR:"):
+			list, msg = &errs, strings.TrimPrefix(line, "ERROR:")
+		default:
+			rest.WriteString(line)
+			current = nil
+			continue
+		}
+
+		msg = strings.TrimRight(msg, "\n")
+		continuation := strings.HasPrefix(msg, "  ") || strings.HasPrefix(msg, "\t")
+		msg = strings.TrimSpace(msg)
+		if msg == "" {
+			continue
+		}
+		if continuation && current == list && len(*list) > 0 {
+			(*list)[len(*list)-1] += " " + msg
+			continue
+		}
+		*list = append(*list, msg)
+		current = list
+	}
+	return rest.String(), warnings, errs
+}
+
+// mapMessages turns messages about file into Messages. A message located
+// in the knowledge base part of file is attributed to its clause, which
+// starts on line starts[i] of file, and its location is rewritten to where
+// the clause was loaded from. Other locations are dropped from the text,
+// since the file is gone by the time anyone reads it.
+func mapMessages(msgs []string, file string, starts []int, clauses []clause) []Message {
+	var out []Message
+	for _, m := range msgs {
+		msg := Message{Text: m}
+		if line, column, text, ok := cutLocation(m, file); ok {
+			msg.Text = text
+			if i := clauseAt(line, starts, clauses); i >= 0 {
+				c := clauses[i]
+				offset := line - starts[i]
+				source := c.source
+				source.Line += offset
+				if offset > 0 {
+					source.Column = 1
+				}
+				location := source.String()
+				if column >= 0 {
+					// Only the first line of a clause was moved
+					source.Column += column
+					location += fmt.Sprintf(", column %d", source.Column)
+				}
+				msg.Text = fmt.Sprintf("%s: %s", location, text)
+				msg.Clause = c.text
+				msg.Source = &source
+				msg.Snippet = snippet(c.text, offset, source.Line, column)
+			}
+		}
+		out = append(out, msg)
+	}
+	return out
+}
+
+// snippet shows line offset of a clause, numbered as line of its source,
+// with a caret under column when it is known
+func snippet(text string, offset, line, column int) string {
+	lines := strings.Split(text, "\n")
+	if offset >= len(lines) {
+		return ""
+	}
+	number := strconv.Itoa(line)
+	s := fmt.Sprintf("%s | %s", number, lines[offset])
+	if column >= 0 {
+		s += fmt.Sprintf("\n%s | %s^", strings.Repeat(" ", len(number)), strings.Repeat(" ", column))
+	}
+	return s
+}
+
+// cutLocation splits "file:line: text" or "file:line:column: text" into
+// the line, the 0-based column or -1, and the text
+func cutLocation(msg, file string) (line, column int, text string, ok bool) {
+	rest, ok := strings.CutPrefix(msg, file+":")
+	if !ok {
+		return 0, 0, "", false
+	}
+	lineText, rest, ok := strings.Cut(rest, ":")
+	line, err := strconv.Atoi(lineText)
+	if !ok || err != nil {
+		return 0, 0, "", false
+	}
+	column = -1
+	if columnText, after, ok := strings.Cut(rest, ":"); ok {
+		if n, err := strconv.Atoi(columnText); err == nil {
+			column, rest = n, after
+		}
+	}
+	return line, column, strings.TrimSpace(rest), true
+}
+
+// clauseAt returns the index of the clause spanning line, or -1
+func clauseAt(line int, starts []int, clauses []clause) int {
+	i := sort.SearchInts(starts, line+1) - 1
+	if i < 0 || line >= starts[i]+strings.Count(clauses[i].text, "\n")+1 {
+		return -1
+	}
+	return i
+}
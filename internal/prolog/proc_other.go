@@ -0,0 +1,14 @@
+//go:build !unix
+
+package prolog
+
+import "os/exec"
+
+// setProcessGroup is a no-op where process groups are not available; the
+// default cancellation kills swipl itself
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup is a no-op where process groups are not available
+func killProcessGroup(cmd *exec.Cmd) error {
+	return nil
+}
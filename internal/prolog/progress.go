@@ -0,0 +1,90 @@
+package prolog
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Progress reports on a running query
+type Progress struct {
+	// Elapsed is the time since swipl was started
+	Elapsed time.Duration
+	// Inferences is the number of logical inferences so far
+	Inferences int64
+	// Solutions is the number of solutions found so far
+	Solutions int
+}
+
+// progressInterval is how often a running query reports progress
+const progressInterval = time.Second
+
+// progressMarker starts the lines swipl prints to report progress
+const progressMarker = "__LOGIC_MCP_PROGRESS__"
+
+// progressSource re-arms an alarm that prints the inference count and the
+// number of solutions so far to user_error. The alarm fires in the query
+// thread, so the count is that of the query.
+var progressSource = fmt.Sprintf(`
+logic_mcp_progress :-
+    statistics(inferences, Inferences),
+    nb_getval(logic_mcp_solutions, Solutions),
+    format(user_error, "~~N~~w~~d ~~d~~n", [%s, Inferences, Solutions]),
+    alarm(%g, logic_mcp_progress, _, [remove(true)]).
+`, quoteAtom(progressMarker), progressInterval.Seconds())
+
+// outputWriter collects the error output of swipl. When progress is set,
+// it removes progress lines as they arrive and reports them.
+type outputWriter struct {
+	start    time.Time
+	progress func(Progress)
+	limit    int // solutions beyond the limit are not reported
+	out      bytes.Buffer
+	partial  []byte
+}
+
+func (w *outputWriter) Write(p []byte) (int, error) {
+	if w.progress == nil {
+		return w.out.Write(p)
+	}
+
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.line(w.partial[:i+1])
+		w.partial = w.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// line handles one complete output line
+func (w *outputWriter) line(line []byte) {
+	if data, ok := bytes.CutPrefix(line, []byte(progressMarker)); ok {
+		fields := strings.Fields(string(data))
+		if len(fields) == 2 {
+			inferences, err1 := strconv.ParseInt(fields[0], 10, 64)
+			solutions, err2 := strconv.Atoi(fields[1])
+			if err1 == nil && err2 == nil {
+				w.progress(Progress{
+					Elapsed:    time.Since(w.start),
+					Inferences: inferences,
+					Solutions:  min(solutions, w.limit),
+				})
+				return
+			}
+		}
+	}
+	w.out.Write(line)
+}
+
+// Bytes returns the output without progress lines
+func (w *outputWriter) Bytes() []byte {
+	w.out.Write(w.partial)
+	w.partial = nil
+	return w.out.Bytes()
+}
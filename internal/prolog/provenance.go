@@ -0,0 +1,117 @@
+package prolog
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Provenance records who added a clause and when
+type Provenance struct {
+	// Tool is the tool call that added the clause
+	Tool    string    `json:"tool,omitempty"`
+	Time    time.Time `json:"time"`
+	Session string    `json:"session,omitempty"`
+	// Caller is the authenticated subject, if any
+	Caller string   `json:"caller,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+// Clause is a knowledge base clause with its origin
+type Clause struct {
+	Text       string     `json:"text"`
+	Source     Source     `json:"source"`
+	Provenance Provenance `json:"provenance"`
+}
+
+// ClauseFilter selects clauses by origin. Zero fields match everything;
+// set fields must all match.
+type ClauseFilter struct {
+	Load      int
+	Tool      string
+	Session   string
+	Caller    string
+	Tag       string
+	Predicate string // e.g. parent/2
+	Since     time.Time
+	Until     time.Time
+}
+
+// IsZero reports whether the filter matches every clause
+func (f ClauseFilter) IsZero() bool {
+	return f.Load == 0 && f.Tool == "" && f.Session == "" && f.Caller == "" && f.Tag == "" &&
+		f.Predicate == "" && f.Since.IsZero() && f.Until.IsZero()
+}
+
+// matches reports whether a clause passes the filter
+func (f ClauseFilter) matches(c clause) bool {
+	p := c.provenance
+	if p == nil {
+		p = &Provenance{}
+	}
+	switch {
+	case f.Load != 0 && c.source.Load != f.Load,
+		f.Tool != "" && p.Tool != f.Tool,
+		f.Session != "" && p.Session != f.Session,
+		f.Caller != "" && p.Caller != f.Caller,
+		f.Tag != "" && !slices.Contains(p.Tags, f.Tag),
+		!f.Since.IsZero() && p.Time.Before(f.Since),
+		!f.Until.IsZero() && !p.Time.Before(f.Until):
+		return false
+	}
+	if f.Predicate != "" {
+		head, ok := clauseHead(c.text)
+		return ok && head == f.Predicate
+	}
+	return true
+}
+
+// Clauses returns the clauses matching f, in knowledge base order
+func (e *Engine) Clauses(f ClauseFilter) []Clause {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	var out []Clause
+	for _, c := range e.facts {
+		if f.matches(c) {
+			out = append(out, c.export())
+		}
+	}
+	return out
+}
+
+// RetractClauses removes the clauses matching f and returns how many were
+// removed. An empty filter is rejected; ClearKnowledgeBase removes all.
+func (e *Engine) RetractClauses(f ClauseFilter) (int, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.closed {
+		return 0, fmt.Errorf("engine is closed")
+	}
+	if f.IsZero() {
+		return 0, fmt.Errorf("no filter given: use ClearKnowledgeBase to remove every clause")
+	}
+
+	kept := make([]clause, 0, len(e.facts))
+	for _, c := range e.facts {
+		if !f.matches(c) {
+			kept = append(kept, c)
+		}
+	}
+	removed := len(e.facts) - len(kept)
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, e.setClauses(kept)
+}
+
+// export converts a clause record to a Clause
+func (c clause) export() Clause {
+	out := Clause{Text: c.text, Source: c.source}
+	if c.provenance != nil {
+		out.Provenance = *c.provenance
+		out.Provenance.Tags = slices.Clone(c.provenance.Tags)
+	}
+	return out
+}
@@ -0,0 +1,251 @@
+package prolog
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// flagValues are the Prolog flags a session may set, with their values.
+// The first value is the swipl default.
+var flagValues = map[string][]string{
+	"back_quotes":   {"codes", "chars", "string", "symbol_char"},
+	"double_quotes": {"string", "codes", "chars", "atom"},
+	"occurs_check":  {"false", "true", "error"},
+	"unknown":       {"error", "fail", "warning"},
+}
+
+// operatorTypes are the valid types of op/3
+var operatorTypes = []string{"xfx", "xfy", "yfx", "fy", "fx", "xf", "yf"}
+
+// Operator is an operator definition as in op/3. Priority 0 removes the
+// operator.
+type Operator struct {
+	Priority int    `json:"priority" jsonschema:"Priority from 0 (remove the operator) to 1200."`
+	Type     string `json:"type" jsonschema:"xfx, xfy, yfx, fy, fx, xf or yf."`
+	Name     string `json:"name"`
+}
+
+// Settings are the Prolog flags and operators applied to every query and
+// syntax check of an engine
+type Settings struct {
+	// Flags holds the effective value of every settable flag
+	Flags     map[string]string `json:"flags"`
+	Operators []Operator        `json:"operators,omitempty"`
+}
+
+// Settings returns the effective flags and the operators defined
+func (e *Engine) Settings() Settings {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.settings()
+}
+
+// SetFlags sets flags and defines operators for every later query and
+// syntax check. Settings persist until reset and are merged: an operator
+// replaces an earlier one of the same name and type.
+func (e *Engine) SetFlags(flags map[string]string, ops []Operator) (Settings, error) {
+	return e.setFlags(flags, ops, false)
+}
+
+// ReplaceFlags is ResetFlags followed by SetFlags as one change: if a flag
+// or operator is invalid, the settings are left as they were.
+func (e *Engine) ReplaceFlags(flags map[string]string, ops []Operator) (Settings, error) {
+	return e.setFlags(flags, ops, true)
+}
+
+// setFlags validates flags and ops, then applies them, after restoring the
+// defaults if reset is set
+func (e *Engine) setFlags(flags map[string]string, ops []Operator, reset bool) (Settings, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.closed {
+		return Settings{}, fmt.Errorf("engine is closed")
+	}
+	for name, value := range flags {
+		values, ok := flagValues[name]
+		if !ok {
+			return Settings{}, fmt.Errorf("flag %s cannot be set: use one of %s", name, strings.Join(slices.Sorted(maps.Keys(flagValues)), ", "))
+		}
+		if !slices.Contains(values, value) {
+			return Settings{}, fmt.Errorf("invalid value %q for flag %s: use one of %s", value, name, strings.Join(values, ", "))
+		}
+	}
+	for _, op := range ops {
+		if err := checkOperator(op); err != nil {
+			return Settings{}, err
+		}
+	}
+
+	if reset {
+		e.flags = nil
+		e.operators = nil
+	}
+	if e.flags == nil {
+		e.flags = make(map[string]string)
+	}
+	maps.Copy(e.flags, flags)
+	for _, op := range ops {
+		i := slices.IndexFunc(e.operators, func(o Operator) bool { return o.Name == op.Name && o.Type == op.Type })
+		if i >= 0 {
+			e.operators[i] = op
+		} else {
+			e.operators = append(e.operators, op)
+		}
+	}
+	return e.settings(), nil
+}
+
+// ResetFlags restores the default flags and removes the operators defined
+// by SetFlags
+func (e *Engine) ResetFlags() Settings {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.flags = nil
+	e.operators = nil
+	return e.settings()
+}
+
+// checkOperator validates an operator definition
+func checkOperator(op Operator) error {
+	if op.Priority < 0 || op.Priority > 1200 {
+		return fmt.Errorf("operator %s: priority must be between 0 and 1200, got %d", op.Name, op.Priority)
+	}
+	if !slices.Contains(operatorTypes, op.Type) {
+		return fmt.Errorf("operator %s: invalid type %q: use one of %s", op.Name, op.Type, strings.Join(operatorTypes, ", "))
+	}
+	switch {
+	case op.Name == "":
+		return fmt.Errorf("operator name is empty")
+	case slices.Contains(protectedOperators, op.Name):
+		return fmt.Errorf("operator %s cannot be changed", op.Name)
+	}
+	return nil
+}
+
+// protectedOperators cannot be changed: swipl does not allow it for most,
+// and the driver needs :- to restore the operator table after the
+// knowledge base
+var protectedOperators = []string{",", "|", "[]", "{}", ":-"}
+
+// settings returns the effective settings. The caller must hold the mutex.
+func (e *Engine) settings() Settings {
+	s := Settings{Flags: make(map[string]string, len(flagValues)), Operators: slices.Clone(e.operators)}
+	for name, values := range flagValues {
+		s.Flags[name] = values[0]
+	}
+	maps.Copy(s.Flags, e.flags)
+	return s
+}
+
+// settingsSource returns the directives applying the settings while the
+// program is loaded and logic_mcp_settings/0, which applies the flags
+// again when it runs: swipl restores flags such as double_quotes at the
+// end of each file. The caller must hold the mutex.
+func (e *Engine) settingsSource() string {
+	var b strings.Builder
+	for _, op := range e.operators {
+		fmt.Fprintf(&b, ":- op(%d, %s, %s).\n", op.Priority, op.Type, quoteAtom(op.Name))
+	}
+	goals := []string{"true"}
+	for _, name := range slices.Sorted(maps.Keys(e.flags)) {
+		goal := fmt.Sprintf("set_prolog_flag(%s, %s)", name, e.flags[name])
+		fmt.Fprintf(&b, ":- %s.\n", goal)
+		goals = append(goals, goal)
+	}
+	fmt.Fprintf(&b, "logic_mcp_settings :- %s.\n", strings.Join(goals, ", "))
+	return b.String()
+}
+
+// operatorSource goes before the session operators and the knowledge base.
+// It records the operator table the driver is written for, so that
+// restoreSyntax can read the driver under it, and defines
+// logic_mcp_user_operators/0, which brings back the operators of the
+// session and the knowledge base for reading the query.
+const operatorSource = `logic_mcp_set_operators(Ops) :-
+    findall(op(0, T, N), ( current_op(_, T, N), \+ memberchk(op(_, T, N), Ops) ), Removed),
+    append(Removed, Ops, All),
+    forall(member(op(P, T, N), All), catch(op(P, T, N), _, true)).
+logic_mcp_default_operators :-
+    findall(op(P, T, N), current_op(P, T, N), Ops),
+    nb_setval(logic_mcp_user_operators, Ops),
+    nb_getval(logic_mcp_default_operators, Default),
+    logic_mcp_set_operators(Default).
+logic_mcp_user_operators :-
+    nb_getval(logic_mcp_user_operators, Ops),
+    logic_mcp_set_operators(Ops).
+:- findall(op(P, T, N), current_op(P, T, N), Ops), nb_setval(logic_mcp_default_operators, Ops).
+`
+
+// restoreSyntax resets the flags that change how text is read and the
+// operator table, so the driver after the knowledge base is read as
+// written. Reading it takes only the prefix :-, which cannot be changed.
+const restoreSyntax = ":- set_prolog_flag(double_quotes, string).\n:- set_prolog_flag(back_quotes, codes).\n:- logic_mcp_default_operators.\n"
+
+// CheckSyntax reads code with the session flags and operators and returns
+// a message for every syntax error. Clauses are not loaded.
+func (e *Engine) CheckSyntax(ctx context.Context, code string) ([]Message, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.closed {
+		return nil, fmt.Errorf("engine is closed")
+	}
+
+	codeFile, err := e.createTempFile("code.pl")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer e.removeTempFile(codeFile)
+	checkFile, err := e.createTempFile("check.pl")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer e.removeTempFile(checkFile)
+
+	// One clause per line, so messages map back like those of queries
+	var clauses []clause
+	var src strings.Builder
+	var starts []int
+	line := 1
+	for _, c := range splitClausesAt(code) {
+		clauses = append(clauses, clause{text: c.text, source: Source{Line: c.line, Column: c.column}})
+		starts = append(starts, line)
+		line += strings.Count(c.text, "\n") + 1
+		src.WriteString(c.text)
+		src.WriteByte('\n')
+	}
+	if err := os.WriteFile(codeFile, []byte(src.String()), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write code: %w", err)
+	}
+
+	// The driver is read under the defaults; the session settings are
+	// brought back for reading the code
+	check := restoreSyntax + fmt.Sprintf(`
+logic_mcp_read_all(In) :-
+    catch(read_term(In, Term, []), Error,
+          ( print_message(error, Error), Term = error )),
+    (   Term == end_of_file -> true ; logic_mcp_read_all(In) ).
+
+main :-
+    logic_mcp_settings,
+    logic_mcp_user_operators,
+    open(%s, read, In, [encoding(utf8)]),
+    logic_mcp_read_all(In),
+    close(In).
+`, quoteAtom(codeFile))
+	if err := os.WriteFile(checkFile, []byte(check), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write syntax check: %w", err)
+	}
+
+	_, errs, runErr := e.compile(ctx, checkFile, "main")
+	if runErr != nil && len(errs) == 0 {
+		return nil, fmt.Errorf("syntax check failed: %w", runErr)
+	}
+	return mapMessages(errs, codeFile, starts, clauses), nil
+}
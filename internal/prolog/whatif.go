@@ -0,0 +1,125 @@
+package prolog
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Assumptions are clauses added to or hidden from the knowledge base for
+// one query, without changing it
+type Assumptions struct {
+	// Add holds clauses one per line, as LoadFacts takes them
+	Add string
+	// Hide holds clauses of the knowledge base to leave out. They are
+	// compared like loaded clauses, so layout and variable names do not
+	// matter.
+	Hide []string
+}
+
+// WhatIfResult is a query run against the knowledge base and against the
+// knowledge base under assumptions
+type WhatIfResult struct {
+	Baseline     *QueryResult
+	Hypothetical *QueryResult
+	// Added counts the assumed clauses not already in the knowledge base
+	Added int
+	// Hidden counts the clauses of the knowledge base left out
+	Hidden int
+}
+
+// WhatIf runs query against the knowledge base and against the knowledge
+// base with the assumptions applied. Both run on the same snapshot, at once
+// unless the concurrency quota allows only one, and each is admitted by the
+// quotas; the knowledge base is not changed.
+func (e *Engine) WhatIf(ctx context.Context, query string, a Assumptions) (*WhatIfResult, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.closed {
+		return nil, fmt.Errorf("engine is closed")
+	}
+
+	assumed := parseLines(a.Add, Source{File: "assumptions"}, nil)
+	if err := e.checkClauses(assumed); err != nil {
+		return nil, err
+	}
+	// Assumed clauses must match the declarations, like loaded ones
+	if mismatches := checkDeclared(assumed, e.declarations); len(mismatches) > 0 {
+		return nil, &DeclarationError{Mismatches: mismatches}
+	}
+	hide := make(map[string]bool)
+	for _, h := range a.Hide {
+		text := strings.TrimSpace(h)
+		if text == "" {
+			continue
+		}
+		if !strings.HasSuffix(text, ".") {
+			text += "."
+		}
+		key := clauseKey(text)
+		if e.factKeys[key] == 0 {
+			return nil, fmt.Errorf("cannot hide %s: it is not in the knowledge base", text)
+		}
+		hide[key] = true
+	}
+
+	result := &WhatIfResult{}
+	facts := make([]clause, 0, len(e.facts)+len(assumed))
+	var size int64
+	for _, c := range e.facts {
+		if hide[clauseKey(c.text)] {
+			result.Hidden++
+			continue
+		}
+		facts = append(facts, c)
+		size += int64(len(c.text))
+	}
+	added := make(map[string]bool)
+	for _, c := range assumed {
+		key := clauseKey(c.text)
+		if added[key] || e.factKeys[key] > 0 && !hide[key] {
+			continue
+		}
+		added[key] = true
+		facts = append(facts, c)
+		size += int64(len(c.text))
+		result.Added++
+	}
+	if err := e.checkSize(len(facts), size); err != nil {
+		return nil, err
+	}
+
+	var baselineErr, hypotheticalErr error
+	baseline := func() {
+		result.Baseline, baselineErr = e.query(ctx, e.facts, query, "", nil, time.Now())
+	}
+	hypothetical := func() {
+		result.Hypothetical, hypotheticalErr = e.query(ctx, facts, query, "", nil, time.Now())
+	}
+	if e.parallelism(2) < 2 {
+		baseline()
+		hypothetical()
+	} else {
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			baseline()
+		}()
+		go func() {
+			defer wg.Done()
+			hypothetical()
+		}()
+		wg.Wait()
+	}
+	if baselineErr != nil {
+		return nil, baselineErr
+	}
+	if hypotheticalErr != nil {
+		return nil, hypotheticalErr
+	}
+	return result, nil
+}
@@ -0,0 +1,249 @@
+package quota
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Quota names reported in ExceededError
+const (
+	QueriesPerMinute  = "queries_per_minute"
+	ConcurrentQueries = "concurrent_queries"
+	CPUSeconds        = "cpu_seconds"
+	MaxClauses        = "max_clauses"
+	MaxBytes          = "max_bytes"
+)
+
+// CPUWindow is the period the cpu_seconds quota applies to: CPU time
+// counts until CPUWindow after the first query that used it
+const CPUWindow = time.Hour
+
+// idleExpiry is how long a registry keeps a tracker nobody uses. By then
+// its CPU time and its rate are restored, so a new tracker is no different.
+const idleExpiry = CPUWindow
+
+// sweepInterval is how often registries and rate limiters look for state
+// to expire
+const sweepInterval = time.Minute
+
+// Limits are resource quotas; zero values mean unlimited
+type Limits struct {
+	QueriesPerMinute  int     `json:"queries_per_minute,omitempty" yaml:"queries_per_minute"`
+	ConcurrentQueries int     `json:"concurrent_queries,omitempty" yaml:"concurrent_queries"`
+	CPUSeconds        float64 `json:"cpu_seconds,omitempty" yaml:"cpu_seconds"`
+	MaxClauses        int     `json:"max_clauses,omitempty" yaml:"max_clauses"`
+	MaxBytes          int64   `json:"max_bytes,omitempty" yaml:"max_bytes"`
+}
+
+// Merge returns the stricter of two limits for every quota
+func (l Limits) Merge(other Limits) Limits {
+	return Limits{
+		QueriesPerMinute:  minPositive(l.QueriesPerMinute, other.QueriesPerMinute),
+		ConcurrentQueries: minPositive(l.ConcurrentQueries, other.ConcurrentQueries),
+		CPUSeconds:        minPositive(l.CPUSeconds, other.CPUSeconds),
+		MaxClauses:        minPositive(l.MaxClauses, other.MaxClauses),
+		MaxBytes:          minPositive(l.MaxBytes, other.MaxBytes),
+	}
+}
+
+func minPositive[T int | int64 | float64](a, b T) T {
+	if a <= 0 {
+		return b
+	}
+	if b <= 0 {
+		return a
+	}
+	return min(a, b)
+}
+
+// ExceededError reports which quota was exceeded and when to retry.
+// A zero RetryAfter means retrying will not help.
+type ExceededError struct {
+	Quota      string        `json:"quota"`
+	Scope      string        `json:"scope"`
+	Limit      float64       `json:"limit"`
+	RetryAfter time.Duration `json:"-"`
+}
+
+func (e *ExceededError) Error() string {
+	msg := fmt.Sprintf("%s quota exceeded: %s limit is %g", e.Scope, e.Quota, e.Limit)
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(", retry after %ds", e.RetryAfterSeconds())
+	}
+	return msg
+}
+
+// RetryAfterSeconds rounds RetryAfter up to whole seconds
+func (e *ExceededError) RetryAfterSeconds() int {
+	return int(math.Ceil(e.RetryAfter.Seconds()))
+}
+
+// Tracker enforces query quotas for one scope (a session or a token)
+type Tracker struct {
+	scope   string
+	limits  Limits
+	limiter *RateLimiter
+
+	now func() time.Time
+
+	mu      sync.Mutex
+	running int
+	cpu     time.Duration
+	// cpuSince starts the window of cpu, zero before any CPU time is used
+	cpuSince time.Time
+	lastUsed time.Time
+}
+
+// NewTracker creates a tracker for the named scope
+func NewTracker(scope string, limits Limits) *Tracker {
+	return &Tracker{
+		scope:    scope,
+		limits:   limits,
+		limiter:  NewRateLimiter(),
+		now:      time.Now,
+		lastUsed: time.Now(),
+	}
+}
+
+// Limits returns the limits the tracker enforces
+func (t *Tracker) Limits() Limits {
+	return t.limits
+}
+
+// Acquire admits one query. The returned release function must be called
+// when the query finishes, with the CPU time it consumed.
+func (t *Tracker) Acquire() (release func(cpu time.Duration), err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.lastUsed = now
+	t.expireCPU(now)
+	if t.limits.CPUSeconds > 0 && t.cpu.Seconds() >= t.limits.CPUSeconds {
+		return nil, &ExceededError{
+			Quota:      CPUSeconds,
+			Scope:      t.scope,
+			Limit:      t.limits.CPUSeconds,
+			RetryAfter: t.cpuSince.Add(CPUWindow).Sub(now),
+		}
+	}
+	if t.limits.ConcurrentQueries > 0 && t.running >= t.limits.ConcurrentQueries {
+		return nil, &ExceededError{
+			Quota:      ConcurrentQueries,
+			Scope:      t.scope,
+			Limit:      float64(t.limits.ConcurrentQueries),
+			RetryAfter: time.Second,
+		}
+	}
+	if ok, retryAfter := t.limiter.Allow(t.scope, t.limits.QueriesPerMinute); !ok {
+		return nil, &ExceededError{
+			Quota:      QueriesPerMinute,
+			Scope:      t.scope,
+			Limit:      float64(t.limits.QueriesPerMinute),
+			RetryAfter: retryAfter,
+		}
+	}
+
+	t.running++
+	var once sync.Once
+	return func(cpu time.Duration) {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			now := t.now()
+			t.running--
+			t.lastUsed = now
+			t.expireCPU(now)
+			if cpu > 0 && t.cpuSince.IsZero() {
+				t.cpuSince = now
+			}
+			t.cpu += cpu
+		})
+	}, nil
+}
+
+// expireCPU forgets the CPU time used once its window is over. The caller
+// must hold t.mu.
+func (t *Tracker) expireCPU(now time.Time) {
+	if !t.cpuSince.IsZero() && now.Sub(t.cpuSince) >= CPUWindow {
+		t.cpu, t.cpuSince = 0, time.Time{}
+	}
+}
+
+// idle reports whether no query ran for idleExpiry
+func (t *Tracker) idle(now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.running == 0 && now.Sub(t.lastUsed) >= idleExpiry
+}
+
+// AcquireAll admits a query against every tracker, releasing what it took
+// if any of them refuses. Nil trackers are skipped.
+func AcquireAll(trackers ...*Tracker) (release func(cpu time.Duration), err error) {
+	var releases []func(time.Duration)
+	releaseAll := func(cpu time.Duration) {
+		for _, r := range releases {
+			r(cpu)
+		}
+	}
+
+	for _, t := range trackers {
+		if t == nil {
+			continue
+		}
+		r, err := t.Acquire()
+		if err != nil {
+			releaseAll(0)
+			return nil, err
+		}
+		releases = append(releases, r)
+	}
+	return releaseAll, nil
+}
+
+// Registry hands out one shared tracker per key, e.g. per caller. Trackers
+// unused for idleExpiry are dropped, so keys such as remote addresses
+// cannot grow it without bound.
+type Registry struct {
+	scope     string
+	now       func() time.Time
+	mu        sync.Mutex
+	trackers  map[string]*Tracker
+	lastSweep time.Time
+}
+
+// NewRegistry creates an empty registry whose trackers report scope in
+// their errors; an empty scope reports the key
+func NewRegistry(scope string) *Registry {
+	return &Registry{scope: scope, now: time.Now, trackers: make(map[string]*Tracker)}
+}
+
+// Tracker returns the tracker for key, creating it with limits on first use
+func (r *Registry) Tracker(key string, limits Limits) *Tracker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	if now.Sub(r.lastSweep) >= sweepInterval {
+		for k, t := range r.trackers {
+			if t.idle(now) {
+				delete(r.trackers, k)
+			}
+		}
+		r.lastSweep = now
+	}
+
+	t, ok := r.trackers[key]
+	if !ok {
+		scope := r.scope
+		if scope == "" {
+			scope = key
+		}
+		t = NewTracker(scope, limits)
+		t.now, t.limiter.now, t.lastUsed = r.now, r.now, now
+		r.trackers[key] = t
+	}
+	return t
+}
@@ -0,0 +1,177 @@
+package quota
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func exceeded(t *testing.T, err error) *ExceededError {
+	t.Helper()
+
+	var e *ExceededError
+	require.True(t, errors.As(err, &e), "expected ExceededError, got %v", err)
+	return e
+}
+
+func TestTracker_QueriesPerMinute(t *testing.T) {
+	now := time.Unix(0, 0)
+	tr := NewTracker("session", Limits{QueriesPerMinute: 2})
+	tr.limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		release, err := tr.Acquire()
+		require.NoError(t, err)
+		release(0)
+	}
+
+	_, err := tr.Acquire()
+	e := exceeded(t, err)
+	assert.Equal(t, QueriesPerMinute, e.Quota)
+	assert.Equal(t, 30, e.RetryAfterSeconds())
+
+	now = now.Add(30 * time.Second)
+	_, err = tr.Acquire()
+	assert.NoError(t, err)
+}
+
+func TestTracker_ConcurrentQueries(t *testing.T) {
+	tr := NewTracker("session", Limits{ConcurrentQueries: 1})
+
+	release, err := tr.Acquire()
+	require.NoError(t, err)
+
+	_, err = tr.Acquire()
+	assert.Equal(t, ConcurrentQueries, exceeded(t, err).Quota)
+
+	release(0)
+	release(0) // releasing twice must not free a second slot
+	_, err = tr.Acquire()
+	assert.NoError(t, err)
+	_, err = tr.Acquire()
+	assert.Error(t, err)
+}
+
+func TestTracker_CPUSeconds(t *testing.T) {
+	now := time.Unix(0, 0)
+	tr := NewTracker("session", Limits{CPUSeconds: 1.5})
+	tr.now = func() time.Time { return now }
+
+	release, err := tr.Acquire()
+	require.NoError(t, err)
+	now = now.Add(10 * time.Minute)
+	release(2 * time.Second)
+
+	// The CPU time counts for CPUWindow after it was used
+	now = now.Add(20 * time.Minute)
+	_, err = tr.Acquire()
+	e := exceeded(t, err)
+	assert.Equal(t, CPUSeconds, e.Quota)
+	assert.Equal(t, 40*60, e.RetryAfterSeconds())
+
+	now = now.Add(40 * time.Minute)
+	release, err = tr.Acquire()
+	require.NoError(t, err)
+	release(time.Second)
+	_, err = tr.Acquire()
+	assert.NoError(t, err, "the window starts again with the next CPU time used")
+}
+
+func TestAcquireAll_ReleasesOnFailure(t *testing.T) {
+	session := NewTracker("session", Limits{ConcurrentQueries: 1})
+	token := NewTracker("token ci", Limits{ConcurrentQueries: 1})
+
+	// Occupy the token so the combined acquire fails after the session succeeded
+	holdToken, err := token.Acquire()
+	require.NoError(t, err)
+
+	_, err = AcquireAll(session, nil, token)
+	assert.Equal(t, "token ci", exceeded(t, err).Scope)
+
+	holdToken(0)
+	release, err := AcquireAll(session, token)
+	require.NoError(t, err, "session slot must have been returned")
+	release(0)
+}
+
+func TestLimits_Merge(t *testing.T) {
+	merged := Limits{QueriesPerMinute: 60, MaxClauses: 100}.Merge(Limits{QueriesPerMinute: 10, MaxBytes: 1024})
+	assert.Equal(t, Limits{QueriesPerMinute: 10, MaxClauses: 100, MaxBytes: 1024}, merged)
+}
+
+func TestRegistry_SharesTrackersPerKey(t *testing.T) {
+	sessions := NewRegistry("session")
+	limits := Limits{ConcurrentQueries: 1}
+
+	// Two stateless sessions of one caller share the quota
+	first := sessions.Tracker("token:ci", limits)
+	assert.Same(t, first, sessions.Tracker("token:ci", limits))
+	release, err := first.Acquire()
+	require.NoError(t, err)
+	_, err = sessions.Tracker("token:ci", limits).Acquire()
+	assert.Equal(t, "session", exceeded(t, err).Scope)
+
+	// Other callers do not
+	other, err := sessions.Tracker("jwt:ci", limits).Acquire()
+	require.NoError(t, err)
+	other(0)
+	release(0)
+
+	tokens := NewRegistry("")
+	_, err = tokens.Tracker("token:ci", Limits{CPUSeconds: 0.001}).Acquire()
+	require.NoError(t, err)
+	assert.Equal(t, "token:ci", tokens.Tracker("token:ci", Limits{}).scope)
+}
+
+func TestRegistry_ExpiresIdleTrackers(t *testing.T) {
+	now := time.Unix(0, 0)
+	r := NewRegistry("session")
+	r.now = func() time.Time { return now }
+	limits := Limits{ConcurrentQueries: 1, CPUSeconds: 1}
+
+	busy := r.Tracker("addr:10.0.0.1", limits)
+	hold, err := busy.Acquire()
+	require.NoError(t, err)
+	spent, err := r.Tracker("addr:10.0.0.2", limits).Acquire()
+	require.NoError(t, err)
+	spent(2 * time.Second)
+	for i := 0; i < 100; i++ {
+		r.Tracker(fmt.Sprintf("addr:10.1.0.%d", i), limits)
+	}
+
+	// Trackers unused for idleExpiry are dropped, but not while a query runs
+	now = now.Add(idleExpiry)
+	r.Tracker("addr:10.0.0.3", limits)
+	assert.Len(t, r.trackers, 2)
+	assert.Same(t, busy, r.Tracker("addr:10.0.0.1", limits))
+	hold(0)
+
+	// A caller coming back finds its CPU time restored either way
+	release, err := r.Tracker("addr:10.0.0.2", limits).Acquire()
+	require.NoError(t, err)
+	release(0)
+}
+
+func TestRateLimiter_ExpiresFullBuckets(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewRateLimiter()
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 100; i++ {
+		ok, _ := l.Allow(fmt.Sprintf("addr:%d", i), 1)
+		require.True(t, ok)
+	}
+	ok, retryAfter := l.Allow("addr:0", 1)
+	assert.False(t, ok)
+	assert.Equal(t, time.Minute, retryAfter)
+
+	// After a minute every bucket is full again and need not be kept
+	now = now.Add(time.Minute)
+	ok, _ = l.Allow("addr:0", 1)
+	assert.True(t, ok)
+	assert.Len(t, l.buckets, 1)
+}
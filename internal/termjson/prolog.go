@@ -0,0 +1,105 @@
+package termjson
+
+// PrologSource defines logic_mcp_json_bindings(+Bindings), which writes a
+// list of Name=Value pairs as one JSON object mapping each name to the
+// tagged JSON of its value. Unbound variables are named _0, _1, ... in order
+// of appearance across all values, so sharing between bindings survives.
+// Non-ASCII characters are escaped, so the output is plain ASCII.
+const PrologSource = `
+logic_mcp_json_bindings(Bindings) :-
+    term_variables(Bindings, Vars),
+    write('{'),
+    logic_mcp_json_pairs(Bindings, Vars, ''),
+    write('}').
+
+logic_mcp_json_pairs([], _, _).
+logic_mcp_json_pairs([Name=Value|Rest], Vars, Sep) :-
+    write(Sep),
+    logic_mcp_json_string(Name),
+    write(':'),
+    (   cyclic_term(Value) ->
+        with_output_to(string(Text), write_term(Value, [quoted(true), cycles(true)])),
+        write('{"type":"cyclic","text":'), logic_mcp_json_string(Text), write('}')
+    ;   logic_mcp_json(Value, Vars)
+    ),
+    logic_mcp_json_pairs(Rest, Vars, ',').
+
+logic_mcp_json(T, Vars) :-
+    (   var(T) ->
+        logic_mcp_json_var_index(Vars, T, 0, I),
+        format('{"type":"var","name":"_~d"}', [I])
+    ;   T == [] ->
+        write('{"type":"list","elements":[]}')
+    ;   string(T) ->
+        write('{"type":"string","value":'), logic_mcp_json_string(T), write('}')
+    ;   integer(T) ->
+        (   abs(T) =< 9007199254740991 ->
+            format('{"type":"integer","value":~d}', [T])
+        ;   format('{"type":"integer","value":"~d"}', [T])
+        )
+    ;   float(T) ->
+        logic_mcp_json_float(T)
+    ;   atom(T), blob(T, text) ->
+        write('{"type":"atom","value":'), logic_mcp_json_string(T), write('}')
+    ;   T = [_|_] ->
+        write('{"type":"list","elements":['),
+        logic_mcp_json_elements(T, Vars, '', Tail),
+        write(']'),
+        (   Tail == [] -> true
+        ;   write(',"tail":'), logic_mcp_json(Tail, Vars)
+        ),
+        write('}')
+    ;   compound(T), \+ is_dict(T) ->
+        compound_name_arguments(T, Name, Args),
+        write('{"type":"compound","functor":'), logic_mcp_json_string(Name),
+        write(',"args":['), logic_mcp_json_elements(Args, Vars, '', _), write(']}')
+    ;   with_output_to(string(Text), print(T)),
+        write('{"type":"opaque","text":'), logic_mcp_json_string(Text), write('}')
+    ).
+
+logic_mcp_json_elements(T, Vars, Sep, Tail) :-
+    (   nonvar(T), T = [H|Rest] ->
+        write(Sep),
+        logic_mcp_json(H, Vars),
+        logic_mcp_json_elements(Rest, Vars, ',', Tail)
+    ;   Tail = T
+    ).
+
+logic_mcp_json_var_index([V|Vs], T, I0, I) :-
+    (   V == T -> I = I0
+    ;   I1 is I0 + 1, logic_mcp_json_var_index(Vs, T, I1, I)
+    ).
+
+logic_mcp_json_float(F) :-
+    float_class(F, Class),
+    (   Class == nan -> write('{"type":"float","value":"nan"}')
+    ;   Class == infinite, F > 0 -> write('{"type":"float","value":"inf"}')
+    ;   Class == infinite -> write('{"type":"float","value":"-inf"}')
+    ;   format('{"type":"float","value":~w}', [F])
+    ).
+
+logic_mcp_json_string(Text) :-
+    atom_codes(Text, Codes),
+    put_char('"'),
+    forall(member(C, Codes), logic_mcp_json_char(C)),
+    put_char('"').
+
+logic_mcp_json_char(0'") :- !, write('\\"').
+logic_mcp_json_char(0'\\) :- !, write('\\\\').
+logic_mcp_json_char(C) :-
+    C > 0xFFFF, !,
+    High is 0xD800 + ((C - 0x10000) >> 10),
+    Low is 0xDC00 + ((C - 0x10000) /\ 0x3FF),
+    logic_mcp_json_escape(High),
+    logic_mcp_json_escape(Low).
+logic_mcp_json_char(C) :-
+    ( C < 0x20 ; C > 0x7E ), !,
+    logic_mcp_json_escape(C).
+logic_mcp_json_char(C) :-
+    put_code(C).
+
+logic_mcp_json_escape(C) :-
+    D1 is (C >> 12) /\ 15, D2 is (C >> 8) /\ 15,
+    D3 is (C >> 4) /\ 15, D4 is C /\ 15,
+    format('\\u~16r~16r~16r~16r', [D1, D2, D3, D4]).
+`
@@ -0,0 +1,398 @@
+package termjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// Term is a Prolog term. The concrete types are Atom, String, *Integer,
+// Float, *Compound, *List, Variable, Cyclic and Opaque.
+type Term interface {
+	isTerm()
+}
+
+// Atom is a Prolog atom. The empty list is a *List, not the atom '[]'.
+type Atom string
+
+// String is a Prolog string, written with double quotes
+type String string
+
+// Integer is a Prolog integer of any size
+type Integer struct {
+	Value *big.Int
+}
+
+// Float is a Prolog float, including infinities and NaN
+type Float float64
+
+// Compound is a compound term. Zero arguments is valid: foo() is not foo.
+type Compound struct {
+	Functor string
+	Args    []Term
+}
+
+// List is a list of elements. A nil Tail closes the list with []; any other
+// tail makes a partial list such as [a|T] or an improper one such as [a|b].
+type List struct {
+	Elements []Term
+	Tail     Term
+}
+
+// Variable is an unbound variable. Occurrences with the same name are the
+// same variable, except for the anonymous variable "_".
+type Variable string
+
+// Cyclic is a rational tree reported by Prolog. Text is its factorized form,
+// e.g. @(A,[A=f(A)]); it cannot be converted back to a term.
+type Cyclic struct {
+	Text string
+}
+
+// Opaque is a term without a portable representation, such as a stream
+// handle or a dict, kept as the text Prolog printed for it
+type Opaque struct {
+	Text string
+}
+
+func (Atom) isTerm()      {}
+func (String) isTerm()    {}
+func (*Integer) isTerm()  {}
+func (Float) isTerm()     {}
+func (*Compound) isTerm() {}
+func (*List) isTerm()     {}
+func (Variable) isTerm()  {}
+func (Cyclic) isTerm()    {}
+func (Opaque) isTerm()    {}
+
+// ErrCyclic is returned when a Go term refers to itself
+var ErrCyclic = errors.New("term is cyclic")
+
+// Int returns n as an Integer
+func Int(n int64) *Integer {
+	return &Integer{Value: big.NewInt(n)}
+}
+
+// NewCompound returns the compound term functor(args...)
+func NewCompound(functor string, args ...Term) *Compound {
+	if args == nil {
+		args = []Term{}
+	}
+	return &Compound{Functor: functor, Args: args}
+}
+
+// NewList returns the closed list of elements
+func NewList(elements ...Term) *List {
+	return &List{Elements: elements}
+}
+
+// Equal reports whether two terms are identical. Floats compare by bits,
+// so 0.0 and -0.0 differ, but all NaNs are equal.
+func Equal(a, b Term) bool {
+	switch a := a.(type) {
+	case *Integer:
+		b, ok := b.(*Integer)
+		return ok && a.Value.Cmp(b.Value) == 0
+	case Float:
+		b, ok := b.(Float)
+		if !ok {
+			return false
+		}
+		if math.IsNaN(float64(a)) {
+			return math.IsNaN(float64(b))
+		}
+		return math.Float64bits(float64(a)) == math.Float64bits(float64(b))
+	case *Compound:
+		b, ok := b.(*Compound)
+		return ok && a.Functor == b.Functor && equalAll(a.Args, b.Args)
+	case *List:
+		b, ok := b.(*List)
+		if !ok || !equalAll(a.Elements, b.Elements) {
+			return false
+		}
+		if a.Tail == nil || b.Tail == nil {
+			return a.Tail == nil && b.Tail == nil
+		}
+		return Equal(a.Tail, b.Tail)
+	default:
+		return a == b
+	}
+}
+
+func equalAll(a, b []Term) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// maxSafeInteger is the largest integer a JSON number carries exactly in
+// JavaScript; larger integers are encoded as decimal strings
+var maxSafeInteger = big.NewInt(1<<53 - 1)
+
+// Encode converts a term to tagged JSON:
+//
+//	{"type":"atom","value":"foo"}
+//	{"type":"string","value":"foo"}
+//	{"type":"integer","value":42}  (a decimal string beyond ±2^53-1)
+//	{"type":"float","value":1.5}   ("inf", "-inf" or "nan" when not finite)
+//	{"type":"compound","functor":"f","args":[...]}
+//	{"type":"list","elements":[...],"tail":...}  (no tail when closed)
+//	{"type":"var","name":"_0"}
+//	{"type":"cyclic","text":"@(A,[A=f(A)])"}
+//	{"type":"opaque","text":"<stream>(0x600)"}
+func Encode(t Term) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encode(&buf, t, map[Term]bool{}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encode writes t; path holds the compound terms and lists being written
+func encode(buf *bytes.Buffer, t Term, path map[Term]bool) error {
+	switch t := t.(type) {
+	case Atom:
+		writeTagged(buf, "atom", "value", string(t))
+	case String:
+		writeTagged(buf, "string", "value", string(t))
+	case *Integer:
+		if t == nil || t.Value == nil {
+			return errors.New("integer has no value")
+		}
+		if new(big.Int).Abs(t.Value).Cmp(maxSafeInteger) <= 0 {
+			fmt.Fprintf(buf, `{"type":"integer","value":%s}`, t.Value)
+		} else {
+			fmt.Fprintf(buf, `{"type":"integer","value":"%s"}`, t.Value)
+		}
+	case Float:
+		f := float64(t)
+		switch {
+		case math.IsNaN(f):
+			buf.WriteString(`{"type":"float","value":"nan"}`)
+		case math.IsInf(f, 1):
+			buf.WriteString(`{"type":"float","value":"inf"}`)
+		case math.IsInf(f, -1):
+			buf.WriteString(`{"type":"float","value":"-inf"}`)
+		default:
+			fmt.Fprintf(buf, `{"type":"float","value":%s}`, strconv.FormatFloat(f, 'g', -1, 64))
+		}
+	case *Compound:
+		if path[t] {
+			return ErrCyclic
+		}
+		path[t] = true
+		defer delete(path, t)
+
+		buf.WriteString(`{"type":"compound","functor":`)
+		writeString(buf, t.Functor)
+		buf.WriteString(`,"args":`)
+		if err := encodeAll(buf, t.Args, path); err != nil {
+			return err
+		}
+		buf.WriteByte('}')
+	case *List:
+		if path[t] {
+			return ErrCyclic
+		}
+		path[t] = true
+		defer delete(path, t)
+
+		buf.WriteString(`{"type":"list","elements":`)
+		if err := encodeAll(buf, t.Elements, path); err != nil {
+			return err
+		}
+		if t.Tail != nil {
+			buf.WriteString(`,"tail":`)
+			if err := encode(buf, t.Tail, path); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case Variable:
+		writeTagged(buf, "var", "name", string(t))
+	case Cyclic:
+		writeTagged(buf, "cyclic", "text", t.Text)
+	case Opaque:
+		writeTagged(buf, "opaque", "text", t.Text)
+	default:
+		return fmt.Errorf("unsupported term type %T", t)
+	}
+	return nil
+}
+
+func encodeAll(buf *bytes.Buffer, terms []Term, path map[Term]bool) error {
+	buf.WriteByte('[')
+	for i, t := range terms {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := encode(buf, t, path); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte(']')
+	return nil
+}
+
+func writeTagged(buf *bytes.Buffer, typ, key, value string) {
+	fmt.Fprintf(buf, `{"type":%q,%q:`, typ, key)
+	writeString(buf, value)
+	buf.WriteByte('}')
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	b, _ := json.Marshal(s) // strings always marshal
+	buf.Write(b)
+}
+
+// wire is the union of the fields of all tagged JSON objects
+type wire struct {
+	Type     string            `json:"type"`
+	Value    json.RawMessage   `json:"value"`
+	Name     *string           `json:"name"`
+	Functor  *string           `json:"functor"`
+	Args     []json.RawMessage `json:"args"`
+	Elements []json.RawMessage `json:"elements"`
+	Tail     json.RawMessage   `json:"tail"`
+	Text     *string           `json:"text"`
+}
+
+// Decode converts tagged JSON, as produced by Encode, to a term
+func Decode(data []byte) (Term, error) {
+	var w wire
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&w); err != nil {
+		return nil, fmt.Errorf("invalid term: %w", err)
+	}
+
+	switch w.Type {
+	case "atom":
+		s, err := decodeString(w.Value)
+		return Atom(s), err
+	case "string":
+		s, err := decodeString(w.Value)
+		return String(s), err
+	case "integer":
+		return decodeInteger(w.Value)
+	case "float":
+		return decodeFloat(w.Value)
+	case "compound":
+		if w.Functor == nil {
+			return nil, errors.New(`compound term has no "functor"`)
+		}
+		if w.Args == nil {
+			return nil, errors.New(`compound term has no "args"`)
+		}
+		args, err := decodeAll(w.Args)
+		if err != nil {
+			return nil, err
+		}
+		return &Compound{Functor: *w.Functor, Args: args}, nil
+	case "list":
+		elements, err := decodeAll(w.Elements)
+		if err != nil {
+			return nil, err
+		}
+		list := &List{Elements: elements}
+		if len(w.Tail) > 0 && string(w.Tail) != "null" {
+			if list.Tail, err = Decode(w.Tail); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case "var":
+		if w.Name == nil || *w.Name == "" {
+			return nil, errors.New(`variable has no "name"`)
+		}
+		return Variable(*w.Name), nil
+	case "cyclic", "opaque":
+		if w.Text == nil {
+			return nil, fmt.Errorf(`%s term has no "text"`, w.Type)
+		}
+		if w.Type == "cyclic" {
+			return Cyclic{Text: *w.Text}, nil
+		}
+		return Opaque{Text: *w.Text}, nil
+	case "":
+		return nil, errors.New(`term has no "type"`)
+	default:
+		return nil, fmt.Errorf("unknown term type %q", w.Type)
+	}
+}
+
+func decodeAll(raw []json.RawMessage) ([]Term, error) {
+	terms := make([]Term, len(raw))
+	for i, r := range raw {
+		t, err := Decode(r)
+		if err != nil {
+			return nil, err
+		}
+		terms[i] = t
+	}
+	return terms, nil
+}
+
+func decodeString(raw json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", fmt.Errorf(`"value" must be a string: %w`, err)
+	}
+	return s, nil
+}
+
+func decodeInteger(raw json.RawMessage) (Term, error) {
+	text := string(raw)
+	if len(text) > 0 && text[0] == '"' {
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return nil, err
+		}
+	}
+	n, ok := new(big.Int).SetString(text, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid integer %s", raw)
+	}
+	return &Integer{Value: n}, nil
+}
+
+func decodeFloat(raw json.RawMessage) (Term, error) {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		switch s {
+		case "inf":
+			return Float(math.Inf(1)), nil
+		case "-inf":
+			return Float(math.Inf(-1)), nil
+		case "nan":
+			return Float(math.NaN()), nil
+		}
+		return nil, fmt.Errorf("invalid float %q", s)
+	}
+	f, err := strconv.ParseFloat(string(raw), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid float %s", raw)
+	}
+	return Float(f), nil
+}
+
+// MarshalJSON implementations let terms appear in encoded Go values
+
+func (t Atom) MarshalJSON() ([]byte, error)      { return Encode(t) }
+func (t String) MarshalJSON() ([]byte, error)    { return Encode(t) }
+func (t *Integer) MarshalJSON() ([]byte, error)  { return Encode(t) }
+func (t Float) MarshalJSON() ([]byte, error)     { return Encode(t) }
+func (t *Compound) MarshalJSON() ([]byte, error) { return Encode(t) }
+func (t *List) MarshalJSON() ([]byte, error)     { return Encode(t) }
+func (t Variable) MarshalJSON() ([]byte, error)  { return Encode(t) }
+func (t Cyclic) MarshalJSON() ([]byte, error)    { return Encode(t) }
+func (t Opaque) MarshalJSON() ([]byte, error)    { return Encode(t) }
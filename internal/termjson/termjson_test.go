@@ -0,0 +1,206 @@
+package termjson
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// randomTerm generates terms covering every writable kind
+type randomTerm struct {
+	r *rand.Rand
+}
+
+var sampleTexts = []string{"", "a", "foo_Bar1", "Hello World", "it's", `say "hi"`, "back\\slash",
+	"tab\tnew\nline", "[]", "{}", "-", "=..", ";", "!", ",", "|", "café", "日本", "😀", "\x01\x7f", "%not a comment"}
+
+func (g randomTerm) text() string {
+	if g.r.Intn(3) == 0 {
+		runes := make([]rune, g.r.Intn(6))
+		for i := range runes {
+			runes[i] = rune(g.r.Intn(0x2000) + 1)
+		}
+		return string(runes)
+	}
+	return sampleTexts[g.r.Intn(len(sampleTexts))]
+}
+
+func (g randomTerm) term(depth int) Term {
+	kinds := 6
+	if depth > 0 {
+		kinds = 8
+	}
+	switch g.r.Intn(kinds) {
+	case 0:
+		return Atom(g.text())
+	case 1:
+		return String(g.text())
+	case 2:
+		switch g.r.Intn(3) {
+		case 0:
+			return Int(g.r.Int63n(2000) - 1000)
+		case 1:
+			return Int(g.r.Int63() - g.r.Int63())
+		default:
+			n := new(big.Int).Lsh(big.NewInt(g.r.Int63()), uint(g.r.Intn(200)))
+			if g.r.Intn(2) == 0 {
+				n.Neg(n)
+			}
+			return &Integer{Value: n}
+		}
+	case 3:
+		floats := []float64{0, math.Copysign(0, -1), 1.5, -2.25, 1e21, 1e-7, math.MaxFloat64,
+			math.SmallestNonzeroFloat64, math.Inf(1), math.Inf(-1), math.NaN()}
+		if g.r.Intn(2) == 0 {
+			return Float(g.r.NormFloat64() * math.Pow(10, float64(g.r.Intn(40)-20)))
+		}
+		return Float(floats[g.r.Intn(len(floats))])
+	case 4:
+		return Variable([]string{"_", "_0", "_12", "X", "Xs", "_Foo"}[g.r.Intn(6)])
+	case 5:
+		return NewList()
+	case 6:
+		args := make([]Term, g.r.Intn(4))
+		for i := range args {
+			args[i] = g.term(depth - 1)
+		}
+		return NewCompound(g.text(), args...)
+	default:
+		list := &List{}
+		for i := 0; i < g.r.Intn(4)+1; i++ {
+			list.Elements = append(list.Elements, g.term(depth-1))
+		}
+		switch g.r.Intn(3) {
+		case 0:
+			list.Tail = Variable("T")
+		case 1:
+			list.Tail = Atom(g.text())
+		}
+		return list
+	}
+}
+
+func TestRoundTrip_JSON(t *testing.T) {
+	g := randomTerm{rand.New(rand.NewSource(1))}
+	for i := 0; i < 2000; i++ {
+		term := g.term(4)
+		data, err := Encode(term)
+		require.NoError(t, err)
+		require.True(t, json.Valid(data), "%s", data)
+
+		decoded, err := Decode(data)
+		require.NoError(t, err, "%s", data)
+		require.True(t, Equal(term, decoded), "%s", data)
+	}
+}
+
+func TestRoundTrip_Text(t *testing.T) {
+	g := randomTerm{rand.New(rand.NewSource(2))}
+	for i := 0; i < 2000; i++ {
+		term := g.term(4)
+		text, err := Format(term)
+		require.NoError(t, err)
+
+		parsed, err := Parse(text)
+		require.NoError(t, err, text)
+		require.True(t, Equal(term, parsed), text)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	big, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+	term := NewCompound("point",
+		Atom("a"), String("a"), Int(42), &Integer{Value: big}, Float(1.5), Float(math.Inf(-1)),
+		&List{Elements: []Term{Int(1)}, Tail: Variable("_0")}, NewList(), Variable("_0"))
+
+	data, err := Encode(term)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"compound","functor":"point","args":[
+		{"type":"atom","value":"a"},
+		{"type":"string","value":"a"},
+		{"type":"integer","value":42},
+		{"type":"integer","value":"-123456789012345678901234567890"},
+		{"type":"float","value":1.5},
+		{"type":"float","value":"-inf"},
+		{"type":"list","elements":[{"type":"integer","value":1}],"tail":{"type":"var","name":"_0"}},
+		{"type":"list","elements":[]},
+		{"type":"var","name":"_0"}]}`, string(data))
+
+	// Terms embed in other JSON values
+	data, err = json.Marshal(map[string]Term{"X": Atom("[]"), "Y": Cyclic{Text: "@(A,[A=f(A)])"}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"X":{"type":"atom","value":"[]"},"Y":{"type":"cyclic","text":"@(A,[A=f(A)])"}}`, string(data))
+}
+
+func TestCyclicGoTerms(t *testing.T) {
+	c := NewCompound("f", Atom("a"), nil)
+	c.Args[1] = c
+	_, err := Encode(c)
+	assert.ErrorIs(t, err, ErrCyclic)
+	_, err = Format(c)
+	assert.ErrorIs(t, err, ErrCyclic)
+
+	// Shared subterms are not cycles
+	shared := NewList(Atom("x"))
+	text, err := Format(NewCompound("g", shared, shared))
+	require.NoError(t, err)
+	assert.Equal(t, "g([x],[x])", text)
+
+	_, err = Format(Cyclic{Text: "@(A,[A=f(A)])"})
+	assert.Error(t, err)
+}
+
+func TestParse(t *testing.T) {
+	tests := map[string]Term{
+		"foo.":                       Atom("foo"),
+		"'hello world'":              Atom("hello world"),
+		"'it''s'":                    Atom("it's"),
+		`"a\x41\\101\"`:              String("aAA"),
+		"0'a":                        Int('a'),
+		"0' ":                        Int(' '),
+		"0'\\n":                      Int('\n'),
+		"0x1F":                       Int(31),
+		"-0b101":                     Int(-5),
+		"1.0e10":                     Float(1e10),
+		"-1.0Inf":                    Float(math.Inf(-1)),
+		"f()":                        NewCompound("f"),
+		"-(1)":                       NewCompound("-", Int(1)),
+		"{a, b}":                     NewCompound("{}", NewCompound(",", Atom("a"), Atom("b"))),
+		"[a, b | [c]]":               NewList(Atom("a"), Atom("b"), Atom("c")),
+		"[H|T]":                      &List{Elements: []Term{Variable("H")}, Tail: Variable("T")},
+		"`ab`":                       NewList(Int('a'), Int('b')),
+		"f( % comment\n /* c */ a )": NewCompound("f", Atom("a")),
+		"'\\u00e9\\U0001F600'":       Atom("é😀"),
+	}
+	for text, want := range tests {
+		got, err := Parse(text)
+		require.NoError(t, err, text)
+		assert.True(t, Equal(want, got), "%s: got %#v", text, got)
+	}
+
+	for _, text := range []string{"a-1", "- (1)", "f(a", "'open", "[a,]", "", "f(,)", `"\q"`} {
+		_, err := Parse(text)
+		assert.Error(t, err, text)
+	}
+}
+
+func TestDecode_Errors(t *testing.T) {
+	for _, data := range []string{
+		`{}`,
+		`{"type":"atom","value":1}`,
+		`{"type":"integer","value":"1.5"}`,
+		`{"type":"float","value":"infinity"}`,
+		`{"type":"compound","args":[]}`,
+		`{"type":"var"}`,
+		`{"type":"tuple"}`,
+		`{"type":"atom","value":"a","extra":1}`,
+	} {
+		_, err := Decode([]byte(data))
+		assert.Error(t, err, data)
+	}
+}
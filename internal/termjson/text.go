@@ -0,0 +1,642 @@
+package termjson
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	plainAtom    = regexp.MustCompile(`^[a-z][a-zA-Z0-9_]*$`)
+	variableName = regexp.MustCompile(`^[_A-Z][a-zA-Z0-9_]*$`)
+)
+
+// Format writes a term in canonical Prolog syntax, as write_canonical/1
+// would: operators are written as compound terms, e.g. -(a,1), and
+// variables keep their names. Cyclic and opaque terms cannot be written.
+func Format(t Term) (string, error) {
+	var b strings.Builder
+	if err := format(&b, t, map[Term]bool{}); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func format(b *strings.Builder, t Term, path map[Term]bool) error {
+	switch t := t.(type) {
+	case Atom:
+		b.WriteString(quoteAtom(string(t)))
+	case String:
+		b.WriteString(quote(string(t), '"'))
+	case *Integer:
+		if t == nil || t.Value == nil {
+			return errors.New("integer has no value")
+		}
+		b.WriteString(t.Value.String())
+	case Float:
+		b.WriteString(formatFloat(float64(t)))
+	case *Compound:
+		if path[t] {
+			return ErrCyclic
+		}
+		path[t] = true
+		defer delete(path, t)
+
+		b.WriteString(quoteAtom(t.Functor))
+		b.WriteByte('(')
+		if err := formatAll(b, t.Args, path); err != nil {
+			return err
+		}
+		b.WriteByte(')')
+	case *List:
+		if path[t] {
+			return ErrCyclic
+		}
+		path[t] = true
+		defer delete(path, t)
+
+		b.WriteByte('[')
+		if err := formatAll(b, t.Elements, path); err != nil {
+			return err
+		}
+		if t.Tail != nil {
+			if len(t.Elements) == 0 {
+				return errors.New("list with a tail has no elements")
+			}
+			b.WriteByte('|')
+			if err := format(b, t.Tail, path); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+	case Variable:
+		if !variableName.MatchString(string(t)) {
+			return fmt.Errorf("invalid variable name %q", string(t))
+		}
+		b.WriteString(string(t))
+	case Cyclic:
+		return fmt.Errorf("cyclic term %s cannot be written as text", t.Text)
+	case Opaque:
+		return fmt.Errorf("opaque term %s cannot be written as text", t.Text)
+	default:
+		return fmt.Errorf("unsupported term type %T", t)
+	}
+	return nil
+}
+
+func formatAll(b *strings.Builder, terms []Term, path map[Term]bool) error {
+	for i, t := range terms {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		if err := format(b, t, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatFloat writes f so that Prolog reads it back as the same float
+func formatFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "1.5NaN"
+	case math.IsInf(f, 1):
+		return "1.0Inf"
+	case math.IsInf(f, -1):
+		return "-1.0Inf"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	// Prolog floats need a fraction before the exponent
+	mant, exp, hasExp := strings.Cut(s, "e")
+	if !strings.Contains(mant, ".") {
+		mant += ".0"
+	}
+	if hasExp {
+		return mant + "e" + exp
+	}
+	return mant
+}
+
+func quoteAtom(s string) string {
+	if plainAtom.MatchString(s) {
+		return s
+	}
+	return quote(s, '\'')
+}
+
+func quote(s string, q byte) string {
+	var b strings.Builder
+	b.WriteByte(q)
+	for _, r := range s {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == rune(q):
+			b.WriteByte('\\')
+			b.WriteByte(q)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\x%x\`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte(q)
+	return b.String()
+}
+
+// Parse reads one term in canonical Prolog syntax, the inverse of Format.
+// Operators are not supported except for the sign of a number; a final
+// full stop is optional.
+func Parse(text string) (Term, error) {
+	p := &parser{src: text}
+	t, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	p.skipLayout()
+	if p.peek() == '.' {
+		p.pos++
+		p.skipLayout()
+	}
+	if p.pos < len(p.src) {
+		return nil, p.errorf("unexpected %q after the term (operators are not supported, write e.g. -(a,1) instead of a-1)", p.rest())
+	}
+	return t, nil
+}
+
+type parser struct {
+	src string
+	pos int
+}
+
+// SyntaxError reports where a text could not be parsed
+type SyntaxError struct {
+	Offset int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at offset %d: %s", e.Offset, e.Msg)
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return &SyntaxError{Offset: p.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *parser) peekAt(i int) byte {
+	if p.pos+i < len(p.src) {
+		return p.src[p.pos+i]
+	}
+	return 0
+}
+
+// rest returns a short excerpt of the unparsed text
+func (p *parser) rest() string {
+	r := p.src[p.pos:]
+	if len(r) > 20 {
+		r = r[:20] + "..."
+	}
+	return r
+}
+
+// skipLayout skips white space and comments
+func (p *parser) skipLayout() {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v':
+			p.pos++
+		case c == '%':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case c == '/' && p.peekAt(1) == '*':
+			end := strings.Index(p.src[p.pos+2:], "*/")
+			if end < 0 {
+				p.pos = len(p.src)
+				return
+			}
+			p.pos += end + 4
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) expect(c byte) error {
+	p.skipLayout()
+	if p.peek() != c {
+		if p.pos >= len(p.src) {
+			return p.errorf("expected %q, got end of text", c)
+		}
+		return p.errorf("expected %q, got %q", c, p.rest())
+	}
+	p.pos++
+	return nil
+}
+
+func (p *parser) term() (Term, error) {
+	p.skipLayout()
+	c := p.peek()
+	switch {
+	case p.pos >= len(p.src):
+		return nil, p.errorf("unexpected end of text")
+	case isDigit(c):
+		return p.number(false)
+	case c == '-' && isDigit(p.peekAt(1)):
+		p.pos++
+		return p.number(true)
+	case c == '_' || c >= 'A' && c <= 'Z':
+		start := p.pos
+		p.scanAlnum()
+		return Variable(p.src[start:p.pos]), nil
+	case c == '"':
+		s, err := p.quoted('"')
+		return String(s), err
+	case c == '`':
+		s, err := p.quoted('`')
+		if err != nil {
+			return nil, err
+		}
+		codes := []Term{}
+		for _, r := range s {
+			codes = append(codes, Int(int64(r)))
+		}
+		return NewList(codes...), nil
+	case c == '[':
+		p.pos++
+		p.skipLayout()
+		if p.peek() == ']' {
+			p.pos++
+			return NewList(), nil
+		}
+		return p.list()
+	case c == '{':
+		p.pos++
+		p.skipLayout()
+		if p.peek() == '}' {
+			p.pos++
+			return p.compoundOrAtom("{}")
+		}
+		args, err := p.args('}')
+		if err != nil {
+			return nil, err
+		}
+		// {a,b} is {}(','(a,b))
+		arg := args[len(args)-1]
+		for i := len(args) - 2; i >= 0; i-- {
+			arg = NewCompound(",", args[i], arg)
+		}
+		return NewCompound("{}", arg), nil
+	default:
+		name, err := p.atom()
+		if err != nil {
+			return nil, err
+		}
+		return p.compoundOrAtom(name)
+	}
+}
+
+// compoundOrAtom reads the arguments following a functor, if any. The
+// opening parenthesis must follow the name directly.
+func (p *parser) compoundOrAtom(name string) (Term, error) {
+	if p.peek() != '(' {
+		return Atom(name), nil
+	}
+	p.pos++
+	p.skipLayout()
+	if p.peek() == ')' {
+		p.pos++
+		return NewCompound(name), nil
+	}
+	args, err := p.args(')')
+	if err != nil {
+		return nil, err
+	}
+	return NewCompound(name, args...), nil
+}
+
+// args reads comma-separated terms up to the closing character
+func (p *parser) args(closing byte) ([]Term, error) {
+	var args []Term
+	for {
+		t, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, t)
+		p.skipLayout()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case closing:
+			p.pos++
+			return args, nil
+		default:
+			return nil, p.errorf("expected ',' or %q, got %q", closing, p.rest())
+		}
+	}
+}
+
+// list reads the elements and tail of a non-empty list after the '['
+func (p *parser) list() (Term, error) {
+	list := &List{}
+	for {
+		t, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		list.Elements = append(list.Elements, t)
+		p.skipLayout()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '|':
+			p.pos++
+			tail, err := p.term()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(']'); err != nil {
+				return nil, err
+			}
+			// [a|[b]] is [a,b]
+			if rest, ok := tail.(*List); ok {
+				list.Elements = append(list.Elements, rest.Elements...)
+				tail = rest.Tail
+			}
+			list.Tail = tail
+			return list, nil
+		case ']':
+			p.pos++
+			return list, nil
+		default:
+			return nil, p.errorf("expected ',', '|' or ']', got %q", p.rest())
+		}
+	}
+}
+
+func (p *parser) atom() (string, error) {
+	c := p.peek()
+	start := p.pos
+	switch {
+	case c >= 'a' && c <= 'z':
+		p.scanAlnum()
+		return p.src[start:p.pos], nil
+	case c == '\'':
+		return p.quoted('\'')
+	case c == '!' || c == ';':
+		p.pos++
+		return p.src[start:p.pos], nil
+	case isSymbolChar(c):
+		for isSymbolChar(p.peek()) {
+			p.pos++
+		}
+		return p.src[start:p.pos], nil
+	default:
+		r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+		return "", p.errorf("unexpected %q", r)
+	}
+}
+
+func (p *parser) scanAlnum() {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if !(c == '_' || isDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return
+		}
+		p.pos++
+	}
+}
+
+// quoted reads a quoted atom, string or code list after its opening quote
+func (p *parser) quoted(q byte) (string, error) {
+	start := p.pos
+	p.pos++
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.src) {
+			p.pos = start
+			return "", p.errorf("unterminated quoted text")
+		}
+		c := p.src[p.pos]
+		switch {
+		case c == q && p.peekAt(1) == q:
+			b.WriteByte(q)
+			p.pos += 2
+		case c == q:
+			p.pos++
+			return b.String(), nil
+		case c == '\\':
+			p.pos++
+			if p.peek() == '\n' { // continuation line
+				p.pos++
+				continue
+			}
+			r, err := p.escape()
+			if err != nil {
+				return "", err
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+// escape reads an escape sequence after the backslash
+func (p *parser) escape() (rune, error) {
+	c := p.peek()
+	p.pos++
+	switch c {
+	case 'n':
+		return '\n', nil
+	case 't':
+		return '\t', nil
+	case 'r':
+		return '\r', nil
+	case 'a':
+		return '\a', nil
+	case 'b':
+		return '\b', nil
+	case 'f':
+		return '\f', nil
+	case 'v':
+		return '\v', nil
+	case 'e':
+		return 0x1b, nil
+	case 's':
+		return ' ', nil
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		p.pos--
+		return p.codeEscape(8, "01234567")
+	case 'x':
+		return p.codeEscape(16, "0123456789abcdefABCDEF")
+	case 'u', 'U':
+		digits := 4
+		if c == 'U' {
+			digits = 8
+		}
+		if p.pos+digits > len(p.src) {
+			return 0, p.errorf("incomplete \\%c escape", c)
+		}
+		n, err := strconv.ParseUint(p.src[p.pos:p.pos+digits], 16, 32)
+		if err != nil {
+			return 0, p.errorf("invalid \\%c escape", c)
+		}
+		p.pos += digits
+		return rune(n), nil
+	case '\\', '\'', '"', '`':
+		return rune(c), nil
+	default:
+		return 0, p.errorf("unknown escape sequence \\%c", c)
+	}
+}
+
+// codeEscape reads the digits of an octal or hex escape and its closing
+// backslash
+func (p *parser) codeEscape(base int, digits string) (rune, error) {
+	start := p.pos
+	for p.pos < len(p.src) && strings.IndexByte(digits, p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+	n, err := strconv.ParseUint(p.src[start:p.pos], base, 32)
+	if err != nil || n > utf8.MaxRune {
+		return 0, p.errorf("invalid character code escape")
+	}
+	if p.peek() != '\\' {
+		return 0, p.errorf("character code escape must end with a backslash")
+	}
+	p.pos++
+	return rune(n), nil
+}
+
+// number reads an integer or float; the sign has been consumed
+func (p *parser) number(negative bool) (Term, error) {
+	start := p.pos
+	sign := ""
+	if negative {
+		sign = "-"
+	}
+
+	// Special integer notations: 0'c, 0x1f, 0o17 and 0b101
+	if p.peek() == '0' {
+		switch p.peekAt(1) {
+		case '\'':
+			p.pos += 2
+			r, err := p.charCode()
+			if err != nil {
+				return nil, err
+			}
+			if negative {
+				r = -r
+			}
+			return Int(int64(r)), nil
+		case 'x', 'o', 'b':
+			base := map[byte]int{'x': 16, 'o': 8, 'b': 2}[p.peekAt(1)]
+			p.pos += 2
+			digitsStart := p.pos
+			for p.pos < len(p.src) && isBaseDigit(p.src[p.pos], base) {
+				p.pos++
+			}
+			if n, ok := new(big.Int).SetString(sign+p.src[digitsStart:p.pos], base); ok {
+				return &Integer{Value: n}, nil
+			}
+			return nil, p.errorf("invalid number %q", p.src[start:p.pos])
+		}
+	}
+
+	p.scanDigits()
+	isFloat := false
+	if p.peek() == '.' && isDigit(p.peekAt(1)) {
+		isFloat = true
+		p.pos++
+		p.scanDigits()
+	}
+	if c := p.peek(); c == 'e' || c == 'E' {
+		next := p.peekAt(1)
+		if isDigit(next) || (next == '+' || next == '-') && isDigit(p.peekAt(2)) {
+			isFloat = true
+			p.pos += 2
+			p.scanDigits()
+		}
+	}
+	text := p.src[start:p.pos]
+
+	if isFloat {
+		switch {
+		case strings.HasPrefix(p.src[p.pos:], "Inf"):
+			p.pos += 3
+			if negative {
+				return Float(math.Inf(-1)), nil
+			}
+			return Float(math.Inf(1)), nil
+		case strings.HasPrefix(p.src[p.pos:], "NaN"):
+			p.pos += 3
+			return Float(math.NaN()), nil
+		}
+		f, err := strconv.ParseFloat(sign+text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid float %q", sign+text)
+		}
+		return Float(f), nil
+	}
+	n, _ := new(big.Int).SetString(sign+text, 10)
+	return &Integer{Value: n}, nil
+}
+
+// charCode reads the character of a 0'c literal
+func (p *parser) charCode() (rune, error) {
+	switch c := p.peek(); {
+	case p.pos >= len(p.src):
+		return 0, p.errorf("incomplete character code")
+	case c == '\\':
+		p.pos++
+		return p.escape()
+	case c == '\'' && p.peekAt(1) == '\'':
+		p.pos += 2
+		return '\'', nil
+	default:
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.pos += size
+		return r, nil
+	}
+}
+
+func (p *parser) scanDigits() {
+	for isDigit(p.peek()) {
+		p.pos++
+	}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isBaseDigit(c byte, base int) bool {
+	n, err := strconv.ParseUint(string(c), base, 8)
+	return err == nil && int(n) < base
+}
+
+func isSymbolChar(c byte) bool {
+	return strings.IndexByte(`+-*/\^<>=~:.?@#&$`, c) >= 0
+}
@@ -0,0 +1,311 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/tomasz-sikora/logic-mcp/internal/metrics"
+	"github.com/tomasz-sikora/logic-mcp/internal/prolog"
+	"github.com/tomasz-sikora/logic-mcp/internal/quota"
+	"github.com/tomasz-sikora/logic-mcp/internal/termjson"
+)
+
+// Batch limits
+const (
+	defaultBatchConcurrency = 4
+	maxBatchConcurrency     = 16
+	maxBatchQueries         = 1000
+)
+
+// Expected outcomes of a batch query
+const (
+	OutcomeSucceeds = "succeeds"
+	OutcomeFails    = "fails"
+)
+
+// Expectation is what a batch query should produce. Empty fields are not
+// checked; without any, a query passes unless it raises an error.
+type Expectation struct {
+	Outcome   string            `json:"outcome,omitempty" jsonschema:"succeeds or fails (optional; implied succeeds when bindings or a positive solution count are given)."`
+	Bindings  map[string]string `json:"bindings,omitempty" jsonschema:"Variable bindings as Prolog text that at least one solution must have, e.g. {\"X\": \"[1, 2]\"}."`
+	Solutions *int              `json:"solutions,omitempty" jsonschema:"Exact number of solutions (optional). Counts stop at the solution limit."`
+}
+
+// BatchQuery is one query of prolog_batch
+type BatchQuery struct {
+	Query  string       `json:"query"`
+	Expect *Expectation `json:"expect,omitempty"`
+}
+
+// BatchResult is the outcome of one batch query
+type BatchResult struct {
+	Index         int        `json:"index" jsonschema:"Position of the query in the batch, from 1."`
+	Query         string     `json:"query"`
+	Passed        bool       `json:"passed"`
+	Reason        string     `json:"reason,omitempty" jsonschema:"Why the query did not pass."`
+	Success       bool       `json:"success" jsonschema:"The query had at least one solution."`
+	Solutions     int        `json:"solutions"`
+	MoreSolutions bool       `json:"more_solutions,omitempty"`
+	Error         *ToolError `json:"error,omitempty"`
+	ExecutionMS   float64    `json:"execution_time_ms"`
+}
+
+// BatchOutput is the result of prolog_batch. success is true when every
+// query passed.
+type BatchOutput struct {
+	Status
+	Passed        int                `json:"passed"`
+	Failed        int                `json:"failed"`
+	NotRun        int                `json:"not_run,omitempty" jsonschema:"Number of queries not run because a quota refused the batch; the error says which."`
+	Results       []BatchResult      `json:"results,omitempty" jsonschema:"One result per query run, in order."`
+	ExecutionMS   float64            `json:"execution_time_ms"`
+	KnowledgeBase KnowledgeBaseStats `json:"knowledge_base"`
+}
+
+// registerBatchTools registers the tool that runs regression suites
+func (lt *LogicTools) registerBatchTools(server *mcp.Server) {
+	type BatchInput struct {
+		Queries     []BatchQuery `json:"queries" jsonschema:"The queries to run, each with an optional expected outcome."`
+		Concurrency int          `json:"concurrency,omitempty" jsonschema:"Number of queries run in parallel (optional, defaults to 4, at most 16)."`
+	}
+
+	// Register prolog_batch tool
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "prolog_batch",
+		Description: "Run many queries in parallel against a snapshot of the knowledge base and check each against an expected outcome (succeeds, fails, bindings, solution count). Returns a pass/fail report. Use it for regression suites of rules.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, input BatchInput) (*mcp.CallToolResult, *BatchOutput, error) {
+		fail := func(msg string, err error) (*mcp.CallToolResult, *BatchOutput, error) {
+			return errorResult(msg, err), &BatchOutput{Status: failure(msg, err), KnowledgeBase: lt.knowledgeBaseStats()}, nil
+		}
+
+		if err := validateBatch(input.Queries); err != nil {
+			return fail("Invalid batch", err)
+		}
+		concurrency := input.Concurrency
+		if concurrency <= 0 {
+			concurrency = defaultBatchConcurrency
+		}
+		concurrency = min(concurrency, maxBatchConcurrency)
+		if limit := lt.quotaLimits().ConcurrentQueries; limit > 0 {
+			concurrency = min(concurrency, limit)
+		}
+
+		queries := make([]string, len(input.Queries))
+		for i, q := range input.Queries {
+			queries[i] = q.Query
+		}
+		start := time.Now()
+		results, err := lt.runBatch(ctx, queries, concurrency)
+		if results == nil {
+			return fail("Failed to run batch", err)
+		}
+
+		// A quota refusal stops the batch; the queries that ran are
+		// reported with it
+		out := batchOutput(input.Queries, results, err)
+		out.ExecutionMS = milliseconds(time.Since(start))
+		out.KnowledgeBase = lt.knowledgeBaseStats()
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: batchReport(out, concurrency)},
+			},
+			IsError: err != nil,
+		}, out, nil
+	})
+}
+
+// batchOutput checks the results of a batch against the expectations of
+// its queries. A batch stopped by err has no results for the queries not
+// run, and err in its status.
+func batchOutput(queries []BatchQuery, results []*prolog.QueryResult, err error) *BatchOutput {
+	out := &BatchOutput{}
+	for i, result := range results {
+		if result == nil {
+			out.NotRun++
+			continue
+		}
+		r := BatchResult{
+			Index:         i + 1,
+			Query:         queries[i].Query,
+			Success:       result.Success,
+			Solutions:     solutionCount(result),
+			MoreSolutions: result.MoreSolutions,
+			Error:         queryError(result),
+			ExecutionMS:   milliseconds(result.ExecutionTime),
+		}
+		r.Reason = checkExpectation(queries[i].Expect, result)
+		r.Passed = r.Reason == ""
+		if r.Passed {
+			out.Passed++
+		} else {
+			out.Failed++
+		}
+		out.Results = append(out.Results, r)
+	}
+	if err != nil {
+		out.Status = failure("Batch stopped", err)
+	} else {
+		out.Success = out.Failed == 0
+	}
+	return out
+}
+
+// validateBatch checks the queries and expectations before anything runs
+func validateBatch(queries []BatchQuery) error {
+	if len(queries) == 0 {
+		return fmt.Errorf("no queries given")
+	}
+	if len(queries) > maxBatchQueries {
+		return fmt.Errorf("%d queries given, at most %d are allowed per batch", len(queries), maxBatchQueries)
+	}
+	for i, q := range queries {
+		if strings.TrimSpace(q.Query) == "" {
+			return fmt.Errorf("query %d is empty", i+1)
+		}
+		if q.Expect == nil {
+			continue
+		}
+		switch q.Expect.Outcome {
+		case "", OutcomeSucceeds, OutcomeFails:
+		default:
+			return fmt.Errorf("query %d: invalid outcome %q: use %s or %s", i+1, q.Expect.Outcome, OutcomeSucceeds, OutcomeFails)
+		}
+		if q.Expect.Solutions != nil && *q.Expect.Solutions < 0 {
+			return fmt.Errorf("query %d: solution count must not be negative", i+1)
+		}
+	}
+	return nil
+}
+
+// runBatch runs the queries of a batch on the session engine, which admits
+// each of them by the quotas
+func (lt *LogicTools) runBatch(ctx context.Context, queries []string, concurrency int) ([]*prolog.QueryResult, error) {
+	results, err := lt.engine.QueryBatch(ctx, queries, concurrency)
+	for _, result := range results {
+		if result == nil {
+			continue
+		}
+		metrics.ObserveQuery("prolog_batch", queryOutcome(ctx, result, nil), result.ExecutionTime)
+	}
+	return results, err
+}
+
+// quotaLimits returns the strictest limits of the session quotas
+func (lt *LogicTools) quotaLimits() quota.Limits {
+	var limits quota.Limits
+	for _, t := range lt.opts.Quotas {
+		if t != nil {
+			limits = limits.Merge(t.Limits())
+		}
+	}
+	return limits
+}
+
+// checkExpectation returns why result does not meet exp, or "" if it does
+func checkExpectation(exp *Expectation, result *prolog.QueryResult) string {
+	if result.Error != "" {
+		return result.Error
+	}
+	if exp == nil {
+		return ""
+	}
+
+	outcome := exp.Outcome
+	if outcome == "" && (len(exp.Bindings) > 0 || (exp.Solutions != nil && *exp.Solutions > 0)) {
+		outcome = OutcomeSucceeds
+	}
+	switch {
+	case outcome == OutcomeSucceeds && !result.Success:
+		return "expected the query to succeed, but it failed"
+	case outcome == OutcomeFails && result.Success:
+		return "expected the query to fail, but it succeeded"
+	}
+
+	if exp.Solutions != nil {
+		count := solutionCount(result)
+		switch {
+		case result.MoreSolutions && *exp.Solutions > count:
+			return fmt.Sprintf("expected %d solutions, but the solution limit is %d", *exp.Solutions, count)
+		case result.MoreSolutions:
+			return fmt.Sprintf("expected %d solutions, got more than %d", *exp.Solutions, count)
+		case count != *exp.Solutions:
+			return fmt.Sprintf("expected %d solutions, got %d", *exp.Solutions, count)
+		}
+	}
+
+	if len(exp.Bindings) > 0 {
+		for v := range exp.Bindings {
+			if !slices.Contains(result.Variables, v) {
+				return fmt.Sprintf("expected a binding for %s, which is not a query variable", v)
+			}
+		}
+		for i := range result.Solutions {
+			if solutionMatches(exp.Bindings, result, i) {
+				return ""
+			}
+		}
+		return fmt.Sprintf("no solution has the bindings %s", formatExpected(exp.Bindings))
+	}
+	return ""
+}
+
+// solutionCount returns the number of solutions collected. A query without
+// variables is proven at most once.
+func solutionCount(result *prolog.QueryResult) int {
+	if len(result.Variables) == 0 && result.Success {
+		return 1
+	}
+	return len(result.Solutions)
+}
+
+// solutionMatches reports whether solution i has all the expected bindings.
+// Bindings in canonical syntax are compared as terms, so spacing and
+// quoting do not matter; anything else is compared as text.
+func solutionMatches(expected map[string]string, result *prolog.QueryResult, i int) bool {
+	for v, want := range expected {
+		if i < len(result.Terms) {
+			if term, err := termjson.Parse(want); err == nil {
+				if !termjson.Equal(term, result.Terms[i][v]) {
+					return false
+				}
+				continue
+			}
+		}
+		if strings.TrimSpace(want) != fmt.Sprint(result.Solutions[i][v]) {
+			return false
+		}
+	}
+	return true
+}
+
+// formatExpected renders expected bindings in a stable order
+func formatExpected(bindings map[string]string) string {
+	vars := make([]string, 0, len(bindings))
+	for v := range bindings {
+		vars = append(vars, v)
+	}
+	slices.Sort(vars)
+	return formatBindings(vars, bindings)
+}
+
+// batchReport renders the pass/fail report of a batch: a summary line
+// followed by the queries that did not pass
+func batchReport(out *BatchOutput, concurrency int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Batch: %d passed, %d failed of %d queries (concurrency %d, %.1f ms)\n",
+		out.Passed, out.Failed, len(out.Results)+out.NotRun, concurrency, out.ExecutionMS)
+	if out.NotRun > 0 && out.Error != nil {
+		fmt.Fprintf(&b, "%d queries not run. %s\n", out.NotRun, out.Error.Message)
+	}
+	for _, r := range out.Results {
+		if !r.Passed {
+			fmt.Fprintf(&b, "\nFAIL #%d %s\n  %s\n", r.Index, r.Query, r.Reason)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,121 @@
+package tools
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomasz-sikora/logic-mcp/internal/prolog"
+	"github.com/tomasz-sikora/logic-mcp/internal/quota"
+	"github.com/tomasz-sikora/logic-mcp/internal/termjson"
+)
+
+func TestCheckExpectation(t *testing.T) {
+	two := 2
+	three := 3
+	zero := 0
+
+	// member(X, [[1,2], b])
+	members := &prolog.QueryResult{
+		Success:   true,
+		Variables: []string{"X"},
+		Solutions: []map[string]any{{"X": "[1,2]"}, {"X": "b"}},
+		Terms: []map[string]termjson.Term{
+			{"X": termjson.NewList(termjson.Int(1), termjson.Int(2))},
+			{"X": termjson.Atom("b")},
+		},
+	}
+	proven := &prolog.QueryResult{Success: true}
+	failed := &prolog.QueryResult{Success: false}
+	limited := &prolog.QueryResult{
+		Success:       true,
+		Variables:     []string{"X"},
+		Solutions:     []map[string]any{{"X": "1"}, {"X": "2"}},
+		MoreSolutions: true,
+	}
+	broken := &prolog.QueryResult{Error: "execution failed: exit status 1"}
+
+	tests := []struct {
+		name   string
+		exp    *Expectation
+		result *prolog.QueryResult
+		reason string
+	}{
+		{"no expectation", nil, failed, ""},
+		{"error fails", nil, broken, "execution failed: exit status 1"},
+		{"succeeds", &Expectation{Outcome: OutcomeSucceeds}, proven, ""},
+		{"succeeds but failed", &Expectation{Outcome: OutcomeSucceeds}, failed, "expected the query to succeed, but it failed"},
+		{"fails", &Expectation{Outcome: OutcomeFails}, failed, ""},
+		{"fails but succeeded", &Expectation{Outcome: OutcomeFails}, proven, "expected the query to fail, but it succeeded"},
+		{"count", &Expectation{Solutions: &two}, members, ""},
+		{"count without variables", &Expectation{Solutions: &zero}, failed, ""},
+		{"count mismatch", &Expectation{Solutions: &three}, members, "expected 3 solutions, got 2"},
+		{"count implies success", &Expectation{Solutions: &two}, failed, "expected the query to succeed, but it failed"},
+		{"count beyond limit", &Expectation{Solutions: &three}, limited, "expected 3 solutions, but the solution limit is 2"},
+		{"count below limit", &Expectation{Solutions: &two}, limited, "expected 2 solutions, got more than 2"},
+		{"bindings as terms", &Expectation{Bindings: map[string]string{"X": "[1, 2]"}}, members, ""},
+		{"bindings of any solution", &Expectation{Bindings: map[string]string{"X": "'b'"}}, members, ""},
+		{"bindings mismatch", &Expectation{Bindings: map[string]string{"X": "c"}}, members, "no solution has the bindings X = c"},
+		{"bindings as text", &Expectation{Bindings: map[string]string{"X": "2"}}, limited, ""},
+		{"unknown variable", &Expectation{Bindings: map[string]string{"Y": "a"}}, members, "expected a binding for Y, which is not a query variable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.reason, checkExpectation(tt.exp, tt.result))
+		})
+	}
+}
+
+func TestValidateBatch(t *testing.T) {
+	negative := -1
+	assert.NoError(t, validateBatch([]BatchQuery{{Query: "true."}, {Query: "fail.", Expect: &Expectation{Outcome: OutcomeFails}}}))
+	assert.Error(t, validateBatch(nil))
+	assert.Error(t, validateBatch([]BatchQuery{{Query: " "}}))
+	assert.Error(t, validateBatch([]BatchQuery{{Query: "true.", Expect: &Expectation{Outcome: "maybe"}}}))
+	assert.Error(t, validateBatch([]BatchQuery{{Query: "true.", Expect: &Expectation{Solutions: &negative}}}))
+	assert.Error(t, validateBatch(make([]BatchQuery, maxBatchQueries+1)))
+}
+
+func TestBatchReport(t *testing.T) {
+	out := &BatchOutput{
+		Passed: 1,
+		Failed: 1,
+		Results: []BatchResult{
+			{Index: 1, Query: "a.", Passed: true},
+			{Index: 2, Query: "b.", Reason: "expected the query to succeed, but it failed"},
+		},
+		ExecutionMS: 12.5,
+	}
+	assert.Equal(t, "Batch: 1 passed, 1 failed of 2 queries (concurrency 4, 12.5 ms)\n"+
+		"\nFAIL #2 b.\n  expected the query to succeed, but it failed\n", batchReport(out, 4))
+}
+
+func TestBatchOutput_QuotaRefusal(t *testing.T) {
+	queries := []BatchQuery{
+		{Query: "a."},
+		{Query: "b.", Expect: &Expectation{Outcome: OutcomeFails}},
+		{Query: "c."},
+		{Query: "d."},
+	}
+	refused := &quota.ExceededError{Quota: quota.QueriesPerMinute, Scope: "session", Limit: 2, RetryAfter: 30 * time.Second}
+
+	// The queries that ran are reported with the refusal
+	out := batchOutput(queries, []*prolog.QueryResult{{Success: true}, nil, {Success: true}, nil}, refused)
+	assert.False(t, out.Success)
+	require.NotNil(t, out.Error)
+	assert.Equal(t, ErrorCodeQuotaExceeded, out.Error.Code)
+	assert.Equal(t, 30, out.Error.RetryAfterSeconds)
+	assert.Equal(t, 2, out.Passed)
+	assert.Equal(t, 2, out.NotRun)
+	require.Len(t, out.Results, 2)
+	assert.Equal(t, 3, out.Results[1].Index)
+	assert.Equal(t, "c.", out.Results[1].Query)
+	assert.Equal(t, "Batch: 2 passed, 0 failed of 4 queries (concurrency 2, 0.0 ms)\n"+
+		"2 queries not run. Batch stopped: "+refused.Error()+"\n", batchReport(out, 2))
+
+	out = batchOutput(queries[:2], []*prolog.QueryResult{{Success: true}, {Success: true}}, nil)
+	assert.False(t, out.Success)
+	assert.Nil(t, out.Error)
+	assert.Equal(t, 1, out.Failed)
+}
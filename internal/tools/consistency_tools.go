@@ -0,0 +1,130 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/tomasz-sikora/logic-mcp/internal/metrics"
+	"github.com/tomasz-sikora/logic-mcp/internal/prolog"
+)
+
+// ConsistencyOutput is the result of prolog_check_consistency
+type ConsistencyOutput struct {
+	Status
+	Added         int                        `json:"added,omitempty" jsonschema:"Number of constraints declared by this call."`
+	Removed       int                        `json:"removed,omitempty" jsonschema:"Number of constraints removed by this call."`
+	Constraints   []string                   `json:"constraints" jsonschema:"The integrity constraints of the knowledge base."`
+	Consistent    bool                       `json:"consistent" jsonschema:"No constraint is violated."`
+	Violations    []prolog.Violation         `json:"violations,omitempty" jsonschema:"Every violation, with the bindings of the constraint and the facts it rests on."`
+	Incomplete    []string                   `json:"incomplete,omitempty" jsonschema:"Constraints with more violations than were reported."`
+	Failures      []prolog.ConstraintFailure `json:"failures,omitempty" jsonschema:"Constraints that could not be checked, with the error."`
+	ExecutionMS   float64                    `json:"execution_ms"`
+	KnowledgeBase KnowledgeBaseStats         `json:"knowledge_base"`
+}
+
+// registerConsistencyTools registers the tool checking integrity constraints
+func (lt *LogicTools) registerConsistencyTools(server *mcp.Server) {
+	type ConsistencyInput struct {
+		Add    string   `json:"add,omitempty" jsonschema:"Integrity constraints to declare, one per line, as denials that must have no solution, e.g. ':- parent(X, X).\\n:- male(X), female(X).' (optional)."`
+		Remove []string `json:"remove,omitempty" jsonschema:"Declared constraints to remove, e.g. [':- parent(X, X).'] (optional)."`
+	}
+
+	// Register prolog_check_consistency tool
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "prolog_check_consistency",
+		Description: "Declare or remove integrity constraints, denials such as ':- parent(X, X).', and check the knowledge base against all of them. Reports every violation with the facts it rests on. Constraints last until prolog_clear_kb; prolog_load_facts can reject loads that violate them.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, input ConsistencyInput) (*mcp.CallToolResult, *ConsistencyOutput, error) {
+		out := &ConsistencyOutput{}
+		fail := func(msg string, err error) (*mcp.CallToolResult, *ConsistencyOutput, error) {
+			out.Status = failure(msg, err)
+			out.Constraints = lt.engine.Constraints()
+			out.KnowledgeBase = lt.knowledgeBaseStats()
+			return errorResult(msg, err), out, nil
+		}
+
+		var err error
+		if len(input.Remove) > 0 {
+			if out.Removed, err = lt.engine.RemoveConstraints(input.Remove); err != nil {
+				return fail("Failed to remove constraints", err)
+			}
+		}
+		if strings.TrimSpace(input.Add) != "" {
+			if out.Added, err = lt.engine.AddConstraints(input.Add); err != nil {
+				return fail("Failed to declare constraints", err)
+			}
+		}
+
+		report, err := lt.runConsistency(ctx)
+		if err != nil {
+			return fail("Failed to check consistency", err)
+		}
+
+		out.Status = Status{Success: true}
+		out.Constraints = lt.engine.Constraints()
+		out.Consistent = report.Consistent()
+		out.Violations = report.Violations
+		out.Incomplete = report.Incomplete
+		out.Failures = report.Failures
+		out.ExecutionMS = milliseconds(report.Result.ExecutionTime)
+		out.KnowledgeBase = lt.knowledgeBaseStats()
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: consistencyReport(out)},
+			},
+		}, out, nil
+	})
+}
+
+// runConsistency checks the session knowledge base, which the engine admits
+// by the quotas, and records it in the metrics like a query
+func (lt *LogicTools) runConsistency(ctx context.Context) (*prolog.ConsistencyReport, error) {
+	start := time.Now()
+	report, err := lt.engine.CheckConsistency(ctx)
+
+	elapsed := time.Since(start)
+	var result *prolog.QueryResult
+	if report != nil {
+		result = report.Result
+	}
+	metrics.ObserveQuery("prolog_check_consistency", queryOutcome(ctx, result, err), elapsed)
+
+	return report, err
+}
+
+// consistencyReport renders a consistency check as text
+func consistencyReport(out *ConsistencyOutput) string {
+	var b strings.Builder
+	if out.Added > 0 || out.Removed > 0 {
+		b.WriteString(fmt.Sprintf("Constraints: %d declared, %d removed\n", out.Added, out.Removed))
+	}
+	switch {
+	case len(out.Constraints) == 0:
+		b.WriteString("No integrity constraints are declared.\n")
+		return b.String()
+	case out.Consistent:
+		b.WriteString(fmt.Sprintf("Consistent: no violations of %d constraints\n", len(out.Constraints)))
+	default:
+		b.WriteString(fmt.Sprintf("Inconsistent: %d violations of %d constraints\n", len(out.Violations), len(out.Constraints)))
+	}
+
+	for _, v := range out.Violations {
+		if v.Bindings != "" {
+			b.WriteString(fmt.Sprintf("  %s with %s\n", v.Constraint, v.Bindings))
+		} else {
+			b.WriteString(fmt.Sprintf("  %s\n", v.Constraint))
+		}
+		for _, f := range v.Facts {
+			b.WriteString(fmt.Sprintf("    %s: %s\n", f.Source, f.Text))
+		}
+	}
+	for _, c := range out.Incomplete {
+		b.WriteString(fmt.Sprintf("  [more violations of %s were not reported]\n", c))
+	}
+	for _, f := range out.Failures {
+		b.WriteString(fmt.Sprintf("Not checked: %s: %s\n", f.Constraint, f.Error))
+	}
+	return b.String()
+}
@@ -0,0 +1,31 @@
+package tools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomasz-sikora/logic-mcp/internal/prolog"
+)
+
+func TestConsistencyReport(t *testing.T) {
+	assert.Equal(t, "No integrity constraints are declared.\n", consistencyReport(&ConsistencyOutput{Consistent: true}))
+
+	assert.Equal(t, "Constraints: 1 declared, 0 removed\nConsistent: no violations of 1 constraints\n",
+		consistencyReport(&ConsistencyOutput{Added: 1, Constraints: []string{":- parent(X, X)."}, Consistent: true}))
+
+	out := &ConsistencyOutput{
+		Constraints: []string{":- parent(X, X).", ":- male(X), female(X).", ":- age(_, A), A < 0."},
+		Violations: []prolog.Violation{
+			{Constraint: ":- parent(X, X).", Bindings: "X = bob", Facts: []prolog.Clause{{Text: "parent(bob, bob).", Source: prolog.Source{Load: 2, Line: 4}}}},
+			{Constraint: ":- parent(X, X).", Bindings: "X = ann"},
+		},
+		Incomplete: []string{":- parent(X, X)."},
+		Failures:   []prolog.ConstraintFailure{{Constraint: ":- age(_, A), A < 0.", Error: "Arithmetic: evaluable `old/0' does not exist"}},
+	}
+	assert.Equal(t, "Inconsistent: 2 violations of 3 constraints\n"+
+		"  :- parent(X, X). with X = bob\n"+
+		"    load #2, line 4: parent(bob, bob).\n"+
+		"  :- parent(X, X). with X = ann\n"+
+		"  [more violations of :- parent(X, X). were not reported]\n"+
+		"Not checked: :- age(_, A), A < 0.: Arithmetic: evaluable `old/0' does not exist\n", consistencyReport(out))
+}
@@ -0,0 +1,72 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/tomasz-sikora/logic-mcp/internal/prolog"
+)
+
+// DeclarationsOutput is the result of prolog_declarations
+type DeclarationsOutput struct {
+	Status
+	Declarations  []prolog.Declaration `json:"declarations" jsonschema:"The type and predicate declarations of the knowledge base."`
+	Proposed      []string             `json:"proposed,omitempty" jsonschema:"Declarations inferred from the facts of undeclared predicates, ready to load with prolog_load_facts."`
+	KnowledgeBase KnowledgeBaseStats   `json:"knowledge_base"`
+}
+
+// registerDeclarationTools registers the tool listing and inferring
+// declarations
+func (lt *LogicTools) registerDeclarationTools(server *mcp.Server) {
+	type DeclarationsInput struct {
+		Infer bool `json:"infer,omitempty" jsonschema:"Also propose declarations for undeclared predicates, inferred from their facts."`
+	}
+
+	// Register prolog_declarations tool
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "prolog_declarations",
+		Description: "List the type and predicate declarations loaded with prolog_load_facts, such as ':- pred parent(person, person).', and optionally propose declarations inferred from the facts of undeclared predicates.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, input DeclarationsInput) (*mcp.CallToolResult, *DeclarationsOutput, error) {
+		out := &DeclarationsOutput{
+			Status:        Status{Success: true},
+			Declarations:  lt.engine.Declarations(),
+			KnowledgeBase: lt.knowledgeBaseStats(),
+		}
+		if input.Infer {
+			out.Proposed = lt.engine.InferDeclarations()
+		}
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: declarationsReport(out, input.Infer)},
+			},
+		}, out, nil
+	})
+}
+
+// declarationsReport renders the declarations and the proposed ones
+func declarationsReport(out *DeclarationsOutput, infer bool) string {
+	var b strings.Builder
+	if len(out.Declarations) == 0 {
+		b.WriteString("No declarations.\n")
+	} else {
+		b.WriteString(fmt.Sprintf("%d declarations:\n", len(out.Declarations)))
+		for _, d := range out.Declarations {
+			b.WriteString(fmt.Sprintf("  %s    [%s]\n", d.Text, d.Source))
+		}
+	}
+	if !infer {
+		return b.String()
+	}
+	if len(out.Proposed) == 0 {
+		b.WriteString("No undeclared predicates with facts.\n")
+		return b.String()
+	}
+	b.WriteString(fmt.Sprintf("Proposed from the facts (%d):\n", len(out.Proposed)))
+	for _, p := range out.Proposed {
+		b.WriteString(fmt.Sprintf("  %s\n", p))
+	}
+	return b.String()
+}
@@ -0,0 +1,26 @@
+package tools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomasz-sikora/logic-mcp/internal/prolog"
+)
+
+func TestDeclarationsReport(t *testing.T) {
+	assert.Equal(t, "No declarations.\n", declarationsReport(&DeclarationsOutput{}, false))
+
+	out := &DeclarationsOutput{
+		Declarations: []prolog.Declaration{{Text: ":- pred parent(person, person).", Source: prolog.Source{Load: 1, Line: 1}}},
+		Proposed:     []string{":- pred age(atom, integer)."},
+	}
+	assert.Equal(t, "1 declarations:\n"+
+		"  :- pred parent(person, person).    [load #1, line 1]\n"+
+		"Proposed from the facts (1):\n"+
+		"  :- pred age(atom, integer).\n", declarationsReport(out, true))
+
+	out.Proposed = nil
+	assert.Equal(t, "1 declarations:\n"+
+		"  :- pred parent(person, person).    [load #1, line 1]\n"+
+		"No undeclared predicates with facts.\n", declarationsReport(out, true))
+}
@@ -0,0 +1,154 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/tomasz-sikora/logic-mcp/internal/metrics"
+	"github.com/tomasz-sikora/logic-mcp/internal/prolog"
+)
+
+// EntailsOutput is the result of prolog_entails
+type EntailsOutput struct {
+	Status
+	Goal           string                `json:"goal"`
+	Verdict        string                `json:"verdict" jsonschema:"provable, unprovable (false under the closed-world assumption) or undetermined (a resource limit was reached or the goal raised an error)."`
+	Reason         string                `json:"reason,omitempty" jsonschema:"Why the verdict is undetermined."`
+	Variables      []string              `json:"variables,omitempty"`
+	Bindings       map[string]string     `json:"bindings,omitempty" jsonschema:"The bindings of the proof of a provable goal."`
+	Proof          []prolog.ProofStep    `json:"proof,omitempty" jsonschema:"The proof of a provable goal, depth first: the steps proving a goal follow it one level deeper."`
+	ProofTruncated bool                  `json:"proof_truncated,omitempty"`
+	Frontier       []prolog.FrontierGoal `json:"frontier,omitempty" jsonschema:"The goals where the search for a proof of an unprovable goal failed."`
+	Warnings       []prolog.Message      `json:"warnings,omitempty"`
+	Errors         []prolog.Message      `json:"errors,omitempty"`
+	ExecutionMS    float64               `json:"execution_ms"`
+	KnowledgeBase  KnowledgeBaseStats    `json:"knowledge_base"`
+}
+
+// registerEntailsTools registers the tool deciding entailment
+func (lt *LogicTools) registerEntailsTools(server *mcp.Server) {
+	type EntailsInput struct {
+		Goal          string `json:"goal" jsonschema:"The goal to decide, e.g. 'grandparent(tom, ann).'"`
+		MaxInferences int64  `json:"max_inferences,omitempty" jsonschema:"Inference limit of the proof search (default 10000000)."`
+		MaxDepth      int    `json:"max_depth,omitempty" jsonschema:"Depth limit of the proof and of the search for failing goals (default 100)."`
+	}
+
+	// Register prolog_entails tool
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "prolog_entails",
+		Description: "Decide whether a goal follows from the knowledge base: provable, with a proof; unprovable under the closed-world assumption, with the goals where the search for a proof failed; or undetermined within the resource limits.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, input EntailsInput) (*mcp.CallToolResult, *EntailsOutput, error) {
+		fail := func(msg string, err error) (*mcp.CallToolResult, *EntailsOutput, error) {
+			return errorResult(msg, err), &EntailsOutput{Status: failure(msg, err), Goal: input.Goal, KnowledgeBase: lt.knowledgeBaseStats()}, nil
+		}
+
+		if input.MaxInferences < 0 || input.MaxDepth < 0 {
+			return fail("Invalid limits", fmt.Errorf("max_inferences and max_depth must not be negative"))
+		}
+		ent, err := lt.runEntails(ctx, input.Goal, prolog.EntailOptions{MaxInferences: input.MaxInferences, MaxDepth: input.MaxDepth})
+		if err != nil {
+			return fail("Failed to decide entailment", err)
+		}
+
+		out := newEntailsOutput(input.Goal, ent)
+		out.KnowledgeBase = lt.knowledgeBaseStats()
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: entailsReport(out)},
+			},
+		}, out, nil
+	})
+}
+
+// runEntails decides entailment on the session engine, which enforces the
+// quotas, and records it in the metrics like a query
+func (lt *LogicTools) runEntails(ctx context.Context, goal string, opts prolog.EntailOptions) (*prolog.Entailment, error) {
+	start := time.Now()
+	ent, err := lt.engine.Entails(ctx, goal, opts)
+
+	elapsed := time.Since(start)
+	var result *prolog.QueryResult
+	if ent != nil {
+		result = ent.Result
+		elapsed = result.ExecutionTime
+	}
+	metrics.ObserveQuery("prolog_entails", queryOutcome(ctx, result, err), elapsed)
+
+	return ent, err
+}
+
+// newEntailsOutput builds the tool output of an entailment. Every verdict
+// is a success, except when the query timed out or swipl failed to run.
+func newEntailsOutput(goal string, ent *prolog.Entailment) *EntailsOutput {
+	out := &EntailsOutput{
+		Status:         Status{Error: queryError(ent.Result)},
+		Goal:           goal,
+		Verdict:        ent.Verdict,
+		Reason:         ent.Reason,
+		Proof:          ent.Proof,
+		ProofTruncated: ent.ProofTruncated,
+		Frontier:       ent.Frontier,
+		Warnings:       ent.Result.Warnings,
+		Errors:         ent.Result.Errors,
+		ExecutionMS:    milliseconds(ent.Result.ExecutionTime),
+	}
+	out.Success = out.Error == nil
+	if ent.Bindings != nil {
+		out.Variables = ent.Variables
+		out.Bindings = make(map[string]string, len(ent.Bindings))
+		for name, value := range ent.Bindings {
+			out.Bindings[name] = fmt.Sprint(value)
+		}
+	}
+	return out
+}
+
+// entailsReport renders an entailment as text: the verdict, then the proof
+// as an indented tree or the failing goals
+func entailsReport(out *EntailsOutput) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("Goal: %s\n", out.Goal))
+	if out.Reason != "" {
+		b.WriteString(fmt.Sprintf("Verdict: %s (%s)\n", out.Verdict, out.Reason))
+	} else {
+		b.WriteString(fmt.Sprintf("Verdict: %s\n", out.Verdict))
+	}
+	if len(out.Variables) > 0 {
+		b.WriteString(fmt.Sprintf("Bindings: %s\n", formatBindings(out.Variables, out.Bindings)))
+	}
+
+	if len(out.Proof) > 0 {
+		b.WriteString("Proof:\n")
+		for _, step := range out.Proof {
+			b.WriteString(fmt.Sprintf("%s%s", strings.Repeat("  ", step.Depth+1), step.Goal))
+			switch {
+			case step.Source != nil:
+				b.WriteString(fmt.Sprintf("    [%s: %s]", step.Source, step.Clause))
+			case step.Kind != "clause":
+				b.WriteString(fmt.Sprintf("    [%s]", step.Kind))
+			}
+			b.WriteString("\n")
+		}
+		if out.ProofTruncated {
+			b.WriteString(fmt.Sprintf("  [truncated: showing the first %d steps]\n", len(out.Proof)))
+		}
+	} else if out.Verdict == prolog.VerdictProvable {
+		b.WriteString("Proof: not available within the limits\n")
+	}
+	if len(out.Frontier) > 0 {
+		b.WriteString("Failed goals:\n")
+		for _, f := range out.Frontier {
+			b.WriteString(fmt.Sprintf("  %s: %s\n", f.Goal, f.Reason))
+		}
+	}
+	for _, m := range out.Warnings {
+		writeMessage(&b, "", "Warning", m)
+	}
+	for _, m := range out.Errors {
+		writeMessage(&b, "", "Prolog error", m)
+	}
+	return b.String()
+}
@@ -0,0 +1,48 @@
+package tools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomasz-sikora/logic-mcp/internal/prolog"
+)
+
+func TestEntailsReport(t *testing.T) {
+	out := newEntailsOutput("grandparent(tom, Z).", &prolog.Entailment{
+		Verdict:   prolog.VerdictProvable,
+		Variables: []string{"Z"},
+		Bindings:  map[string]any{"Z": "ann"},
+		Proof: []prolog.ProofStep{
+			{Depth: 0, Kind: "clause", Goal: "grandparent(tom,ann)", Clause: "grandparent(X, Z) :- parent(X, Y), parent(Y, Z).", Source: &prolog.Source{Load: 1, Line: 3}},
+			{Depth: 1, Kind: "clause", Goal: "parent(tom,bob)", Clause: "parent(tom, bob).", Source: &prolog.Source{Load: 1, Line: 1}},
+			{Depth: 1, Kind: "builtin", Goal: "bob\\==tom"},
+		},
+		Result: &prolog.QueryResult{},
+	})
+	assert.True(t, out.Success)
+	assert.Equal(t, "Goal: grandparent(tom, Z).\n"+
+		"Verdict: provable\n"+
+		"Bindings: Z = ann\n"+
+		"Proof:\n"+
+		"  grandparent(tom,ann)    [load #1, line 3: grandparent(X, Z) :- parent(X, Y), parent(Y, Z).]\n"+
+		"    parent(tom,bob)    [load #1, line 1: parent(tom, bob).]\n"+
+		"    bob\\==tom    [builtin]\n", entailsReport(out))
+
+	out = newEntailsOutput("parent(ann, X).", &prolog.Entailment{
+		Verdict:  prolog.VerdictUnprovable,
+		Frontier: []prolog.FrontierGoal{{Goal: "parent(ann,_)", Reason: "no matching clause"}},
+		Result:   &prolog.QueryResult{},
+	})
+	assert.Equal(t, "Goal: parent(ann, X).\n"+
+		"Verdict: unprovable\n"+
+		"Failed goals:\n"+
+		"  parent(ann,_): no matching clause\n", entailsReport(out))
+
+	out = newEntailsOutput("loop.", &prolog.Entailment{
+		Verdict: prolog.VerdictUndetermined,
+		Reason:  "query timed out after 1s",
+		Result:  &prolog.QueryResult{Error: "query timed out after 1s", TimedOut: true},
+	})
+	assert.False(t, out.Success)
+	assert.Equal(t, "Goal: loop.\nVerdict: undetermined (query timed out after 1s)\n", entailsReport(out))
+}
@@ -0,0 +1,142 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/tomasz-sikora/logic-mcp/internal/prolog"
+	"github.com/tomasz-sikora/logic-mcp/internal/workspace"
+)
+
+// defaultFilePattern lists every Prolog file of a root
+const defaultFilePattern = "**/*" + workspace.Extension
+
+// registerFileTools registers the tools that read Prolog files from the
+// workspace roots
+func (lt *LogicTools) registerFileTools(server *mcp.Server) {
+	type ConsultInput struct {
+		Path             string   `json:"path" jsonschema:"Path of a .pl file relative to the workspace root, or a glob pattern such as 'rules/*.pl' or '**/*.pl'."`
+		Root             string   `json:"root,omitempty" jsonschema:"Name of the workspace root (optional, defaults to the first root)."`
+		Tags             []string `json:"tags,omitempty" jsonschema:"Tags recorded with the clauses, to list or retract them later (optional)."`
+		RejectViolations bool     `json:"reject_violations,omitempty" jsonschema:"Reject a file if it introduces violations of the integrity constraints declared with prolog_check_consistency."`
+	}
+
+	type ListInput struct {
+		Pattern string `json:"pattern,omitempty" jsonschema:"Glob pattern relative to the workspace root (optional, defaults to '**/*.pl')."`
+		Root    string `json:"root,omitempty" jsonschema:"Name of the workspace root (optional, defaults to the first root)."`
+	}
+
+	// Register prolog_consult_file tool
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "prolog_consult_file",
+		Description: "Load Prolog files from the server workspace into the knowledge base by relative path or glob pattern. Clauses already loaded are skipped. Reports the number of clauses and compiler warnings per file.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, input ConsultInput) (*mcp.CallToolResult, *ConsultOutput, error) {
+		out := &ConsultOutput{}
+		fail := func(msg string, err error) (*mcp.CallToolResult, *ConsultOutput, error) {
+			out.Status = failure(msg, err)
+			out.KnowledgeBase = lt.knowledgeBaseStats()
+			return errorResult(msg, err), out, nil
+		}
+
+		files, err := lt.opts.Workspace.Glob(input.Root, input.Path)
+		if err != nil {
+			return fail("Failed to resolve path", err)
+		}
+		if len(files) == 0 {
+			return fail("Failed to resolve path", fmt.Errorf("no %s files match %q", workspace.Extension, input.Path))
+		}
+
+		opts := prolog.LoadOptions{
+			Provenance:       lt.provenance("prolog_consult_file", input.Tags),
+			RejectViolations: input.RejectViolations,
+		}
+		var responseText strings.Builder
+		for i, f := range files {
+			path, err := lt.opts.Workspace.Open(f)
+			if err != nil {
+				return fail("Failed to open file", err)
+			}
+			result, err := lt.engine.ConsultFile(ctx, path, f.Path, opts)
+			if err != nil {
+				var inconsistent *prolog.ConsistencyError
+				if errors.As(err, &inconsistent) {
+					out.Violations = inconsistent.Violations
+				}
+				var mismatched *prolog.DeclarationError
+				if errors.As(err, &mismatched) {
+					out.Mismatches = mismatched.Mismatches
+				}
+				return fail(fmt.Sprintf("Failed to consult file (%d earlier files with %d clauses were loaded)", i, out.Clauses), err)
+			}
+
+			out.Files = append(out.Files, *result)
+			out.Clauses += result.Clauses
+			out.Skipped += result.Skipped
+			responseText.WriteString(fmt.Sprintf("%s: %d clauses", result.File, result.Clauses))
+			if result.Skipped > 0 {
+				responseText.WriteString(fmt.Sprintf(", %d already loaded", result.Skipped))
+			}
+			responseText.WriteString("\n")
+			for _, w := range result.Warnings {
+				responseText.WriteString(fmt.Sprintf("   Warning: %s\n", w))
+			}
+		}
+		responseText.WriteString(fmt.Sprintf("\nLoaded %d files, %d clauses", len(files), out.Clauses))
+		if out.Skipped > 0 {
+			responseText.WriteString(fmt.Sprintf(", %d already loaded", out.Skipped))
+		}
+		responseText.WriteString(".\n")
+		out.Success = true
+		out.KnowledgeBase = lt.knowledgeBaseStats()
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: responseText.String()},
+			},
+		}, out, nil
+	})
+
+	// Register prolog_list_files tool
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "prolog_list_files",
+		Description: "List the Prolog files in the server workspace that prolog_consult_file can load.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, input ListInput) (*mcp.CallToolResult, *ListFilesOutput, error) {
+		pattern := input.Pattern
+		if pattern == "" {
+			pattern = defaultFilePattern
+		}
+
+		out := &ListFilesOutput{}
+		var responseText strings.Builder
+		for _, root := range lt.opts.Workspace.Roots() {
+			if input.Root != "" && input.Root != root.Name {
+				continue
+			}
+			files, err := lt.opts.Workspace.Glob(root.Name, pattern)
+			if err != nil {
+				msg := "Failed to list files"
+				return errorResult(msg, err), &ListFilesOutput{Status: failure(msg, err)}, nil
+			}
+			out.Roots = append(out.Roots, RootFiles{Root: root.Name, Files: files})
+
+			responseText.WriteString(fmt.Sprintf("Root %s (%d files):\n", root.Name, len(files)))
+			for _, f := range files {
+				responseText.WriteString(fmt.Sprintf("  %s (%d bytes)\n", f.Path, f.Size))
+			}
+		}
+		if responseText.Len() == 0 {
+			msg, err := "Failed to list files", fmt.Errorf("unknown workspace root %q", input.Root)
+			return errorResult(msg, err), &ListFilesOutput{Status: failure(msg, err)}, nil
+		}
+		out.Success = true
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: responseText.String()},
+			},
+		}, out, nil
+	})
+}
@@ -0,0 +1,272 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/tomasz-sikora/logic-mcp/internal/prolog"
+	"github.com/tomasz-sikora/logic-mcp/internal/termjson"
+)
+
+// Output formats of query results
+const (
+	FormatText     = "text"
+	FormatJSON     = "json"
+	FormatCSV      = "csv"
+	FormatMarkdown = "markdown"
+)
+
+// DefaultMaxOutputBytes bounds a rendered result when no limit is given
+const DefaultMaxOutputBytes = 64 * 1024
+
+// OutputOptions controls how query solutions are rendered
+type OutputOptions struct {
+	// Format is text, json, csv or markdown; empty means text
+	Format string
+	// Columns orders and selects the variables shown; empty shows all
+	Columns []string
+	// MaxBytes truncates the rendered solutions; zero means DefaultMaxOutputBytes
+	MaxBytes int
+}
+
+// rendered is a formatted query result. Note is set when the solutions were
+// cut short; it is kept apart so csv and json bodies stay machine-readable.
+type rendered struct {
+	Body string
+	Note string
+	// Output holds the solutions that were rendered
+	Output *QueryOutput
+}
+
+// newQueryOutput selects the columns of a result
+func newQueryOutput(query string, result *prolog.QueryResult, columns []string) (*QueryOutput, error) {
+	if len(columns) == 0 {
+		columns = result.Variables
+	}
+	for _, c := range columns {
+		if !slices.Contains(result.Variables, c) {
+			return nil, fmt.Errorf("unknown column %q: the query variables are %s", c, strings.Join(result.Variables, ", "))
+		}
+	}
+
+	t := &QueryOutput{
+		Status:        Status{Success: result.Success, Error: queryError(result)},
+		Query:         query,
+		Columns:       columns,
+		MoreSolutions: result.MoreSolutions,
+		Output:        result.Output(),
+		Warnings:      result.Warnings,
+		Errors:        result.Errors,
+		ExecutionMS:   milliseconds(result.ExecutionTime),
+		CPUMS:         milliseconds(result.CPUTime),
+		executionTime: result.ExecutionTime,
+	}
+	for _, s := range result.Solutions {
+		row := make(map[string]string, len(columns))
+		for _, c := range columns {
+			row[c] = fmt.Sprint(s[c])
+		}
+		t.Solutions = append(t.Solutions, row)
+	}
+	for _, bindings := range result.Terms {
+		terms := make(map[string]termjson.Term, len(columns))
+		for _, c := range columns {
+			terms[c] = bindings[c]
+		}
+		t.Terms = append(t.Terms, terms)
+	}
+	return t, nil
+}
+
+// milliseconds converts a duration to fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// renderSolutions formats the result of a query
+func renderSolutions(query string, result *prolog.QueryResult, opts OutputOptions) (*rendered, error) {
+	table, err := newQueryOutput(query, result, opts.Columns)
+	if err != nil {
+		return nil, err
+	}
+
+	maxBytes := opts.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxOutputBytes
+	}
+
+	var render func(t *QueryOutput) string
+	switch opts.Format {
+	case "", FormatText:
+		render = renderText
+	case FormatJSON:
+		render = renderJSON
+	case FormatCSV:
+		render = renderCSV
+	case FormatMarkdown:
+		render = renderMarkdown
+	default:
+		return nil, fmt.Errorf("unknown output format %q (use text, json, csv or markdown)", opts.Format)
+	}
+
+	// Drop whole solutions until the body fits
+	total := len(table.Solutions)
+	body := render(table)
+	if len(body) > maxBytes {
+		table.Truncated = true
+		allRows, allTerms := table.Solutions, table.Terms
+		keep := func(n int) {
+			table.Solutions = allRows[:n]
+			if allTerms != nil {
+				table.Terms = allTerms[:n]
+			}
+		}
+		lo, hi := 0, total
+		for lo < hi {
+			mid := (lo + hi + 1) / 2
+			keep(mid)
+			if len(render(table)) <= maxBytes {
+				lo = mid
+			} else {
+				hi = mid - 1
+			}
+		}
+		keep(lo)
+		body = render(table)
+	}
+
+	out := &rendered{Body: body, Output: table}
+	switch {
+	case table.Truncated:
+		out.Note = fmt.Sprintf("[truncated: showing %d of %d solutions, output limit is %d bytes]", len(table.Solutions), total, maxBytes)
+	case table.MoreSolutions:
+		out.Note = fmt.Sprintf("[more solutions exist: only the first %d were collected]", total)
+	}
+	return out, nil
+}
+
+func renderText(t *QueryOutput) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("Query: %s\n", t.Query))
+	b.WriteString(fmt.Sprintf("Result: %t\n", t.Success))
+	b.WriteString(fmt.Sprintf("Execution Time: %s\n", t.executionTime))
+	if t.Error != nil {
+		b.WriteString(fmt.Sprintf("Error: %s\n", t.Error.Message))
+	}
+	if t.Output != "" {
+		b.WriteString(fmt.Sprintf("Output: %s\n", t.Output))
+	}
+	writeMessages(&b, "", t)
+	if len(t.Columns) > 0 && len(t.Solutions) > 0 {
+		b.WriteString("Solutions:\n")
+		for _, row := range t.Solutions {
+			b.WriteString(fmt.Sprintf("  %s\n", formatBindings(t.Columns, row)))
+		}
+	}
+	return b.String()
+}
+
+// writeMessages writes the warnings and errors of a query, each followed
+// by the source line it points at
+func writeMessages(b *strings.Builder, indent string, t *QueryOutput) {
+	for _, m := range t.Warnings {
+		writeMessage(b, indent, "Warning", m)
+	}
+	for _, m := range t.Errors {
+		writeMessage(b, indent, "Prolog error", m)
+	}
+}
+
+func writeMessage(b *strings.Builder, indent, kind string, m prolog.Message) {
+	b.WriteString(fmt.Sprintf("%s%s: %s\n", indent, kind, m.Text))
+	if m.Snippet != "" {
+		for _, line := range strings.Split(m.Snippet, "\n") {
+			b.WriteString(fmt.Sprintf("%s  %s\n", indent, line))
+		}
+	}
+}
+
+func renderJSON(t *QueryOutput) string {
+	b, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return fmt.Sprintf(`{"error": %q}`, err.Error())
+	}
+	return string(b)
+}
+
+// renderCSV writes one row per solution. A query without variables gets a
+// single success column.
+func renderCSV(t *QueryOutput) string {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if len(t.Columns) == 0 {
+		w.Write([]string{"success"})
+		w.Write([]string{fmt.Sprint(t.Success)})
+	} else {
+		w.Write(t.Columns)
+		for _, row := range t.Solutions {
+			record := make([]string, len(t.Columns))
+			for i, c := range t.Columns {
+				record[i] = row[c]
+			}
+			w.Write(record)
+		}
+	}
+	w.Flush()
+	return buf.String()
+}
+
+func renderMarkdown(t *QueryOutput) string {
+	if len(t.Columns) == 0 {
+		return fmt.Sprintf("| success |\n| --- |\n| %t |\n", t.Success)
+	}
+
+	var b strings.Builder
+	b.WriteString("| " + strings.Join(escapeCells(t.Columns), " | ") + " |\n")
+	b.WriteString("|" + strings.Repeat(" --- |", len(t.Columns)) + "\n")
+	for _, row := range t.Solutions {
+		cells := make([]string, len(t.Columns))
+		for i, c := range t.Columns {
+			cells[i] = row[c]
+		}
+		b.WriteString("| " + strings.Join(escapeCells(cells), " | ") + " |\n")
+	}
+	if len(t.Solutions) == 0 {
+		b.WriteString(fmt.Sprintf("\n_No solutions (result: %t)_\n", t.Success))
+	}
+	return b.String()
+}
+
+// content turns a rendered result into tool content. Errors are added as a
+// separate block for formats whose body has no room for them.
+func (r *rendered) content(format string) []mcp.Content {
+	return append([]mcp.Content{&mcp.TextContent{Text: r.Body}}, r.notes(format)...)
+}
+
+// notes returns the truncation note and, for csv and markdown, the error
+func (r *rendered) notes(format string) []mcp.Content {
+	var notes []mcp.Content
+	if r.Note != "" {
+		notes = append(notes, &mcp.TextContent{Text: r.Note})
+	}
+	if (format == FormatCSV || format == FormatMarkdown) && r.Output.Error != nil {
+		notes = append(notes, &mcp.TextContent{Text: fmt.Sprintf("Error: %s", r.Output.Error.Message)})
+	}
+	return notes
+}
+
+// escapeCells keeps cell text from breaking the table layout
+func escapeCells(cells []string) []string {
+	out := make([]string, len(cells))
+	for i, c := range cells {
+		c = strings.ReplaceAll(c, "|", `\|`)
+		out[i] = strings.ReplaceAll(c, "\n", " ")
+	}
+	return out
+}
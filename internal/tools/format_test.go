@@ -0,0 +1,83 @@
+package tools
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomasz-sikora/logic-mcp/internal/prolog"
+)
+
+func sampleResult() *prolog.QueryResult {
+	return &prolog.QueryResult{
+		Success:   true,
+		Variables: []string{"X", "Y"},
+		Solutions: []map[string]any{
+			{"X": "1", "Y": "a"},
+			{"X": "2", "Y": "'b|c'"},
+		},
+		ExecutionTime: 5 * time.Millisecond,
+	}
+}
+
+func TestRenderSolutions_Formats(t *testing.T) {
+	out, err := renderSolutions("p(X, Y).", sampleResult(), OutputOptions{Format: FormatCSV, Columns: []string{"Y", "X"}})
+	require.NoError(t, err)
+	assert.Equal(t, "Y,X\na,1\n'b|c',2\n", out.Body)
+	assert.Empty(t, out.Note)
+
+	out, err = renderSolutions("p(X, Y).", sampleResult(), OutputOptions{Format: FormatMarkdown})
+	require.NoError(t, err)
+	assert.Equal(t, "| X | Y |\n| --- | --- |\n| 1 | a |\n| 2 | 'b\\|c' |\n", out.Body)
+
+	out, err = renderSolutions("p(X, Y).", sampleResult(), OutputOptions{Format: FormatJSON, Columns: []string{"X"}})
+	require.NoError(t, err)
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal([]byte(out.Body), &decoded))
+	assert.Equal(t, []any{"X"}, decoded["columns"])
+	assert.Equal(t, []any{map[string]any{"X": "1"}, map[string]any{"X": "2"}}, decoded["solutions"])
+	assert.Equal(t, 5.0, decoded["execution_time_ms"])
+
+	out, err = renderSolutions("p(X, Y).", sampleResult(), OutputOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, out.Body, "Solutions:\n  X = 1, Y = a\n")
+}
+
+func TestRenderSolutions_Errors(t *testing.T) {
+	_, err := renderSolutions("p(X, Y).", sampleResult(), OutputOptions{Format: "xml"})
+	assert.ErrorContains(t, err, "unknown output format")
+
+	_, err = renderSolutions("p(X, Y).", sampleResult(), OutputOptions{Columns: []string{"Z"}})
+	assert.ErrorContains(t, err, `unknown column "Z"`)
+}
+
+func TestRenderSolutions_Truncation(t *testing.T) {
+	result := &prolog.QueryResult{Success: true, Variables: []string{"N"}}
+	for i := 0; i < 50; i++ {
+		result.Solutions = append(result.Solutions, map[string]any{"N": strings.Repeat("x", 10)})
+	}
+
+	out, err := renderSolutions("n(N).", result, OutputOptions{Format: FormatCSV, MaxBytes: 100})
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(out.Body), 100)
+	assert.Equal(t, 8, strings.Count(out.Body, "\n")-1)
+	assert.Equal(t, "[truncated: showing 8 of 50 solutions, output limit is 100 bytes]", out.Note)
+
+	result.MoreSolutions = true
+	out, err = renderSolutions("n(N).", result, OutputOptions{Format: FormatCSV})
+	require.NoError(t, err)
+	assert.Equal(t, "[more solutions exist: only the first 50 were collected]", out.Note)
+}
+
+func TestRenderText_Messages(t *testing.T) {
+	result := sampleResult()
+	result.Warnings = []prolog.Message{{Text: "load #2, line 3: Singleton variables: [X]", Snippet: "3 | p(X)."}}
+	result.Errors = []prolog.Message{{Text: "Unknown procedure: q/0"}}
+
+	out, err := renderSolutions("p(X, Y).", result, OutputOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, out.Body, "Warning: load #2, line 3: Singleton variables: [X]\n  3 | p(X).\nProlog error: Unknown procedure: q/0\n")
+}
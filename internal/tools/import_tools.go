@@ -0,0 +1,95 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/tomasz-sikora/logic-mcp/internal/dataimport"
+	"github.com/tomasz-sikora/logic-mcp/internal/prolog"
+)
+
+// importSampleFacts is the number of generated facts echoed back
+const importSampleFacts = 5
+
+// registerImportTools registers the tool that converts tabular data to facts
+func (lt *LogicTools) registerImportTools(server *mcp.Server) {
+	type ImportInput struct {
+		Data      string            `json:"data" jsonschema:"The data to import: CSV text, a JSON array of objects, or JSON Lines (one object per line)."`
+		Predicate string            `json:"predicate" jsonschema:"Name of the predicate to create, e.g. 'employee'."`
+		Format    string            `json:"format,omitempty" jsonschema:"Data format: csv, json or jsonl (optional, detected from the data)."`
+		Columns   []string          `json:"columns,omitempty" jsonschema:"Columns or JSON keys to use as arguments, in argument order (optional, defaults to all columns in order). Headerless CSV columns are named 1, 2, ..."`
+		Types     map[string]string `json:"types,omitempty" jsonschema:"Argument type per column: auto (number if numeric, else atom), number, atom or string (optional, defaults to auto)."`
+		NoHeader  bool              `json:"no_header,omitempty" jsonschema:"Treat the first CSV row as data instead of column names (optional)."`
+		Delimiter string            `json:"delimiter,omitempty" jsonschema:"CSV field delimiter (optional, defaults to a comma)."`
+		MaxRows   int               `json:"max_rows,omitempty" jsonschema:"Maximum number of rows to import (optional, defaults to 10000)."`
+		Tags      []string          `json:"tags,omitempty" jsonschema:"Tags recorded with the facts, to list or retract them later (optional)."`
+	}
+
+	// Register prolog_import_data tool
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "prolog_import_data",
+		Description: "Import CSV, JSON or JSON Lines data into the knowledge base as facts of one predicate, one fact per row. Values become numbers, atoms or strings with proper quoting.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, input ImportInput) (*mcp.CallToolResult, *ImportOutput, error) {
+		opts := dataimport.Options{
+			Predicate: input.Predicate,
+			Format:    input.Format,
+			Columns:   input.Columns,
+			Types:     input.Types,
+			NoHeader:  input.NoHeader,
+			MaxRows:   input.MaxRows,
+		}
+		if input.Delimiter != "" {
+			r, size := utf8.DecodeRuneInString(input.Delimiter)
+			if size != len(input.Delimiter) {
+				return importFailure("Failed to import data", fmt.Errorf("delimiter must be a single character, got %q", input.Delimiter))
+			}
+			opts.Delimiter = r
+		}
+
+		result, err := dataimport.Convert([]byte(input.Data), opts)
+		if err != nil {
+			return importFailure("Failed to import data", err)
+		}
+		load := prolog.LoadOptions{Provenance: lt.provenance("prolog_import_data", input.Tags)}
+		if _, err := lt.engine.LoadFactsWithOptions(strings.Join(result.Facts, "\n"), load); err != nil {
+			return importFailure("Failed to load imported facts", err)
+		}
+		sample := result.Facts[:min(importSampleFacts, len(result.Facts))]
+
+		var responseText strings.Builder
+		responseText.WriteString(fmt.Sprintf("Imported %d facts as %s from %s data.\n", len(result.Facts), result.Indicator(input.Predicate), result.Format))
+		responseText.WriteString(fmt.Sprintf("Arguments: %s\n", strings.Join(result.Columns, ", ")))
+		if result.Truncated {
+			responseText.WriteString(fmt.Sprintf("Row limit reached: only the first %d rows were imported.\n", len(result.Facts)))
+		}
+		if len(result.Facts) > 0 {
+			responseText.WriteString("\nSample:\n")
+			for _, fact := range sample {
+				responseText.WriteString(fmt.Sprintf("  %s\n", fact))
+			}
+		}
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: responseText.String()},
+			},
+		}, &ImportOutput{
+			Status:        Status{Success: true},
+			Predicate:     result.Indicator(input.Predicate),
+			Format:        result.Format,
+			Columns:       result.Columns,
+			Facts:         len(result.Facts),
+			Truncated:     result.Truncated,
+			Sample:        sample,
+			KnowledgeBase: lt.knowledgeBaseStats(),
+		}, nil
+	})
+}
+
+// importFailure returns the results of a failed prolog_import_data call
+func importFailure(msg string, err error) (*mcp.CallToolResult, *ImportOutput, error) {
+	return errorResult(msg, err), &ImportOutput{Status: failure(msg, err)}, nil
+}
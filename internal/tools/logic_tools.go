@@ -1,23 +1,49 @@
 package tools
 
 import (
-"context"
-"fmt"
-"strings"
-
-"github.com/modelcontextprotocol/go-sdk/mcp"
-"github.com/tomasz-sikora/logic-mcp/internal/prolog"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/tomasz-sikora/logic-mcp/internal/metrics"
+	"github.com/tomasz-sikora/logic-mcp/internal/prolog"
+	"github.com/tomasz-sikora/logic-mcp/internal/quota"
+	"github.com/tomasz-sikora/logic-mcp/internal/workspace"
 )
 
 // LogicTools manages Prolog-based tools for MCP using official SDK
 type LogicTools struct {
 	engine *prolog.Engine
+	opts   Options
+}
+
+// Options configures LogicTools
+type Options struct {
+	// Quotas are the trackers the engine admits its swipl runs by, e.g. one
+	// for the session and one shared by all sessions of the same token. The
+	// tools only read their limits.
+	Quotas []*quota.Tracker
+	// Workspace enables the file tools; nil leaves them unregistered
+	Workspace *workspace.Workspace
+	// Session and Caller are recorded as the provenance of loaded clauses
+	Session string
+	Caller  string
 }
 
 // NewLogicTools creates a new LogicTools instance
 func NewLogicTools(engine *prolog.Engine) *LogicTools {
+	return NewLogicToolsWithOptions(engine, Options{})
+}
+
+// NewLogicToolsWithOptions creates a new LogicTools instance with the given options
+func NewLogicToolsWithOptions(engine *prolog.Engine, opts Options) *LogicTools {
 	return &LogicTools{
 		engine: engine,
+		opts:   opts,
 	}
 }
 
@@ -25,11 +51,17 @@ func NewLogicTools(engine *prolog.Engine) *LogicTools {
 func (lt *LogicTools) RegisterTools(server *mcp.Server) error {
 	// Define input types for each tool
 	type QueryInput struct {
-		Query string `json:"query" jsonschema:"The Prolog query to execute. Must end with a period. Example: 'member(X, [1,2,3]).'" `
+		Query          string   `json:"query" jsonschema:"The Prolog query to execute. Must end with a period. Example: 'member(X, [1,2,3]).'" `
+		OutputFormat   string   `json:"output_format,omitempty" jsonschema:"How to render the solutions: text (default), json, csv or markdown."`
+		Columns        []string `json:"columns,omitempty" jsonschema:"Query variables to show as columns, in order (optional, defaults to all variables in order of appearance)."`
+		MaxOutputBytes int      `json:"max_output_bytes,omitempty" jsonschema:"Maximum size of the rendered solutions in bytes (optional, defaults to 65536). Larger results are cut at a solution boundary and marked as truncated."`
 	}
 
 	type FactsInput struct {
-		Facts string `json:"facts" jsonschema:"Prolog facts and rules to load, separated by newlines. Comments start with %. Example: 'parent(tom, bob).\\nparent(bob, pat).'"`
+		Facts            string   `json:"facts" jsonschema:"Prolog facts and rules to load, separated by newlines. Comments start with %. Example: 'parent(tom, bob).\\nparent(bob, pat).'"`
+		Mode             string   `json:"mode,omitempty" jsonschema:"append (default) adds the clauses not loaded yet; replace makes the given clauses the only clauses of their predicates."`
+		Tags             []string `json:"tags,omitempty" jsonschema:"Tags recorded with the clauses, to list or retract them later (optional)."`
+		RejectViolations bool     `json:"reject_violations,omitempty" jsonschema:"Reject the load if it introduces violations of the integrity constraints declared with prolog_check_consistency."`
 	}
 
 	type CodeInput struct {
@@ -40,6 +72,8 @@ func (lt *LogicTools) RegisterTools(server *mcp.Server) error {
 		ProblemDescription string   `json:"problem_description" jsonschema:"A description of the logic problem to solve."`
 		FactsAndRules      string   `json:"facts_and_rules" jsonschema:"Prolog facts and rules that define the problem domain."`
 		Queries            []string `json:"queries" jsonschema:"List of queries to execute to solve the problem."`
+		OutputFormat       string   `json:"output_format,omitempty" jsonschema:"How to render the solutions of each query: text (default), json, csv or markdown."`
+		MaxOutputBytes     int      `json:"max_output_bytes,omitempty" jsonschema:"Maximum size of the rendered solutions of each query in bytes (optional, defaults to 65536)."`
 	}
 
 	type ExplainInput struct {
@@ -51,64 +85,80 @@ func (lt *LogicTools) RegisterTools(server *mcp.Server) error {
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "prolog_query",
 		Description: "Execute a Prolog query and return results. Supports both simple queries and complex logic problems.",
-	}, func(ctx context.Context, req *mcp.CallToolRequest, input QueryInput) (*mcp.CallToolResult, any, error) {
-		result, err := lt.engine.Query(ctx, input.Query)
+	}, func(ctx context.Context, req *mcp.CallToolRequest, input QueryInput) (*mcp.CallToolResult, *QueryOutput, error) {
+		progress := newProgressReporter(ctx, req)
+		result, err := lt.runQuery(ctx, "prolog_query", input.Query, progress.query(""))
 		if err != nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Failed to execute query: %s", err.Error())},
-				},
-				IsError: true,
-			}, nil, nil
-		}
-
-		var responseText strings.Builder
-		responseText.WriteString(fmt.Sprintf("Query: %s\n", input.Query))
-		responseText.WriteString(fmt.Sprintf("Result: %t\n", result.Success))
-		responseText.WriteString(fmt.Sprintf("Execution Time: %s\n", result.ExecutionTime))
-
-		if result.Error != "" {
-			responseText.WriteString(fmt.Sprintf("Error: %s\n", result.Error))
+			msg := "Failed to execute query"
+			return errorResult(msg, err), &QueryOutput{Status: failure(msg, err), Query: input.Query}, nil
 		}
 
-		if result.Output != "" {
-			responseText.WriteString(fmt.Sprintf("Output: %s\n", result.Output))
+		out, err := renderSolutions(input.Query, result, OutputOptions{
+			Format:   input.OutputFormat,
+			Columns:  input.Columns,
+			MaxBytes: input.MaxOutputBytes,
+		})
+		if err != nil {
+			msg := "Failed to format result"
+			return errorResult(msg, err), &QueryOutput{Status: failure(msg, err), Query: input.Query}, nil
 		}
 
 		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				&mcp.TextContent{Text: responseText.String()},
-			},
-		}, nil, nil
+			Content: out.content(input.OutputFormat),
+		}, out.Output, nil
 	})
 
 	// Register prolog_load_facts tool
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "prolog_load_facts",
 		Description: "Load Prolog facts and rules into the knowledge base. Use this to define rules and facts before querying.",
-	}, func(ctx context.Context, req *mcp.CallToolRequest, input FactsInput) (*mcp.CallToolResult, any, error) {
-		err := lt.engine.LoadFacts(input.Facts)
+	}, func(ctx context.Context, req *mcp.CallToolRequest, input FactsInput) (*mcp.CallToolResult, *FactsOutput, error) {
+		result, err := lt.engine.LoadFactsWithOptions(input.Facts, prolog.LoadOptions{
+			Mode:             input.Mode,
+			Provenance:       lt.provenance("prolog_load_facts", input.Tags),
+			RejectViolations: input.RejectViolations,
+		})
 		if err != nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Failed to load facts: %s", err.Error())},
-				},
-				IsError: true,
-			}, nil, nil
+			msg := "Failed to load facts"
+			out := &FactsOutput{Status: failure(msg, err), KnowledgeBase: lt.knowledgeBaseStats()}
+			var inconsistent *prolog.ConsistencyError
+			if errors.As(err, &inconsistent) {
+				out.Violations = inconsistent.Violations
+			}
+			var mismatched *prolog.DeclarationError
+			if errors.As(err, &mismatched) {
+				out.Mismatches = mismatched.Mismatches
+			}
+			return errorResult(msg, err), out, nil
 		}
 
+		text := fmt.Sprintf("Facts loaded successfully as load #%d: %d added, %d already loaded", result.Load, result.Added, result.Skipped)
+		if result.Replaced > 0 {
+			text += fmt.Sprintf(", %d replaced", result.Replaced)
+		}
+		if result.Declared > 0 {
+			text += fmt.Sprintf(", %d declarations", result.Declared)
+		}
 		return &mcp.CallToolResult{
 			Content: []mcp.Content{
-				&mcp.TextContent{Text: "Facts loaded successfully"},
+				&mcp.TextContent{Text: text},
 			},
-		}, nil, nil
+		}, &FactsOutput{
+			Status:        Status{Success: true},
+			Load:          result.Load,
+			Loaded:        result.Added,
+			Skipped:       result.Skipped,
+			Replaced:      result.Replaced,
+			Declared:      result.Declared,
+			KnowledgeBase: lt.knowledgeBaseStats(),
+		}, nil
 	})
 
 	// Register prolog_validate_syntax tool
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "prolog_validate_syntax",
-		Description: "Validate Prolog syntax without executing. Use this to check if your Prolog code is syntactically correct.",
-	}, func(ctx context.Context, req *mcp.CallToolRequest, input CodeInput) (*mcp.CallToolResult, any, error) {
+		Description: "Validate Prolog syntax without executing. Use this to check if your Prolog code is syntactically correct. Code is read with the session flags and operators set by prolog_set_flags.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, input CodeInput) (*mcp.CallToolResult, *ValidateOutput, error) {
 		// Simple syntax check by attempting to create a temp file and check basic structure
 		lines := strings.Split(strings.TrimSpace(input.Code), "\n")
 		hasValidStructure := false
@@ -129,97 +179,119 @@ func (lt *LogicTools) RegisterTools(server *mcp.Server) error {
 			result = "invalid - no statements ending with '.'"
 		}
 
+		// Read the code with swipl to find the errors a query would hit
+		var syntaxErrors []prolog.Message
+		if hasValidStructure {
+			var err error
+			syntaxErrors, err = lt.engine.CheckSyntax(ctx, input.Code)
+			if err != nil {
+				msg := "Failed to validate syntax"
+				return errorResult(msg, err), &ValidateOutput{Status: failure(msg, err)}, nil
+			}
+			if len(syntaxErrors) > 0 {
+				hasValidStructure = false
+				result = fmt.Sprintf("invalid - %d syntax errors", len(syntaxErrors))
+			}
+		}
+
+		var responseText strings.Builder
+		responseText.WriteString(fmt.Sprintf("Syntax validation: %s\n", result))
+		for _, m := range syntaxErrors {
+			writeMessage(&responseText, "", "Syntax error", m)
+		}
+
 		return &mcp.CallToolResult{
 			Content: []mcp.Content{
-				&mcp.TextContent{Text: fmt.Sprintf("Syntax validation: %s", result)},
+				&mcp.TextContent{Text: strings.TrimSuffix(responseText.String(), "\n")},
 			},
-		}, nil, nil
+		}, &ValidateOutput{Status: Status{Success: true}, Valid: hasValidStructure, Message: result, Errors: syntaxErrors}, nil
 	})
 
 	// Register prolog_clear_kb tool
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "prolog_clear_kb",
-		Description: "Clear the Prolog knowledge base. This removes all dynamic predicates and facts.",
-	}, func(ctx context.Context, req *mcp.CallToolRequest, input struct{}) (*mcp.CallToolResult, any, error) {
+		Description: "Clear the Prolog knowledge base. This removes all dynamic predicates and facts, and the integrity constraints.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, input struct{}) (*mcp.CallToolResult, *FactsOutput, error) {
 		err := lt.engine.ClearKnowledgeBase()
 		if err != nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Failed to clear knowledge base: %s", err.Error())},
-				},
-				IsError: true,
-			}, nil, nil
+			msg := "Failed to clear knowledge base"
+			return errorResult(msg, err), &FactsOutput{Status: failure(msg, err), KnowledgeBase: lt.knowledgeBaseStats()}, nil
 		}
 
 		return &mcp.CallToolResult{
 			Content: []mcp.Content{
 				&mcp.TextContent{Text: "Knowledge base cleared successfully"},
 			},
-		}, nil, nil
+		}, &FactsOutput{Status: Status{Success: true}, KnowledgeBase: lt.knowledgeBaseStats()}, nil
 	})
 
 	// Register prolog_solve_problem tool
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "prolog_solve_problem",
 		Description: "Solve a complex logic problem by loading facts/rules and then executing queries. This is a high-level tool that combines loading facts and querying.",
-	}, func(ctx context.Context, req *mcp.CallToolRequest, input ProblemInput) (*mcp.CallToolResult, any, error) {
+	}, func(ctx context.Context, req *mcp.CallToolRequest, input ProblemInput) (*mcp.CallToolResult, *SolveOutput, error) {
+		out := &SolveOutput{Problem: input.ProblemDescription}
+
 		// Load facts and rules
-		if err := lt.engine.LoadFacts(input.FactsAndRules); err != nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Failed to load facts and rules: %s", err.Error())},
-				},
-				IsError: true,
-			}, nil, nil
+		if _, err := lt.engine.LoadFactsWithOptions(input.FactsAndRules, prolog.LoadOptions{Provenance: lt.provenance("prolog_solve_problem", nil)}); err != nil {
+			msg := "Failed to load facts and rules"
+			out.Status = failure(msg, err)
+			out.KnowledgeBase = lt.knowledgeBaseStats()
+			return errorResult(msg, err), out, nil
 		}
 
-		var responseText strings.Builder
-		responseText.WriteString(fmt.Sprintf("Problem: %s\n\n", input.ProblemDescription))
-		responseText.WriteString("Facts and rules loaded successfully.\n\n")
-		responseText.WriteString("Query Results:\n")
-
+		opts := OutputOptions{Format: input.OutputFormat, MaxBytes: input.MaxOutputBytes}
+		progress := newProgressReporter(ctx, req)
+		var sections []*rendered
+		out.Success = true
 		for i, query := range input.Queries {
-			result, err := lt.engine.Query(ctx, query)
-			if err != nil {
-				responseText.WriteString(fmt.Sprintf("%d. Query: %s\n   Error: %s\n", i+1, query, err.Error()))
-				continue
+			label := fmt.Sprintf("Query %d of %d: ", i+1, len(input.Queries))
+			result, runErr := lt.runQuery(ctx, "prolog_solve_problem", query, progress.query(label))
+			var exceeded *quota.ExceededError
+			if errors.As(runErr, &exceeded) {
+				msg := fmt.Sprintf("Stopped at query %d", i+1)
+				out.Status = failure(msg, runErr)
+				out.KnowledgeBase = lt.knowledgeBaseStats()
+				return errorResult(msg, runErr), out, nil
+			}
+			if runErr != nil {
+				result = &prolog.QueryResult{Error: runErr.Error()}
 			}
 
-			responseText.WriteString(fmt.Sprintf("%d. Query: %s\n", i+1, query))
-			responseText.WriteString(fmt.Sprintf("   Result: %t (%s)\n", result.Success, result.ExecutionTime))
-			if result.Output != "" {
-				responseText.WriteString(fmt.Sprintf("   Output: %s\n", result.Output))
+			r, err := renderSolutions(query, result, opts)
+			if err != nil {
+				msg := fmt.Sprintf("Failed to format result of query %d", i+1)
+				out.Status = failure(msg, err)
+				out.KnowledgeBase = lt.knowledgeBaseStats()
+				return errorResult(msg, err), out, nil
 			}
-			if result.Error != "" {
-				responseText.WriteString(fmt.Sprintf("   Error: %s\n", result.Error))
+			if runErr != nil {
+				r.Output.Status = failure("Failed to execute query", runErr)
 			}
-			responseText.WriteString("\n")
+			out.Results = append(out.Results, *r.Output)
+			out.Success = out.Success && r.Output.Success
+			sections = append(sections, r)
 		}
+		out.KnowledgeBase = lt.knowledgeBaseStats()
 
 		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				&mcp.TextContent{Text: responseText.String()},
-			},
-		}, nil, nil
+			Content: solveContent(out, sections, opts.Format),
+		}, out, nil
 	})
 
 	// Register prolog_explain_solution tool
 	mcp.AddTool(server, &mcp.Tool{
 		Name:        "prolog_explain_solution",
 		Description: "Explain how a Prolog solution works step by step. This tool provides educational explanations.",
-	}, func(ctx context.Context, req *mcp.CallToolRequest, input ExplainInput) (*mcp.CallToolResult, any, error) {
+	}, func(ctx context.Context, req *mcp.CallToolRequest, input ExplainInput) (*mcp.CallToolResult, *ExplainOutput, error) {
 		var responseText strings.Builder
 		responseText.WriteString(fmt.Sprintf("Explaining Prolog query: %s\n\n", input.Query))
 
 		// Load facts if provided
 		if input.Facts != "" {
-			if err := lt.engine.LoadFacts(input.Facts); err != nil {
-				return &mcp.CallToolResult{
-					Content: []mcp.Content{
-						&mcp.TextContent{Text: fmt.Sprintf("Failed to load facts: %s", err.Error())},
-					},
-					IsError: true,
-				}, nil, nil
+			if _, err := lt.engine.LoadFactsWithOptions(input.Facts, prolog.LoadOptions{Provenance: lt.provenance("prolog_explain_solution", nil)}); err != nil {
+				msg := "Failed to load facts"
+				return errorResult(msg, err), &ExplainOutput{Status: failure(msg, err), Query: input.Query}, nil
 			}
 			responseText.WriteString("Loaded facts:\n")
 			responseText.WriteString(input.Facts)
@@ -227,14 +299,10 @@ func (lt *LogicTools) RegisterTools(server *mcp.Server) error {
 		}
 
 		// Execute query
-		result, err := lt.engine.Query(ctx, input.Query)
+		result, err := lt.runQuery(ctx, "prolog_explain_solution", input.Query, newProgressReporter(ctx, req).query(""))
 		if err != nil {
-			return &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: fmt.Sprintf("Failed to execute query for explanation: %s", err.Error())},
-				},
-				IsError: true,
-			}, nil, nil
+			msg := "Failed to execute query for explanation"
+			return errorResult(msg, err), &ExplainOutput{Status: failure(msg, err), Query: input.Query}, nil
 		}
 
 		responseText.WriteString("Execution Analysis:\n")
@@ -242,8 +310,8 @@ func (lt *LogicTools) RegisterTools(server *mcp.Server) error {
 		responseText.WriteString(fmt.Sprintf("- Success: %t\n", result.Success))
 		responseText.WriteString(fmt.Sprintf("- Execution Time: %s\n", result.ExecutionTime))
 
-		if result.Output != "" {
-			responseText.WriteString(fmt.Sprintf("- Output: %s\n", result.Output))
+		if result.Output() != "" {
+			responseText.WriteString(fmt.Sprintf("- Output: %s\n", result.Output()))
 		}
 
 		if result.Error != "" {
@@ -251,19 +319,149 @@ func (lt *LogicTools) RegisterTools(server *mcp.Server) error {
 		}
 
 		// Add basic explanation
-		responseText.WriteString("\nExplanation:\n")
+		explanation := "The query failed, meaning Prolog could not find any solution that satisfies the given constraints."
 		if result.Success {
-			responseText.WriteString("The query succeeded, meaning Prolog found a solution that satisfies the given constraints.")
-		} else {
-			responseText.WriteString("The query failed, meaning Prolog could not find any solution that satisfies the given constraints.")
+			explanation = "The query succeeded, meaning Prolog found a solution that satisfies the given constraints."
 		}
+		responseText.WriteString("\nExplanation:\n")
+		responseText.WriteString(explanation)
 
 		return &mcp.CallToolResult{
 			Content: []mcp.Content{
 				&mcp.TextContent{Text: responseText.String()},
 			},
-		}, nil, nil
+		}, &ExplainOutput{
+			Status:      Status{Success: result.Success, Error: queryError(result)},
+			Query:       input.Query,
+			Explanation: explanation,
+			Output:      result.Output(),
+			ExecutionMS: milliseconds(result.ExecutionTime),
+		}, nil
 	})
 
+	lt.registerImportTools(server)
+	lt.registerBatchTools(server)
+	lt.registerProvenanceTools(server)
+	lt.registerSettingsTools(server)
+	lt.registerWhatIfTools(server)
+	lt.registerEntailsTools(server)
+	lt.registerConsistencyTools(server)
+	lt.registerDeclarationTools(server)
+	if lt.opts.Workspace != nil {
+		lt.registerFileTools(server)
+	}
+
 	return nil
 }
+
+// solveContent renders the results of prolog_solve_problem. Text keeps the
+// original layout, JSON is the structured output, and csv and markdown get
+// one section per query.
+func solveContent(out *SolveOutput, sections []*rendered, format string) []mcp.Content {
+	var notes []mcp.Content
+	for i, r := range sections {
+		for _, c := range r.notes(format) {
+			notes = append(notes, &mcp.TextContent{Text: fmt.Sprintf("Query %d: %s", i+1, c.(*mcp.TextContent).Text)})
+		}
+	}
+
+	var body strings.Builder
+	switch format {
+	case "", FormatText:
+		body.WriteString(fmt.Sprintf("Problem: %s\n\n", out.Problem))
+		body.WriteString("Facts and rules loaded successfully.\n\n")
+		body.WriteString("Query Results:\n")
+		for i, result := range out.Results {
+			body.WriteString(fmt.Sprintf("%d. Query: %s\n", i+1, result.Query))
+			if result.Error != nil && result.Error.Code == ErrorCodeFailed {
+				body.WriteString(fmt.Sprintf("   Error: %s\n\n", result.Error.Message))
+				continue
+			}
+			body.WriteString(fmt.Sprintf("   Result: %t (%s)\n", result.Success, result.executionTime))
+			for _, solution := range result.Solutions {
+				body.WriteString(fmt.Sprintf("   Solution: %s\n", formatBindings(result.Columns, solution)))
+			}
+			if result.MoreSolutions {
+				body.WriteString("   (more solutions not shown)\n")
+			}
+			if result.Output != "" {
+				body.WriteString(fmt.Sprintf("   Output: %s\n", result.Output))
+			}
+			writeMessages(&body, "   ", &result)
+			if result.Error != nil {
+				body.WriteString(fmt.Sprintf("   Error: %s\n", result.Error.Message))
+			}
+			body.WriteString("\n")
+		}
+		// Truncation notes are part of the text layout
+		return append([]mcp.Content{&mcp.TextContent{Text: body.String()}}, notes...)
+	case FormatJSON:
+		b, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			b = []byte(fmt.Sprintf(`{"error": %q}`, err.Error()))
+		}
+		body.Write(b)
+	default:
+		for i, r := range sections {
+			if i > 0 {
+				body.WriteString("\n")
+			}
+			if format == FormatMarkdown {
+				body.WriteString(fmt.Sprintf("### %d. `%s`\n\n%s", i+1, r.Output.Query, r.Body))
+			} else {
+				body.WriteString(fmt.Sprintf("# %d. %s\n%s", i+1, r.Output.Query, r.Body))
+			}
+		}
+	}
+	return append([]mcp.Content{&mcp.TextContent{Text: body.String()}}, notes...)
+}
+
+// formatBindings renders a solution as "X = a, Y = b" in variable order
+func formatBindings(vars []string, solution map[string]string) string {
+	parts := make([]string, len(vars))
+	for i, v := range vars {
+		parts[i] = fmt.Sprintf("%s = %s", v, solution[v])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// runQuery executes a query on the session engine, which enforces the
+// quotas, and records it in the metrics under the name of the calling tool.
+// progress may be nil.
+func (lt *LogicTools) runQuery(ctx context.Context, tool, query string, progress func(prolog.Progress)) (*prolog.QueryResult, error) {
+	start := time.Now()
+	result, err := lt.engine.QueryWithProgress(ctx, query, progress)
+
+	elapsed := time.Since(start)
+	if result != nil {
+		elapsed = result.ExecutionTime
+	}
+	metrics.ObserveQuery(tool, queryOutcome(ctx, result, err), elapsed)
+
+	return result, err
+}
+
+// errorResult builds the text of a tool error result. The structured
+// content comes from the failure status of the tool output.
+func errorResult(msg string, err error) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: fmt.Sprintf("%s: %s", msg, err.Error())},
+		},
+		IsError: true,
+	}
+}
+
+// queryOutcome classifies a query result for the metrics outcome label
+func queryOutcome(ctx context.Context, result *prolog.QueryResult, err error) string {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded) || (result != nil && result.TimedOut):
+		return metrics.OutcomeTimeout
+	case err != nil || result.Error != "":
+		return metrics.OutcomeError
+	case !result.Success:
+		return metrics.OutcomeFail
+	default:
+		return metrics.OutcomeSuccess
+	}
+}
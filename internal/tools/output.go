@@ -0,0 +1,176 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/tomasz-sikora/logic-mcp/internal/prolog"
+	"github.com/tomasz-sikora/logic-mcp/internal/quota"
+	"github.com/tomasz-sikora/logic-mcp/internal/termjson"
+	"github.com/tomasz-sikora/logic-mcp/internal/workspace"
+)
+
+// Error codes of ToolError
+const (
+	ErrorCodeQuotaExceeded = "quota_exceeded"
+	ErrorCodeTimeout       = "timeout"
+	ErrorCodeCancelled     = "cancelled"
+	ErrorCodeProlog        = "prolog_error"
+	ErrorCodeFailed        = "failed"
+)
+
+// ToolError describes why a tool call or a query failed
+type ToolError struct {
+	Code    string `json:"code" jsonschema:"quota_exceeded, timeout, cancelled, prolog_error or failed."`
+	Message string `json:"message"`
+	// Quota fields are set for quota_exceeded
+	Quota             string  `json:"quota,omitempty"`
+	Scope             string  `json:"scope,omitempty"`
+	Limit             float64 `json:"limit,omitempty"`
+	RetryAfterSeconds int     `json:"retry_after_seconds,omitempty"`
+}
+
+// Status is embedded in the output of every tool
+type Status struct {
+	Success bool       `json:"success"`
+	Error   *ToolError `json:"error,omitempty"`
+}
+
+// failure returns the status of a tool call that failed with err
+func failure(msg string, err error) Status {
+	e := &ToolError{Code: ErrorCodeFailed, Message: msg + ": " + err.Error()}
+	var exceeded *quota.ExceededError
+	switch {
+	case errors.As(err, &exceeded):
+		e.Code = ErrorCodeQuotaExceeded
+		e.Quota = exceeded.Quota
+		e.Scope = exceeded.Scope
+		e.Limit = exceeded.Limit
+		e.RetryAfterSeconds = exceeded.RetryAfterSeconds()
+	case errors.Is(err, context.DeadlineExceeded):
+		e.Code = ErrorCodeTimeout
+	case errors.Is(err, context.Canceled):
+		e.Code = ErrorCodeCancelled
+	}
+	return Status{Error: e}
+}
+
+// KnowledgeBaseStats describes the knowledge base after a tool call
+type KnowledgeBaseStats struct {
+	Clauses int    `json:"clauses" jsonschema:"Number of clauses in the knowledge base."`
+	Hash    string `json:"hash" jsonschema:"SHA-256 of the knowledge base."`
+}
+
+// knowledgeBaseStats returns the statistics of the session knowledge base
+func (lt *LogicTools) knowledgeBaseStats() KnowledgeBaseStats {
+	return KnowledgeBaseStats{
+		Clauses: len(lt.engine.GetLoadedFacts()),
+		Hash:    lt.engine.KnowledgeBaseHash(),
+	}
+}
+
+// QueryOutput is the result of one query. Solutions and Terms are restricted
+// to Columns and cut like the rendered text when the output limit is hit.
+type QueryOutput struct {
+	Status
+	Query         string                     `json:"query"`
+	Columns       []string                   `json:"columns,omitempty" jsonschema:"The variables shown, in order."`
+	Solutions     []map[string]string        `json:"solutions,omitempty" jsonschema:"Bindings of each solution as Prolog text."`
+	Terms         []map[string]termjson.Term `json:"terms,omitempty" jsonschema:"Bindings of each solution as tagged JSON terms."`
+	MoreSolutions bool                       `json:"more_solutions,omitempty" jsonschema:"The solution limit was reached."`
+	Truncated     bool                       `json:"truncated,omitempty" jsonschema:"Solutions were dropped to fit the output limit."`
+	Output        string                     `json:"output,omitempty" jsonschema:"Text the query printed."`
+	Warnings      []prolog.Message           `json:"warnings,omitempty" jsonschema:"Warnings from loading the knowledge base or running the query, with the clause they are about when known."`
+	Errors        []prolog.Message           `json:"errors,omitempty" jsonschema:"Errors from loading the knowledge base or running the query, with the clause they are about when known."`
+	ExecutionMS   float64                    `json:"execution_time_ms"`
+	CPUMS         float64                    `json:"cpu_time_ms"`
+
+	executionTime time.Duration
+}
+
+// queryError converts the error of a query result to a ToolError
+func queryError(result *prolog.QueryResult) *ToolError {
+	switch {
+	case result.TimedOut:
+		return &ToolError{Code: ErrorCodeTimeout, Message: result.Error}
+	case result.Error != "":
+		return &ToolError{Code: ErrorCodeProlog, Message: result.Error}
+	default:
+		return nil
+	}
+}
+
+// FactsOutput is the result of prolog_load_facts and prolog_clear_kb
+type FactsOutput struct {
+	Status
+	Load          int                   `json:"load,omitempty" jsonschema:"Number of this load. Messages about its clauses point at it, e.g. load #3, line 42."`
+	Loaded        int                   `json:"loaded,omitempty" jsonschema:"Number of clauses added."`
+	Skipped       int                   `json:"skipped,omitempty" jsonschema:"Number of clauses skipped because they were already loaded."`
+	Replaced      int                   `json:"replaced,omitempty" jsonschema:"Number of clauses removed by replace mode."`
+	Declared      int                   `json:"declared,omitempty" jsonschema:"Number of type and predicate declarations given."`
+	Violations    []prolog.Violation    `json:"violations,omitempty" jsonschema:"Violations of integrity constraints that got the load rejected."`
+	Mismatches    []prolog.TypeMismatch `json:"mismatches,omitempty" jsonschema:"Clauses that do not match their declarations, which got the load rejected."`
+	KnowledgeBase KnowledgeBaseStats    `json:"knowledge_base"`
+}
+
+// ValidateOutput is the result of prolog_validate_syntax
+type ValidateOutput struct {
+	Status
+	Valid   bool             `json:"valid"`
+	Message string           `json:"message"`
+	Errors  []prolog.Message `json:"errors,omitempty" jsonschema:"Syntax errors, read with the session flags and operators."`
+}
+
+// SolveOutput is the result of prolog_solve_problem
+type SolveOutput struct {
+	Status
+	Problem       string             `json:"problem"`
+	Results       []QueryOutput      `json:"results,omitempty" jsonschema:"One result per query, in order. success is true when every query succeeded."`
+	KnowledgeBase KnowledgeBaseStats `json:"knowledge_base"`
+}
+
+// ExplainOutput is the result of prolog_explain_solution
+type ExplainOutput struct {
+	Status
+	Query       string  `json:"query"`
+	Explanation string  `json:"explanation"`
+	Output      string  `json:"output,omitempty"`
+	ExecutionMS float64 `json:"execution_time_ms"`
+}
+
+// ImportOutput is the result of prolog_import_data
+type ImportOutput struct {
+	Status
+	Predicate     string             `json:"predicate" jsonschema:"Indicator of the imported predicate, e.g. employee/3."`
+	Format        string             `json:"format"`
+	Columns       []string           `json:"columns,omitempty"`
+	Facts         int                `json:"facts" jsonschema:"Number of facts imported."`
+	Truncated     bool               `json:"truncated,omitempty" jsonschema:"The row limit was reached."`
+	Sample        []string           `json:"sample,omitempty"`
+	KnowledgeBase KnowledgeBaseStats `json:"knowledge_base"`
+}
+
+// ConsultOutput is the result of prolog_consult_file. On failure Files lists
+// the files loaded before the failing one.
+type ConsultOutput struct {
+	Status
+	Files         []prolog.ConsultResult `json:"files,omitempty"`
+	Clauses       int                    `json:"clauses" jsonschema:"Total number of clauses loaded."`
+	Skipped       int                    `json:"skipped,omitempty" jsonschema:"Total number of clauses skipped because they were already loaded."`
+	Violations    []prolog.Violation     `json:"violations,omitempty" jsonschema:"Violations of integrity constraints that got the failing file rejected."`
+	Mismatches    []prolog.TypeMismatch  `json:"mismatches,omitempty" jsonschema:"Clauses of the failing file that do not match their declarations."`
+	KnowledgeBase KnowledgeBaseStats     `json:"knowledge_base"`
+}
+
+// ListFilesOutput is the result of prolog_list_files
+type ListFilesOutput struct {
+	Status
+	Roots []RootFiles `json:"roots,omitempty"`
+}
+
+// RootFiles lists the matching files of one workspace root
+type RootFiles struct {
+	Root  string           `json:"root"`
+	Files []workspace.File `json:"files,omitempty"`
+}
@@ -0,0 +1,96 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomasz-sikora/logic-mcp/internal/quota"
+)
+
+// connect registers the tools on a server and returns a connected client.
+// Tools that reach the engine cannot be called: there is none.
+func connect(t *testing.T) *mcp.ClientSession {
+	t.Helper()
+	ctx := context.Background()
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "test", Version: "v0"}, nil)
+	require.NoError(t, NewLogicTools(nil).RegisterTools(server))
+
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	_, err := server.Connect(ctx, serverTransport, nil)
+	require.NoError(t, err)
+	client := mcp.NewClient(&mcp.Implementation{Name: "client", Version: "v0"}, nil)
+	session, err := client.Connect(ctx, clientTransport, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { session.Close() })
+	return session
+}
+
+func TestTools_OutputSchemas(t *testing.T) {
+	session := connect(t)
+
+	tools, err := session.ListTools(context.Background(), nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, tools.Tools)
+	for _, tool := range tools.Tools {
+		require.NotNil(t, tool.OutputSchema, tool.Name)
+		schema, err := json.Marshal(tool.OutputSchema)
+		require.NoError(t, err)
+		assert.Contains(t, string(schema), `"success"`, tool.Name)
+	}
+}
+
+func TestTools_StructuredContent(t *testing.T) {
+	session := connect(t)
+	ctx := context.Background()
+
+	result, err := session.CallTool(ctx, &mcp.CallToolParams{
+		Name:      "prolog_validate_syntax",
+		Arguments: map[string]any{"code": "a :- b"},
+	})
+	require.NoError(t, err)
+	assert.False(t, result.IsError)
+	assert.Equal(t, "Syntax validation: invalid - no statements ending with '.'", result.Content[0].(*mcp.TextContent).Text)
+	assert.Equal(t, map[string]any{
+		"success": true,
+		"valid":   false,
+		"message": "invalid - no statements ending with '.'",
+	}, result.StructuredContent)
+
+	// Failures carry an error object that satisfies the same schema
+	result, err = session.CallTool(ctx, &mcp.CallToolParams{
+		Name:      "prolog_import_data",
+		Arguments: map[string]any{"data": "a,b\n1,2\n", "predicate": "p", "delimiter": ";;"},
+	})
+	require.NoError(t, err)
+	assert.True(t, result.IsError)
+	structured := result.StructuredContent.(map[string]any)
+	assert.Equal(t, false, structured["success"])
+	assert.Equal(t, map[string]any{
+		"code":    ErrorCodeFailed,
+		"message": `Failed to import data: delimiter must be a single character, got ";;"`,
+	}, structured["error"])
+}
+
+func TestFailure(t *testing.T) {
+	exceeded := &quota.ExceededError{Quota: "queries_per_minute", Scope: "session", Limit: 10, RetryAfter: 1500 * time.Millisecond}
+	status := failure("Stopped at query 2", fmt.Errorf("acquire: %w", exceeded))
+	assert.False(t, status.Success)
+	assert.Equal(t, &ToolError{
+		Code:              ErrorCodeQuotaExceeded,
+		Message:           "Stopped at query 2: acquire: " + exceeded.Error(),
+		Quota:             "queries_per_minute",
+		Scope:             "session",
+		Limit:             10,
+		RetryAfterSeconds: 2,
+	}, status.Error)
+
+	assert.Equal(t, ErrorCodeTimeout, failure("Failed", context.DeadlineExceeded).Error.Code)
+	assert.Equal(t, ErrorCodeCancelled, failure("Failed", context.Canceled).Error.Code)
+}
@@ -0,0 +1,53 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/tomasz-sikora/logic-mcp/internal/prolog"
+)
+
+// progressReporter sends MCP progress notifications for one tool call.
+// A nil reporter sends nothing.
+type progressReporter struct {
+	ctx     context.Context
+	session *mcp.ServerSession
+	token   any
+	start   time.Time
+}
+
+// newProgressReporter returns a reporter for the request, or nil when the
+// client did not ask for progress
+func newProgressReporter(ctx context.Context, req *mcp.CallToolRequest) *progressReporter {
+	if req == nil || req.Session == nil || req.Params == nil {
+		return nil
+	}
+	token := req.Params.GetProgressToken()
+	if token == nil {
+		return nil
+	}
+	return &progressReporter{ctx: ctx, session: req.Session, token: token, start: time.Now()}
+}
+
+// query returns the progress callback of one query. label prefixes the
+// messages, e.g. "Query 2 of 3: ".
+func (p *progressReporter) query(label string) func(prolog.Progress) {
+	if p == nil {
+		return nil
+	}
+	return func(progress prolog.Progress) {
+		// Progress must increase: use the seconds since the tool call started
+		err := p.session.NotifyProgress(p.ctx, &mcp.ProgressNotificationParams{
+			ProgressToken: p.token,
+			Progress:      time.Since(p.start).Seconds(),
+			Message: fmt.Sprintf("%s%s elapsed, %d inferences, %d solutions found",
+				label, progress.Elapsed.Round(time.Millisecond), progress.Inferences, progress.Solutions),
+		})
+		if err != nil {
+			slog.DebugContext(p.ctx, "failed to send progress notification", "error", err)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/tomasz-sikora/logic-mcp/internal/prolog"
+)
+
+// Clause listing limits
+const (
+	defaultClauseLimit = 200
+	maxClauseLimit     = 5000
+)
+
+// ProvenanceFilter selects clauses by where they came from. Empty fields
+// match everything.
+type ProvenanceFilter struct {
+	Load      int    `json:"load,omitempty" jsonschema:"Number of the load, as reported by the loading tool (optional)."`
+	Tool      string `json:"tool,omitempty" jsonschema:"Name of the tool that added the clauses, e.g. prolog_import_data (optional)."`
+	Session   string `json:"session,omitempty" jsonschema:"Session that added the clauses (optional)."`
+	Caller    string `json:"caller,omitempty" jsonschema:"Authenticated caller that added the clauses (optional)."`
+	Tag       string `json:"tag,omitempty" jsonschema:"Tag given when the clauses were loaded (optional)."`
+	Predicate string `json:"predicate,omitempty" jsonschema:"Predicate indicator of the clauses, e.g. parent/2 (optional)."`
+	Since     string `json:"since,omitempty" jsonschema:"Only clauses added at or after this RFC 3339 time, e.g. 2024-05-01T14:02:00Z (optional)."`
+	Until     string `json:"until,omitempty" jsonschema:"Only clauses added before this RFC 3339 time (optional)."`
+}
+
+// LoadSummary describes one load of the listed clauses
+type LoadSummary struct {
+	Load       int               `json:"load"`
+	Provenance prolog.Provenance `json:"provenance"`
+	Clauses    int               `json:"clauses" jsonschema:"Number of matching clauses of this load."`
+}
+
+// ClausesOutput is the result of prolog_list_clauses
+type ClausesOutput struct {
+	Status
+	Total         int                `json:"total" jsonschema:"Number of matching clauses."`
+	Loads         []LoadSummary      `json:"loads,omitempty" jsonschema:"The loads the matching clauses came from, in order."`
+	Clauses       []prolog.Clause    `json:"clauses,omitempty" jsonschema:"The matching clauses, up to the limit."`
+	Truncated     bool               `json:"truncated,omitempty" jsonschema:"Not every matching clause is listed."`
+	KnowledgeBase KnowledgeBaseStats `json:"knowledge_base"`
+}
+
+// RetractOutput is the result of prolog_retract_clauses
+type RetractOutput struct {
+	Status
+	Retracted     int                `json:"retracted"`
+	KnowledgeBase KnowledgeBaseStats `json:"knowledge_base"`
+}
+
+// registerProvenanceTools registers the tools that list and retract clauses
+// by where they came from
+func (lt *LogicTools) registerProvenanceTools(server *mcp.Server) {
+	type ListInput struct {
+		ProvenanceFilter
+		Limit int `json:"limit,omitempty" jsonschema:"Maximum number of clauses to list (optional, defaults to 200, at most 5000)."`
+	}
+
+	// Register prolog_list_clauses tool
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "prolog_list_clauses",
+		Description: "List the clauses of the knowledge base with their provenance: the tool call that added them, when, by which session and caller, and with which tags. Filter by load, tool, session, caller, tag, predicate or time range.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, input ListInput) (*mcp.CallToolResult, *ClausesOutput, error) {
+		filter, err := input.ProvenanceFilter.parse()
+		if err != nil {
+			msg := "Invalid filter"
+			return errorResult(msg, err), &ClausesOutput{Status: failure(msg, err), KnowledgeBase: lt.knowledgeBaseStats()}, nil
+		}
+		limit := input.Limit
+		if limit <= 0 {
+			limit = defaultClauseLimit
+		}
+		limit = min(limit, maxClauseLimit)
+
+		clauses := lt.engine.Clauses(filter)
+		out := &ClausesOutput{
+			Status:        Status{Success: true},
+			Total:         len(clauses),
+			Loads:         summarizeLoads(clauses),
+			Clauses:       clauses[:min(limit, len(clauses))],
+			Truncated:     len(clauses) > limit,
+			KnowledgeBase: lt.knowledgeBaseStats(),
+		}
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: clausesReport(out)},
+			},
+		}, out, nil
+	})
+
+	// Register prolog_retract_clauses tool
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "prolog_retract_clauses",
+		Description: "Remove the clauses matching a provenance filter from the knowledge base, e.g. everything added by one load, tool call, caller or tag. At least one filter field is required; use prolog_clear_kb to remove everything.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, input ProvenanceFilter) (*mcp.CallToolResult, *RetractOutput, error) {
+		fail := func(msg string, err error) (*mcp.CallToolResult, *RetractOutput, error) {
+			return errorResult(msg, err), &RetractOutput{Status: failure(msg, err), KnowledgeBase: lt.knowledgeBaseStats()}, nil
+		}
+
+		filter, err := input.parse()
+		if err != nil {
+			return fail("Invalid filter", err)
+		}
+		n, err := lt.engine.RetractClauses(filter)
+		if err != nil {
+			return fail("Failed to retract clauses", err)
+		}
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: fmt.Sprintf("Retracted %d clauses", n)},
+			},
+		}, &RetractOutput{Status: Status{Success: true}, Retracted: n, KnowledgeBase: lt.knowledgeBaseStats()}, nil
+	})
+}
+
+// provenance returns the provenance of clauses loaded by tool in this session
+func (lt *LogicTools) provenance(tool string, tags []string) prolog.Provenance {
+	return prolog.Provenance{
+		Tool:    tool,
+		Time:    time.Now().UTC(),
+		Session: lt.opts.Session,
+		Caller:  lt.opts.Caller,
+		Tags:    tags,
+	}
+}
+
+// parse converts the filter to an engine filter
+func (f ProvenanceFilter) parse() (prolog.ClauseFilter, error) {
+	filter := prolog.ClauseFilter{
+		Load:      f.Load,
+		Tool:      strings.TrimSpace(f.Tool),
+		Session:   strings.TrimSpace(f.Session),
+		Caller:    strings.TrimSpace(f.Caller),
+		Tag:       strings.TrimSpace(f.Tag),
+		Predicate: strings.TrimSpace(f.Predicate),
+	}
+	if f.Load < 0 {
+		return filter, fmt.Errorf("load must not be negative")
+	}
+	var err error
+	if f.Since != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, f.Since); err != nil {
+			return filter, fmt.Errorf("invalid since time: %w", err)
+		}
+	}
+	if f.Until != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, f.Until); err != nil {
+			return filter, fmt.Errorf("invalid until time: %w", err)
+		}
+	}
+	return filter, nil
+}
+
+// summarizeLoads counts the clauses per load, in order of first appearance
+func summarizeLoads(clauses []prolog.Clause) []LoadSummary {
+	var loads []LoadSummary
+	index := make(map[int]int)
+	for _, c := range clauses {
+		i, ok := index[c.Source.Load]
+		if !ok {
+			i = len(loads)
+			index[c.Source.Load] = i
+			loads = append(loads, LoadSummary{Load: c.Source.Load, Provenance: c.Provenance})
+		}
+		loads[i].Clauses++
+	}
+	return loads
+}
+
+// clausesReport renders the loads and the listed clauses
+func clausesReport(out *ClausesOutput) string {
+	if out.Total == 0 {
+		return "No clauses match"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d clauses from %d loads\n\n", out.Total, len(out.Loads))
+	for _, l := range out.Loads {
+		fmt.Fprintf(&b, "Load #%d: %d clauses, %s\n", l.Load, l.Clauses, describeProvenance(l.Provenance))
+	}
+	b.WriteString("\n")
+	for _, c := range out.Clauses {
+		fmt.Fprintf(&b, "%s  %% %s\n", c.Text, c.Source)
+	}
+	if out.Truncated {
+		fmt.Fprintf(&b, "\nShowing %d of %d clauses.\n", len(out.Clauses), out.Total)
+	}
+	return b.String()
+}
+
+// describeProvenance renders a provenance as one line
+func describeProvenance(p prolog.Provenance) string {
+	tool := p.Tool
+	if tool == "" {
+		tool = "unknown tool"
+	}
+	parts := []string{fmt.Sprintf("%s at %s", tool, p.Time.UTC().Format(time.RFC3339))}
+	if p.Session != "" {
+		parts = append(parts, "session "+p.Session)
+	}
+	if p.Caller != "" {
+		parts = append(parts, "caller "+p.Caller)
+	}
+	if len(p.Tags) > 0 {
+		parts = append(parts, "tags "+strings.Join(p.Tags, ", "))
+	}
+	return strings.Join(parts, ", ")
+}
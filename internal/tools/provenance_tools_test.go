@@ -0,0 +1,44 @@
+package tools
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomasz-sikora/logic-mcp/internal/prolog"
+)
+
+func TestProvenanceFilter_Parse(t *testing.T) {
+	filter, err := ProvenanceFilter{Tool: " prolog_import_data ", Since: "2024-05-01T14:02:00Z", Until: "2024-05-01T14:03:00+00:00"}.parse()
+	assert.NoError(t, err)
+	assert.Equal(t, "prolog_import_data", filter.Tool)
+	assert.Equal(t, time.Date(2024, 5, 1, 14, 2, 0, 0, time.UTC), filter.Since.UTC())
+	assert.Equal(t, time.Minute, filter.Until.Sub(filter.Since))
+
+	_, err = ProvenanceFilter{Since: "14:02"}.parse()
+	assert.Error(t, err)
+	_, err = ProvenanceFilter{Load: -1}.parse()
+	assert.Error(t, err)
+}
+
+func TestClausesReport(t *testing.T) {
+	at := time.Date(2024, 5, 1, 14, 2, 0, 0, time.UTC)
+	imported := prolog.Provenance{Tool: "prolog_import_data", Time: at, Session: "s1", Caller: "alice", Tags: []string{"hr"}}
+	loaded := prolog.Provenance{Tool: "prolog_load_facts", Time: at.Add(time.Minute)}
+	clauses := []prolog.Clause{
+		{Text: "employee(bob).", Source: prolog.Source{Load: 1, Line: 1, Column: 1}, Provenance: imported},
+		{Text: "employee(eve).", Source: prolog.Source{Load: 1, Line: 2, Column: 1}, Provenance: imported},
+		{Text: "manager(eve).", Source: prolog.Source{Load: 2, Line: 1, Column: 1}, Provenance: loaded},
+	}
+
+	out := &ClausesOutput{Total: 3, Loads: summarizeLoads(clauses), Clauses: clauses[:2], Truncated: true}
+	assert.Equal(t, []LoadSummary{{Load: 1, Provenance: imported, Clauses: 2}, {Load: 2, Provenance: loaded, Clauses: 1}}, out.Loads)
+	assert.Equal(t, "3 clauses from 2 loads\n\n"+
+		"Load #1: 2 clauses, prolog_import_data at 2024-05-01T14:02:00Z, session s1, caller alice, tags hr\n"+
+		"Load #2: 1 clauses, prolog_load_facts at 2024-05-01T14:03:00Z\n\n"+
+		"employee(bob).  % load #1, line 1\n"+
+		"employee(eve).  % load #1, line 2\n"+
+		"\nShowing 2 of 3 clauses.\n", clausesReport(out))
+
+	assert.Equal(t, "No clauses match", clausesReport(&ClausesOutput{}))
+}
@@ -0,0 +1,83 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/tomasz-sikora/logic-mcp/internal/prolog"
+)
+
+// SettingsOutput is the result of prolog_set_flags and prolog_get_flags
+type SettingsOutput struct {
+	Status
+	Flags     map[string]string `json:"flags,omitempty" jsonschema:"Effective value of every flag a session can set."`
+	Operators []prolog.Operator `json:"operators,omitempty" jsonschema:"Operators defined for the session."`
+}
+
+// registerSettingsTools registers the tools that set and read the session
+// flags and operators
+func (lt *LogicTools) registerSettingsTools(server *mcp.Server) {
+	type SetFlagsInput struct {
+		Flags     map[string]string `json:"flags,omitempty" jsonschema:"Flags to set: occurs_check (false, true, error), double_quotes (string, codes, chars, atom), back_quotes (codes, chars, string, symbol_char) and unknown (error, fail, warning)."`
+		Operators []prolog.Operator `json:"operators,omitempty" jsonschema:"Operators to define as with op/3, e.g. {\"priority\": 700, \"type\": \"xfx\", \"name\": \"===>\"}."`
+		Reset     bool              `json:"reset,omitempty" jsonschema:"Restore the default flags and remove the defined operators before applying the others (optional)."`
+	}
+
+	// Register prolog_set_flags tool
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "prolog_set_flags",
+		Description: "Set Prolog flags (occurs_check, double_quotes, back_quotes, unknown) and define operators for the session. Settings persist across calls and apply to loading, syntax validation and every query. Returns the effective settings.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, input SetFlagsInput) (*mcp.CallToolResult, *SettingsOutput, error) {
+		setFlags := lt.engine.SetFlags
+		if input.Reset {
+			setFlags = lt.engine.ReplaceFlags
+		}
+		settings, err := setFlags(input.Flags, input.Operators)
+		if err != nil {
+			msg := "Failed to set flags"
+			return errorResult(msg, err), &SettingsOutput{Status: failure(msg, err)}, nil
+		}
+		return settingsResult(settings)
+	})
+
+	// Register prolog_get_flags tool
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "prolog_get_flags",
+		Description: "Show the effective Prolog flags and the operators defined for the session.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, input struct{}) (*mcp.CallToolResult, *SettingsOutput, error) {
+		return settingsResult(lt.engine.Settings())
+	})
+}
+
+// settingsResult renders the effective settings
+func settingsResult(settings prolog.Settings) (*mcp.CallToolResult, *SettingsOutput, error) {
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: settingsReport(settings)},
+		},
+	}, &SettingsOutput{
+		Status:    Status{Success: true},
+		Flags:     settings.Flags,
+		Operators: settings.Operators,
+	}, nil
+}
+
+// settingsReport lists the flags and operators, one per line
+func settingsReport(settings prolog.Settings) string {
+	var b strings.Builder
+	b.WriteString("Flags:\n")
+	for _, name := range slices.Sorted(maps.Keys(settings.Flags)) {
+		fmt.Fprintf(&b, "  %s = %s\n", name, settings.Flags[name])
+	}
+	if len(settings.Operators) > 0 {
+		b.WriteString("Operators:\n")
+		for _, op := range settings.Operators {
+			fmt.Fprintf(&b, "  op(%d, %s, %s)\n", op.Priority, op.Type, op.Name)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,16 @@
+package tools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomasz-sikora/logic-mcp/internal/prolog"
+)
+
+func TestSettingsReport(t *testing.T) {
+	settings := prolog.Settings{
+		Flags:     map[string]string{"unknown": "fail", "double_quotes": "codes"},
+		Operators: []prolog.Operator{{Priority: 700, Type: "xfx", Name: "===>"}},
+	}
+	assert.Equal(t, "Flags:\n  double_quotes = codes\n  unknown = fail\nOperators:\n  op(700, xfx, ===>)\n", settingsReport(settings))
+}
@@ -0,0 +1,170 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/tomasz-sikora/logic-mcp/internal/metrics"
+	"github.com/tomasz-sikora/logic-mcp/internal/prolog"
+)
+
+// WhatIfOutput is the result of prolog_what_if: the query against the
+// knowledge base and against the knowledge base under the assumptions
+type WhatIfOutput struct {
+	Status
+	Query         string                `json:"query"`
+	Added         int                   `json:"added" jsonschema:"Number of assumed clauses that were not already in the knowledge base."`
+	Hidden        int                   `json:"hidden" jsonschema:"Number of knowledge base clauses left out."`
+	Baseline      *QueryOutput          `json:"baseline,omitempty" jsonschema:"The query against the knowledge base as it is."`
+	Hypothetical  *QueryOutput          `json:"hypothetical,omitempty" jsonschema:"The query under the assumptions."`
+	Changed       bool                  `json:"changed" jsonschema:"The assumptions changed the outcome or the solutions."`
+	Gained        []string              `json:"gained,omitempty" jsonschema:"Solutions found only under the assumptions, as bindings."`
+	Lost          []string              `json:"lost,omitempty" jsonschema:"Solutions found only without the assumptions, as bindings."`
+	Mismatches    []prolog.TypeMismatch `json:"mismatches,omitempty" jsonschema:"Assumed clauses that do not match their declarations, which got the call rejected."`
+	KnowledgeBase KnowledgeBaseStats    `json:"knowledge_base"`
+}
+
+// registerWhatIfTools registers the tool for hypothetical queries
+func (lt *LogicTools) registerWhatIfTools(server *mcp.Server) {
+	type WhatIfInput struct {
+		Query  string   `json:"query" jsonschema:"The Prolog query to run, e.g. 'grandparent(X, ann).'"`
+		Assume string   `json:"assume,omitempty" jsonschema:"Clauses to assume, one per line as for prolog_load_facts, e.g. 'parent(bob, alice).'"`
+		Hide   []string `json:"hide,omitempty" jsonschema:"Clauses of the knowledge base to leave out, e.g. ['parent(tom, bob).'] (optional)."`
+	}
+
+	// Register prolog_what_if tool
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "prolog_what_if",
+		Description: "Run a query under temporary assumptions: extra clauses and clauses of the knowledge base to hide. Returns the result next to the baseline result and the solutions gained and lost. The knowledge base is not changed.",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, input WhatIfInput) (*mcp.CallToolResult, *WhatIfOutput, error) {
+		fail := func(msg string, err error) (*mcp.CallToolResult, *WhatIfOutput, error) {
+			return errorResult(msg, err), &WhatIfOutput{Status: failure(msg, err), Query: input.Query, KnowledgeBase: lt.knowledgeBaseStats()}, nil
+		}
+
+		if strings.TrimSpace(input.Assume) == "" && len(input.Hide) == 0 {
+			return fail("Invalid assumptions", fmt.Errorf("nothing to assume or hide"))
+		}
+		result, err := lt.runWhatIf(ctx, input.Query, prolog.Assumptions{Add: input.Assume, Hide: input.Hide})
+		if err != nil {
+			res, out, _ := fail("Failed to run query under assumptions", err)
+			var mismatched *prolog.DeclarationError
+			if errors.As(err, &mismatched) {
+				out.Mismatches = mismatched.Mismatches
+			}
+			return res, out, nil
+		}
+
+		baseline, err := renderSolutions(input.Query, result.Baseline, OutputOptions{})
+		if err != nil {
+			return fail("Failed to format result", err)
+		}
+		hypothetical, err := renderSolutions(input.Query, result.Hypothetical, OutputOptions{})
+		if err != nil {
+			return fail("Failed to format result", err)
+		}
+
+		out := &WhatIfOutput{
+			Status:        Status{Success: result.Baseline.Error == "" && result.Hypothetical.Error == ""},
+			Query:         input.Query,
+			Added:         result.Added,
+			Hidden:        result.Hidden,
+			Baseline:      baseline.Output,
+			Hypothetical:  hypothetical.Output,
+			KnowledgeBase: lt.knowledgeBaseStats(),
+		}
+		out.Gained, out.Lost = compareSolutions(out.Baseline, out.Hypothetical)
+		out.Changed = out.Baseline.Success != out.Hypothetical.Success || len(out.Gained) > 0 || len(out.Lost) > 0
+
+		var responseText strings.Builder
+		responseText.WriteString(fmt.Sprintf("What if: %d clauses assumed, %d hidden\n\n", out.Added, out.Hidden))
+		responseText.WriteString("Baseline:\n")
+		responseText.WriteString(withNote(baseline))
+		responseText.WriteString("\nUnder the assumptions:\n")
+		responseText.WriteString(withNote(hypothetical))
+		responseText.WriteString("\n" + changesReport(out))
+
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: responseText.String()},
+			},
+		}, out, nil
+	})
+}
+
+// runWhatIf runs a hypothetical query on the session engine, which admits
+// both of its queries by the quotas
+func (lt *LogicTools) runWhatIf(ctx context.Context, query string, a prolog.Assumptions) (*prolog.WhatIfResult, error) {
+	result, err := lt.engine.WhatIf(ctx, query, a)
+	if err != nil {
+		metrics.ObserveQuery("prolog_what_if", queryOutcome(ctx, nil, err), 0)
+		return nil, err
+	}
+	for _, r := range []*prolog.QueryResult{result.Baseline, result.Hypothetical} {
+		metrics.ObserveQuery("prolog_what_if", queryOutcome(ctx, r, nil), r.ExecutionTime)
+	}
+	return result, nil
+}
+
+// withNote returns the text rendering of a result followed by its note
+func withNote(r *rendered) string {
+	if r.Note == "" {
+		return r.Body
+	}
+	return r.Body + r.Note + "\n"
+}
+
+// compareSolutions returns the solutions only in hypothetical and only in
+// baseline, as bindings. Solutions beyond the solution limit are not
+// compared.
+func compareSolutions(baseline, hypothetical *QueryOutput) (gained, lost []string) {
+	bindings := func(t *QueryOutput) (list []string, set map[string]bool) {
+		set = make(map[string]bool)
+		for _, row := range t.Solutions {
+			b := formatBindings(t.Columns, row)
+			if !set[b] {
+				list = append(list, b)
+				set[b] = true
+			}
+		}
+		return list, set
+	}
+	before, inBefore := bindings(baseline)
+	after, inAfter := bindings(hypothetical)
+	for _, b := range after {
+		if !inBefore[b] {
+			gained = append(gained, b)
+		}
+	}
+	for _, b := range before {
+		if !inAfter[b] {
+			lost = append(lost, b)
+		}
+	}
+	return gained, lost
+}
+
+// changesReport summarizes how the assumptions changed the result
+func changesReport(out *WhatIfOutput) string {
+	if !out.Changed {
+		return "No change: the assumptions do not affect the result.\n"
+	}
+	var b strings.Builder
+	switch {
+	case out.Hypothetical.Success && !out.Baseline.Success:
+		b.WriteString("Changed: the query succeeds under the assumptions.\n")
+	case out.Baseline.Success && !out.Hypothetical.Success:
+		b.WriteString("Changed: the query fails under the assumptions.\n")
+	default:
+		b.WriteString("Changed:\n")
+	}
+	for _, g := range out.Gained {
+		b.WriteString(fmt.Sprintf("  + %s\n", g))
+	}
+	for _, l := range out.Lost {
+		b.WriteString(fmt.Sprintf("  - %s\n", l))
+	}
+	return b.String()
+}
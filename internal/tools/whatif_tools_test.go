@@ -0,0 +1,32 @@
+package tools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareSolutions(t *testing.T) {
+	baseline := &QueryOutput{
+		Status:    Status{Success: true},
+		Columns:   []string{"X", "Y"},
+		Solutions: []map[string]string{{"X": "tom", "Y": "bob"}, {"X": "bob", "Y": "ann"}},
+	}
+	hypothetical := &QueryOutput{
+		Status:    Status{Success: true},
+		Columns:   []string{"X", "Y"},
+		Solutions: []map[string]string{{"X": "bob", "Y": "ann"}, {"X": "bob", "Y": "alice"}, {"X": "bob", "Y": "alice"}},
+	}
+
+	gained, lost := compareSolutions(baseline, hypothetical)
+	assert.Equal(t, []string{"X = bob, Y = alice"}, gained)
+	assert.Equal(t, []string{"X = tom, Y = bob"}, lost)
+
+	out := &WhatIfOutput{Baseline: baseline, Hypothetical: hypothetical, Changed: true, Gained: gained, Lost: lost}
+	assert.Equal(t, "Changed:\n  + X = bob, Y = alice\n  - X = tom, Y = bob\n", changesReport(out))
+
+	failed := &QueryOutput{}
+	out = &WhatIfOutput{Baseline: failed, Hypothetical: &QueryOutput{Status: Status{Success: true}}, Changed: true}
+	assert.Equal(t, "Changed: the query succeeds under the assumptions.\n", changesReport(out))
+	assert.Equal(t, "No change: the assumptions do not affect the result.\n", changesReport(&WhatIfOutput{Baseline: failed, Hypothetical: failed}))
+}
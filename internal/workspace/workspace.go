@@ -0,0 +1,209 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Extension is the only file type a workspace exposes
+const Extension = ".pl"
+
+// ErrOutsideRoot is returned for paths that escape their root directory
+var ErrOutsideRoot = errors.New("path is outside the workspace root")
+
+// Root is an allowlisted directory of Prolog files
+type Root struct {
+	// Name identifies the root in tool calls; it is the directory's base name
+	Name string
+	// Dir is the absolute, symlink-free directory path
+	Dir string
+}
+
+// File is a Prolog file inside a root
+type File struct {
+	Root string `json:"root"`
+	// Path is slash-separated and relative to the root
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// Workspace resolves relative paths against allowlisted root directories
+// and never hands out a path outside of them
+type Workspace struct {
+	roots []Root
+}
+
+// New creates a workspace from root directories. Root names (directory
+// base names) must be unique.
+func New(dirs []string) (*Workspace, error) {
+	w := &Workspace{}
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		abs, err = filepath.EvalSymlinks(abs)
+		if err != nil {
+			return nil, fmt.Errorf("workspace root: %w", err)
+		}
+		info, err := os.Stat(abs)
+		if err != nil {
+			return nil, fmt.Errorf("workspace root: %w", err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("workspace root %s is not a directory", dir)
+		}
+
+		name := filepath.Base(abs)
+		if slices.ContainsFunc(w.roots, func(r Root) bool { return r.Name == name }) {
+			return nil, fmt.Errorf("duplicate workspace root name %q", name)
+		}
+		w.roots = append(w.roots, Root{Name: name, Dir: abs})
+	}
+	if len(w.roots) == 0 {
+		return nil, errors.New("no workspace roots configured")
+	}
+	return w, nil
+}
+
+// Roots returns the configured roots
+func (w *Workspace) Roots() []Root {
+	return slices.Clone(w.roots)
+}
+
+// root returns the named root, or the first one if name is empty
+func (w *Workspace) root(name string) (Root, error) {
+	if name == "" {
+		return w.roots[0], nil
+	}
+	for _, r := range w.roots {
+		if r.Name == name {
+			return r, nil
+		}
+	}
+	return Root{}, fmt.Errorf("unknown workspace root %q", name)
+}
+
+// Glob returns the Prolog files of a root matching a slash-separated
+// pattern. Besides the path.Match syntax, a "**" segment matches any
+// number of directories. A pattern without wildcards names a single file.
+func (w *Workspace) Glob(rootName, pattern string) ([]File, error) {
+	r, err := w.root(rootName)
+	if err != nil {
+		return nil, err
+	}
+	pattern, err = cleanRelative(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	var files []File
+	err = filepath.WalkDir(r.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(p) != Extension {
+			return nil
+		}
+		rel, err := filepath.Rel(r.Dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/")) {
+			return nil
+		}
+		// Symlinks are followed only if they stay inside the root
+		if _, err := w.resolve(r, rel); err != nil {
+			return nil
+		}
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil
+		}
+		files = append(files, File{Root: r.Name, Path: rel, Size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// Open resolves a file returned by Glob and returns its absolute path
+func (w *Workspace) Open(f File) (string, error) {
+	r, err := w.root(f.Root)
+	if err != nil {
+		return "", err
+	}
+	rel, err := cleanRelative(f.Path)
+	if err != nil {
+		return "", err
+	}
+	return w.resolve(r, rel)
+}
+
+// resolve joins rel to the root and checks that the result, with symlinks
+// evaluated, is a Prolog file inside the root
+func (w *Workspace) resolve(r Root, rel string) (string, error) {
+	if filepath.Ext(rel) != Extension {
+		return "", fmt.Errorf("%s is not a %s file", rel, Extension)
+	}
+	real, err := filepath.EvalSymlinks(filepath.Join(r.Dir, filepath.FromSlash(rel)))
+	if err != nil {
+		return "", err
+	}
+	inside, err := filepath.Rel(r.Dir, real)
+	if err != nil || inside == ".." || strings.HasPrefix(inside, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s: %w", rel, ErrOutsideRoot)
+	}
+	return real, nil
+}
+
+// cleanRelative rejects absolute paths and paths climbing out of the root
+func cleanRelative(p string) (string, error) {
+	p = filepath.ToSlash(strings.TrimSpace(p))
+	if p == "" {
+		return "", errors.New("empty path")
+	}
+	if path.IsAbs(p) || filepath.IsAbs(p) || filepath.VolumeName(p) != "" {
+		return "", fmt.Errorf("%s: paths must be relative to the workspace root", p)
+	}
+	p = path.Clean(p)
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return "", fmt.Errorf("%s: %w", p, ErrOutsideRoot)
+	}
+	return p, nil
+}
+
+// matchSegments matches path segments against pattern segments, where a
+// "**" pattern segment matches zero or more path segments
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
@@ -0,0 +1,88 @@
+package workspace
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestWorkspace(t *testing.T) (*Workspace, string) {
+	t.Helper()
+
+	base := t.TempDir()
+	root := filepath.Join(base, "rules")
+	for _, f := range []string{"family.pl", "geo/europe.pl", "geo/deep/asia.pl", "notes.txt"} {
+		p := filepath.Join(root, filepath.FromSlash(f))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte("fact(x).\n"), 0o644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(base, "secret.pl"), []byte("secret(x).\n"), 0o644))
+
+	w, err := New([]string{root})
+	require.NoError(t, err)
+	return w, base
+}
+
+func paths(files []File) []string {
+	var out []string
+	for _, f := range files {
+		out = append(out, f.Path)
+	}
+	return out
+}
+
+func TestWorkspace_Glob(t *testing.T) {
+	w, _ := newTestWorkspace(t)
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"family.pl", []string{"family.pl"}},
+		{"*.pl", []string{"family.pl"}},
+		{"geo/*.pl", []string{"geo/europe.pl"}},
+		{"**/*.pl", []string{"family.pl", "geo/deep/asia.pl", "geo/europe.pl"}},
+		{"geo/**/*.pl", []string{"geo/deep/asia.pl", "geo/europe.pl"}},
+		{"notes.txt", nil},
+		{"./geo/../family.pl", []string{"family.pl"}},
+	}
+	for _, tt := range tests {
+		files, err := w.Glob("", tt.pattern)
+		require.NoError(t, err, tt.pattern)
+		assert.Equal(t, tt.want, paths(files), tt.pattern)
+	}
+}
+
+func TestWorkspace_RejectsTraversal(t *testing.T) {
+	w, base := newTestWorkspace(t)
+
+	for _, pattern := range []string{"../secret.pl", "geo/../../secret.pl", filepath.Join(base, "secret.pl")} {
+		_, err := w.Glob("", pattern)
+		assert.Error(t, err, pattern)
+	}
+
+	_, err := w.Open(File{Root: "rules", Path: "../secret.pl"})
+	assert.True(t, errors.Is(err, ErrOutsideRoot), "got %v", err)
+
+	_, err = w.Glob("other", "*.pl")
+	assert.Error(t, err)
+}
+
+func TestWorkspace_SymlinkEscape(t *testing.T) {
+	w, base := newTestWorkspace(t)
+	link := filepath.Join(base, "rules", "escape.pl")
+	if err := os.Symlink(filepath.Join(base, "secret.pl"), link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	files, err := w.Glob("", "*.pl")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"family.pl"}, paths(files))
+
+	_, err = w.Open(File{Root: "rules", Path: "escape.pl"})
+	assert.True(t, errors.Is(err, ErrOutsideRoot), "got %v", err)
+}
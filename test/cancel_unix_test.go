@@ -0,0 +1,60 @@
+//go:build unix
+
+package prolog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tomasz-sikora/logic-mcp/internal/prolog"
+)
+
+func TestEngine_CancelKillsSwipl(t *testing.T) {
+	engine, err := prolog.NewEngine()
+	require.NoError(t, err)
+	defer engine.Close()
+
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	query := fmt.Sprintf("current_prolog_flag(pid, P), open('%s', write, S), write(S, P), close(S), repeat, fail.", pidFile)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan *prolog.QueryResult)
+	go func() {
+		result, _ := engine.Query(ctx, query)
+		done <- result
+	}()
+
+	var pid int
+	require.Eventually(t, func() bool {
+		data, err := os.ReadFile(pidFile)
+		if err != nil {
+			return false
+		}
+		pid, err = strconv.Atoi(string(data))
+		return err == nil
+	}, 10*time.Second, 50*time.Millisecond, "swipl did not start")
+
+	cancel()
+	start := time.Now()
+	select {
+	case result := <-done:
+		assert.False(t, result.Success)
+		assert.Contains(t, result.Error, "cancelled")
+	case <-time.After(3 * time.Second):
+		t.Fatal("query kept running after cancellation")
+	}
+	assert.Less(t, time.Since(start), 3*time.Second)
+
+	// The process is reaped by the time Query returns
+	err = syscall.Kill(pid, 0)
+	assert.True(t, errors.Is(err, syscall.ESRCH), "swipl process %d still exists: %v", pid, err)
+}
@@ -2,6 +2,11 @@ package prolog
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -190,3 +195,674 @@ grandparent(X, Z) :- parent(X, Y), parent(Y, Z).
 		})
 	}
 }
+
+func TestEngine_CloseCancelsRunningQuery(t *testing.T) {
+	engine, err := prolog.NewEngine()
+	require.NoError(t, err)
+
+	done := make(chan *prolog.QueryResult)
+	go func() {
+		result, _ := engine.Query(context.Background(), "repeat, fail.")
+		done <- result
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	require.NoError(t, engine.Close())
+
+	select {
+	case result := <-done:
+		require.NotNil(t, result)
+		assert.False(t, result.Success)
+		assert.Contains(t, result.Error, "shutting down")
+	case <-time.After(5 * time.Second):
+		t.Fatal("query kept running after Close")
+	}
+}
+
+func TestEngine_ShutdownWaitsForRunningQuery(t *testing.T) {
+	engine, err := prolog.NewEngine()
+	require.NoError(t, err)
+
+	done := make(chan *prolog.QueryResult)
+	go func() {
+		result, _ := engine.Query(context.Background(), "sleep(0.5).")
+		done <- result
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, engine.Shutdown(ctx))
+
+	result := <-done
+	assert.True(t, result.Success, "query should have drained: %s", result.Error)
+}
+
+func TestLibrary_PreloadAndReload(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "ontology.pl")
+	require.NoError(t, os.WriteFile(file, []byte("kind(cat, mammal).\n"), 0o644))
+
+	library, err := prolog.NewLibrary([]string{dir}, "")
+	require.NoError(t, err)
+	defer library.Close()
+	assert.Contains(t, library.Info().Predicates, "kind/2")
+
+	engine, err := prolog.NewEngineWithOptions(prolog.EngineOptions{Library: library})
+	require.NoError(t, err)
+	defer engine.Close()
+
+	ctx := context.Background()
+	result, err := engine.Query(ctx, "kind(cat, mammal).")
+	require.NoError(t, err)
+	assert.True(t, result.Success, result.Error)
+
+	// Sessions may not redefine library predicates
+	assert.Error(t, engine.LoadFacts("kind(dog, reptile)."))
+
+	// A changed file is picked up by the next query
+	require.NoError(t, os.WriteFile(file, []byte("kind(cat, mammal).\nkind(dog, mammal).\n"), 0o644))
+	require.NoError(t, os.Chtimes(file, time.Now(), time.Now().Add(time.Second)))
+	reloaded, err := library.Reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+
+	result, err = engine.Query(ctx, "kind(dog, mammal).")
+	require.NoError(t, err)
+	assert.True(t, result.Success, result.Error)
+}
+
+func TestEngine_LibraryClausesInProofs(t *testing.T) {
+	// Library clauses share line numbers with the knowledge base
+	var lib, kb strings.Builder
+	for i := 1; i <= 60; i++ {
+		fmt.Fprintf(&lib, "kind(c%d, mammal).\n", i)
+		fmt.Fprintf(&kb, "owner(c%d, p%d).\n", i, i)
+	}
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ontology.pl"), []byte(lib.String()), 0o644))
+	library, err := prolog.NewLibrary([]string{dir}, "")
+	require.NoError(t, err)
+	defer library.Close()
+
+	engine, err := prolog.NewEngineWithOptions(prolog.EngineOptions{Library: library})
+	require.NoError(t, err)
+	defer engine.Close()
+	require.NoError(t, engine.LoadFacts(kb.String()))
+
+	// Only knowledge base clauses are named in the proof
+	for i := 20; i <= 40; i += 10 {
+		ent, err := engine.Entails(context.Background(), fmt.Sprintf("kind(c%d, K), owner(c%d, O).", i, i), prolog.EntailOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, prolog.VerdictProvable, ent.Verdict)
+		require.Len(t, ent.Proof, 2)
+		assert.Empty(t, ent.Proof[0].Clause, "library clause at line %d", i)
+		assert.Nil(t, ent.Proof[0].Source)
+		assert.Equal(t, fmt.Sprintf("owner(c%d, p%d).", i, i), ent.Proof[1].Clause)
+		require.NotNil(t, ent.Proof[1].Source)
+		assert.Equal(t, i, ent.Proof[1].Source.Line)
+	}
+
+	// Violations rest only on knowledge base facts as well
+	_, err = engine.AddConstraints(":- kind(X, mammal), owner(X, p30).")
+	require.NoError(t, err)
+	report, err := engine.CheckConsistency(context.Background())
+	require.NoError(t, err)
+	require.Len(t, report.Violations, 1)
+	assert.Equal(t, "X = c30", report.Violations[0].Bindings)
+	require.Len(t, report.Violations[0].Facts, 1)
+	assert.Equal(t, "owner(c30, p30).", report.Violations[0].Facts[0].Text)
+	assert.Equal(t, 30, report.Violations[0].Facts[0].Source.Line)
+}
+
+func TestEngine_SolutionTerms(t *testing.T) {
+	engine, err := prolog.NewEngine()
+	require.NoError(t, err)
+	defer engine.Close()
+
+	query := `X = f('A', "s", 123456789012345678901234567890, 1.5, [a|T], T), Y = T, Z = [], C = g(C).`
+	result, err := engine.Query(context.Background(), query)
+	require.NoError(t, err)
+	require.True(t, result.Success, result.Error)
+	require.Len(t, result.Terms, 1)
+
+	data, err := json.Marshal(result.Terms[0])
+	require.NoError(t, err)
+	var decoded map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(data, &decoded))
+
+	assert.JSONEq(t, `{"type":"compound","functor":"f","args":[
+		{"type":"atom","value":"A"},
+		{"type":"string","value":"s"},
+		{"type":"integer","value":"123456789012345678901234567890"},
+		{"type":"float","value":1.5},
+		{"type":"list","elements":[{"type":"atom","value":"a"}],"tail":{"type":"var","name":"_0"}},
+		{"type":"var","name":"_0"}]}`, string(decoded["X"]))
+	assert.JSONEq(t, `{"type":"var","name":"_0"}`, string(decoded["Y"]))
+	assert.JSONEq(t, `{"type":"list","elements":[]}`, string(decoded["Z"]))
+	assert.Contains(t, string(decoded["C"]), `"type":"cyclic"`)
+}
+
+func TestEngine_QueryProgress(t *testing.T) {
+	engine, err := prolog.NewEngine()
+	require.NoError(t, err)
+	defer engine.Close()
+
+	var reports []prolog.Progress
+	result, err := engine.QueryWithProgress(context.Background(),
+		"between(1, 3, X), sleep(0.8).", func(p prolog.Progress) { reports = append(reports, p) })
+	require.NoError(t, err)
+	require.True(t, result.Success, result.Error)
+	assert.Len(t, result.Solutions, 3)
+	assert.NotContains(t, result.Output(), "PROGRESS")
+
+	require.NotEmpty(t, reports)
+	last := reports[len(reports)-1]
+	assert.Greater(t, last.Inferences, int64(0))
+	assert.GreaterOrEqual(t, last.Solutions, 1)
+	assert.GreaterOrEqual(t, last.Elapsed, time.Second)
+}
+
+func TestEngine_QueryBatch(t *testing.T) {
+	engine, err := prolog.NewEngine()
+	require.NoError(t, err)
+	defer engine.Close()
+
+	require.NoError(t, engine.LoadFacts("edge(a, b).\nedge(b, c).\n"))
+
+	queries := []string{"edge(a, X).", "edge(c, _).", "sleep(0.5).", "sleep(0.5).", "sleep(0.5).", "sleep(0.5)."}
+	start := time.Now()
+	results, err := engine.QueryBatch(context.Background(), queries, 4)
+	require.NoError(t, err)
+	require.Len(t, results, len(queries))
+
+	assert.True(t, results[0].Success, results[0].Error)
+	assert.Equal(t, "b", results[0].Solutions[0]["X"])
+	assert.False(t, results[1].Success)
+	for _, result := range results[2:] {
+		assert.True(t, result.Success, result.Error)
+	}
+	// Four half-second sleeps in parallel, the rest in the second round
+	assert.Less(t, time.Since(start), 1800*time.Millisecond)
+}
+
+func TestEngine_LoadFactsIdempotent(t *testing.T) {
+	engine, err := prolog.NewEngine()
+	require.NoError(t, err)
+	defer engine.Close()
+
+	facts := "color(red).\ncolor(green).\nbright(C) :- color(C)."
+	first, err := engine.LoadFactsWithOptions(facts, prolog.LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, first.Added)
+
+	// Reformatted and renamed clauses are the same clauses
+	second, err := engine.LoadFactsWithOptions("color( red ).\nbright(X):-color(X).", prolog.LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, second.Added)
+	assert.Equal(t, 2, second.Skipped)
+	assert.Equal(t, first.Hash, second.Hash)
+
+	result, err := engine.Query(context.Background(), "bright(C).")
+	require.NoError(t, err)
+	assert.Len(t, result.Solutions, 2)
+
+	replaced, err := engine.LoadFactsWithOptions("color(green).\ncolor(blue).", prolog.LoadOptions{Mode: prolog.LoadReplace})
+	require.NoError(t, err)
+	assert.Equal(t, 1, replaced.Added)
+	assert.Equal(t, 1, replaced.Skipped)
+	assert.Equal(t, 1, replaced.Replaced)
+	assert.Equal(t, replaced.Hash, engine.KnowledgeBaseHash())
+
+	result, err = engine.Query(context.Background(), "color(C).")
+	require.NoError(t, err)
+	require.Len(t, result.Solutions, 2)
+	assert.Equal(t, "green", result.Solutions[0]["C"])
+	assert.Equal(t, "blue", result.Solutions[1]["C"])
+}
+
+func TestEngine_QueryInjection(t *testing.T) {
+	engine, err := prolog.NewEngine()
+	require.NoError(t, err)
+	defer engine.Close()
+
+	ctx := context.Background()
+	marker := filepath.Join(t.TempDir(), "injected")
+	injections := []string{
+		"true) -> true ; true), halt. evil :- (open('" + marker + "', write, S), close(S)",
+		"true. :- open('" + marker + "', write, S), close(S).",
+		"X.",
+		"42.",
+	}
+	for _, query := range injections {
+		result, err := engine.Query(ctx, query)
+		require.NoError(t, err, query)
+		assert.False(t, result.Success, query)
+		assert.NotEmpty(t, result.Error, query)
+	}
+	assert.NoFileExists(t, marker)
+
+	// Variable names come from the reader; _-prefixed ones are hidden
+	result, err := engine.Query(ctx, "X = 'a, B', _Hidden = 1, Y = \"C\".")
+	require.NoError(t, err)
+	require.True(t, result.Success, result.Error)
+	assert.Equal(t, []string{"X", "Y"}, result.Variables)
+	assert.Equal(t, "'a, B'", result.Solutions[0]["X"])
+
+	// The result file is not named by any clause, and printing the status
+	// line does not fake a success
+	result, err = engine.Query(ctx, "logic_mcp_result_file(F).")
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+	result, err = engine.Query(ctx, `format("__LOGIC_MCP_STATUS__\ttrue~nSUCCESS: true~n"), fail.`)
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+	assert.Contains(t, result.Stdout, "SUCCESS: true")
+}
+
+func TestEngine_OutputChannels(t *testing.T) {
+	engine, err := prolog.NewEngine()
+	require.NoError(t, err)
+	defer engine.Close()
+
+	require.NoError(t, engine.LoadFacts("lonely(X) :- true.\nok."))
+	ctx := context.Background()
+
+	// Printing the outcome text does not fake an outcome
+	result, err := engine.Query(ctx, "write('SUCCESS: true'), nl, fail.")
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+	assert.Equal(t, "SUCCESS: true\n", result.Stdout)
+
+	result, err = engine.Query(ctx, "format(user_error, \"note~n\", []), ok.")
+	require.NoError(t, err)
+	assert.True(t, result.Success, result.Error)
+	assert.Empty(t, result.Stdout)
+	assert.Equal(t, "note\n", result.Stderr)
+
+	// Load warnings are reported with the clause that caused them
+	require.NotEmpty(t, result.Warnings)
+	assert.Contains(t, result.Warnings[0].Text, "Singleton")
+	assert.Equal(t, "lonely(X) :- true.", result.Warnings[0].Clause)
+}
+
+func TestEngine_MessagesPointAtLoads(t *testing.T) {
+	engine, err := prolog.NewEngine()
+	require.NoError(t, err)
+	defer engine.Close()
+
+	require.NoError(t, engine.LoadFacts("a.\nb."))
+	result, err := engine.LoadFactsWithOptions("c.\n\n  broken(x y).\nd.", prolog.LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Load)
+
+	query, err := engine.Query(context.Background(), "d.")
+	require.NoError(t, err)
+	require.NotEmpty(t, query.Errors)
+	msg := query.Errors[0]
+	assert.Contains(t, msg.Text, "load #2, line 3, column")
+	assert.Equal(t, "broken(x y).", msg.Clause)
+	require.NotNil(t, msg.Source)
+	assert.Equal(t, 2, msg.Source.Load)
+	assert.Equal(t, 3, msg.Source.Line)
+	assert.Contains(t, msg.Snippet, "3 | broken(x y).")
+}
+
+func TestEngine_ClauseProvenance(t *testing.T) {
+	engine, err := prolog.NewEngine()
+	require.NoError(t, err)
+	defer engine.Close()
+
+	at := time.Date(2024, 5, 1, 14, 2, 0, 0, time.UTC)
+	_, err = engine.LoadFactsWithOptions("employee(alice).\nemployee(bob).", prolog.LoadOptions{
+		Provenance: prolog.Provenance{Tool: "prolog_import_data", Time: at, Caller: "alice", Tags: []string{"hr"}},
+	})
+	require.NoError(t, err)
+	_, err = engine.LoadFactsWithOptions("manager(alice).", prolog.LoadOptions{
+		Provenance: prolog.Provenance{Tool: "prolog_load_facts"},
+	})
+	require.NoError(t, err)
+
+	imported := engine.Clauses(prolog.ClauseFilter{Tag: "hr"})
+	require.Len(t, imported, 2)
+	assert.Equal(t, "employee(alice).", imported[0].Text)
+	assert.Equal(t, "prolog_import_data", imported[0].Provenance.Tool)
+	assert.Equal(t, at, imported[0].Provenance.Time)
+
+	loaded := engine.Clauses(prolog.ClauseFilter{Tool: "prolog_load_facts"})
+	require.Len(t, loaded, 1)
+	assert.False(t, loaded[0].Provenance.Time.IsZero(), "load time defaults to now")
+
+	_, err = engine.RetractClauses(prolog.ClauseFilter{})
+	assert.Error(t, err, "an empty filter would remove everything")
+
+	n, err := engine.RetractClauses(prolog.ClauseFilter{Caller: "alice", Until: at.Add(time.Minute)})
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	assert.Equal(t, []string{"manager(alice)."}, engine.GetLoadedFacts())
+}
+
+func TestEngine_Directives(t *testing.T) {
+	engine, err := prolog.NewEngine()
+	require.NoError(t, err)
+	defer engine.Close()
+
+	// Directives apply to the clauses loaded after them
+	require.NoError(t, engine.LoadFacts(":- use_module(library(clpfd))."))
+	require.NoError(t, engine.LoadFacts("small(X) :- X #< 3, X #>= 0, label([X])."))
+	result, err := engine.Query(context.Background(), "small(X).")
+	require.NoError(t, err)
+	assert.Len(t, result.Solutions, 3)
+
+	// and not to those before them, even in the same load
+	require.NoError(t, engine.LoadFacts("word(\"ab\").\n:- set_prolog_flag(double_quotes, codes).\ncodes(\"ab\")."))
+	result, err = engine.Query(context.Background(), "word(W), string(W), codes(C), is_list(C).")
+	require.NoError(t, err)
+	assert.True(t, result.Success, result.Error)
+
+	// Rejected directives are all reported and nothing of the load is added
+	err = engine.LoadFacts(":- initialization(main).\nok.\n:- use_module(library(process)).")
+	var rejected *prolog.DirectiveError
+	require.ErrorAs(t, err, &rejected)
+	require.Len(t, rejected.Rejected, 2)
+	assert.Equal(t, 1, rejected.Rejected[0].Source.Line)
+	assert.Equal(t, 3, rejected.Rejected[1].Source.Line)
+	assert.NotContains(t, engine.GetLoadedFacts(), "ok.")
+
+	// Allowed directives that fail are reported by the load
+	err = engine.LoadFacts(":- op(1300, xfx, ===>).")
+	assert.ErrorContains(t, err, "directives failed")
+}
+
+func TestEngine_Settings(t *testing.T) {
+	engine, err := prolog.NewEngine()
+	require.NoError(t, err)
+	defer engine.Close()
+
+	_, err = engine.SetFlags(map[string]string{"double_quotes": "codes", "occurs_check": "true"},
+		[]prolog.Operator{{Priority: 700, Type: "xfx", Name: "===>"}})
+	require.NoError(t, err)
+
+	// Operators apply to loaded clauses and to the query
+	require.NoError(t, engine.LoadFacts("rule(a ===> b).\nword(\"hi\")."))
+	result, err := engine.Query(context.Background(), "rule(X ===> Y).")
+	require.NoError(t, err)
+	require.Len(t, result.Solutions, 1)
+	assert.Equal(t, "b", result.Solutions[0]["Y"])
+
+	result, err = engine.Query(context.Background(), "word(W), W == [104, 105].")
+	require.NoError(t, err)
+	assert.True(t, result.Success, "double_quotes applies to clauses")
+
+	result, err = engine.Query(context.Background(), `X = "ab".`)
+	require.NoError(t, err)
+	require.Len(t, result.Solutions, 1)
+	assert.Equal(t, "[97,98]", result.Solutions[0]["X"], "double_quotes applies to the query")
+
+	result, err = engine.Query(context.Background(), "X = f(X).")
+	require.NoError(t, err)
+	assert.False(t, result.Success, "occurs_check applies to execution")
+
+	// Consulted files are compiled with the same settings
+	path := filepath.Join(t.TempDir(), "rules.pl")
+	require.NoError(t, os.WriteFile(path, []byte("rule(c ===> d).\nword2(\"ok\").\n"), 0644))
+	consulted, err := engine.ConsultFile(context.Background(), path, "rules.pl", prolog.LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, consulted.Clauses)
+	assert.Empty(t, consulted.Warnings)
+	result, err = engine.Query(context.Background(), "rule(c ===> X), word2(W), W == [111, 107].")
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+
+	// Syntax checks read with the same settings
+	msgs, err := engine.CheckSyntax(context.Background(), "ok(a ===> b).\nbad(a b).")
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, 2, msgs[0].Source.Line)
+
+	engine.ResetFlags()
+	msgs, err = engine.CheckSyntax(context.Background(), "ok(a ===> b).")
+	require.NoError(t, err)
+	assert.Len(t, msgs, 1)
+
+	// Operators of the session and the knowledge base do not change how
+	// the driver is read, only the clauses after them and the query
+	_, err = engine.SetFlags(nil, []prolog.Operator{{Priority: 0, Type: "xfy", Name: "->"}, {Priority: 0, Type: "xfx", Name: "is"}})
+	require.NoError(t, err)
+	require.NoError(t, engine.LoadFacts(":- op(0, xfy, ;).\n:- op(0, xfx, =<).\nn(1)."))
+	result, err = engine.Query(context.Background(), "n(X).")
+	require.NoError(t, err)
+	require.True(t, result.Success, result.Error)
+	assert.Equal(t, "1", result.Solutions[0]["X"])
+	msgs, err = engine.CheckSyntax(context.Background(), "ok(a).")
+	require.NoError(t, err)
+	assert.Empty(t, msgs)
+}
+
+func TestEngine_WhatIf(t *testing.T) {
+	engine, err := prolog.NewEngine()
+	require.NoError(t, err)
+	defer engine.Close()
+
+	require.NoError(t, engine.LoadFacts("parent(tom, bob).\nparent(bob, ann).\ngrandparent(X, Z) :- parent(X, Y), parent(Y, Z)."))
+	hash := engine.KnowledgeBaseHash()
+
+	result, err := engine.WhatIf(context.Background(), "grandparent(G, C).", prolog.Assumptions{
+		Add:  "parent(bob, alice).\nparent(tom, bob).",
+		Hide: []string{"parent(bob,ann)"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Added, "clauses already loaded are not assumed twice")
+	assert.Equal(t, 1, result.Hidden)
+	require.Len(t, result.Baseline.Solutions, 1)
+	assert.Equal(t, "ann", result.Baseline.Solutions[0]["C"])
+	require.Len(t, result.Hypothetical.Solutions, 1)
+	assert.Equal(t, "alice", result.Hypothetical.Solutions[0]["C"])
+
+	// The knowledge base is unchanged
+	assert.Equal(t, hash, engine.KnowledgeBaseHash())
+
+	_, err = engine.WhatIf(context.Background(), "true.", prolog.Assumptions{Hide: []string{"parent(ann, joe)."}})
+	assert.ErrorContains(t, err, "not in the knowledge base")
+
+	// Hiding a fact makes the query fail under the assumptions only
+	result, err = engine.WhatIf(context.Background(), "grandparent(tom, ann).", prolog.Assumptions{
+		Hide: []string{"parent(bob, ann)."},
+	})
+	require.NoError(t, err)
+	assert.True(t, result.Baseline.Success)
+	assert.False(t, result.Hypothetical.Success)
+	assert.Empty(t, result.Hypothetical.Error)
+
+	// Assumptions must match the declarations like loaded clauses
+	require.NoError(t, engine.LoadFacts(":- pred parent(atom, atom)."))
+	_, err = engine.WhatIf(context.Background(), "parent(X, Y).", prolog.Assumptions{Add: "parent(bob, 7)."})
+	var mismatch *prolog.DeclarationError
+	require.ErrorAs(t, err, &mismatch)
+	assert.Equal(t, "argument 2 of parent/2: expected atom, got 7", mismatch.Mismatches[0].Reason)
+}
+
+func TestEngine_Entails(t *testing.T) {
+	engine, err := prolog.NewEngine()
+	require.NoError(t, err)
+	defer engine.Close()
+
+	require.NoError(t, engine.LoadFacts("parent(tom, bob).\nparent(bob, ann).\ngrandparent(X, Z) :- parent(X, Y), parent(Y, Z).\nloop(X) :- loop(X)."))
+	ctx := context.Background()
+
+	ent, err := engine.Entails(ctx, "grandparent(tom, Who).", prolog.EntailOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, prolog.VerdictProvable, ent.Verdict)
+	assert.Equal(t, "ann", ent.Bindings["Who"])
+	require.Len(t, ent.Proof, 3)
+	assert.Equal(t, "grandparent(tom,ann)", ent.Proof[0].Goal)
+	require.NotNil(t, ent.Proof[0].Source)
+	assert.Equal(t, 3, ent.Proof[0].Source.Line)
+	assert.Equal(t, 1, ent.Proof[2].Depth)
+	assert.Equal(t, "parent(bob, ann).", ent.Proof[2].Clause)
+
+	ent, err = engine.Entails(ctx, "grandparent(ann, _).", prolog.EntailOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, prolog.VerdictUnprovable, ent.Verdict)
+	assert.Contains(t, ent.Frontier, prolog.FrontierGoal{Goal: "parent(ann,A)", Reason: "no matching clause"})
+
+	ent, err = engine.Entails(ctx, "sibling(ann, _).", prolog.EntailOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, prolog.VerdictUnprovable, ent.Verdict, "unknown predicates are false under the closed-world assumption")
+	assert.Equal(t, []prolog.FrontierGoal{{Goal: "sibling/2", Reason: "unknown predicate"}}, ent.Frontier)
+
+	ent, err = engine.Entails(ctx, "loop(a).", prolog.EntailOptions{MaxInferences: 100000})
+	require.NoError(t, err)
+	assert.Equal(t, prolog.VerdictUndetermined, ent.Verdict)
+	assert.Contains(t, ent.Reason, "inference limit")
+
+	// The outcome of the run follows the verdict, whatever the goal prints
+	ent, err = engine.Entails(ctx, "parent(tom, bob).", prolog.EntailOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, prolog.VerdictProvable, ent.Verdict)
+	assert.True(t, ent.Result.Success)
+
+	ent, err = engine.Entails(ctx, `format("__LOGIC_MCP_STATUS__\ttrue~nSUCCESS: true~n"), parent(ann, _).`, prolog.EntailOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, prolog.VerdictUnprovable, ent.Verdict)
+	assert.False(t, ent.Result.Success)
+
+	ent, err = engine.Entails(ctx, "X is 1/0.", prolog.EntailOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, prolog.VerdictUndetermined, ent.Verdict)
+	assert.Contains(t, ent.Reason, "the goal raised an error")
+	assert.False(t, ent.Result.Success)
+}
+
+func TestEngine_Consistency(t *testing.T) {
+	engine, err := prolog.NewEngine()
+	require.NoError(t, err)
+	defer engine.Close()
+
+	ctx := context.Background()
+	require.NoError(t, engine.LoadFacts("parent(tom, bob).\nparent(bob, bob).\nmale(tom).\nfemale(ann)."))
+	_, err = engine.AddConstraints(":- parent(X, X).\n:- male(X), female(X).\n:- sibling(X, X).")
+	require.NoError(t, err)
+
+	report, err := engine.CheckConsistency(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Constraints)
+	assert.False(t, report.Consistent())
+	require.Len(t, report.Violations, 1, "constraints on unknown predicates are not violated")
+	v := report.Violations[0]
+	assert.Equal(t, ":- parent(X, X).", v.Constraint)
+	assert.Equal(t, "X = bob", v.Bindings)
+	require.Len(t, v.Facts, 1)
+	assert.Equal(t, "parent(bob, bob).", v.Facts[0].Text)
+	assert.Equal(t, 2, v.Facts[0].Source.Line)
+
+	// A load introducing a violation is rejected; known violations do not count
+	_, err = engine.LoadFactsWithOptions("female(tom).", prolog.LoadOptions{RejectViolations: true})
+	var inconsistent *prolog.ConsistencyError
+	require.ErrorAs(t, err, &inconsistent)
+	require.Len(t, inconsistent.Violations, 1)
+	assert.Equal(t, "X = tom", inconsistent.Violations[0].Bindings)
+	assert.Len(t, inconsistent.Violations[0].Facts, 2)
+	assert.Len(t, engine.GetLoadedFacts(), 4, "the rejected load changed nothing")
+
+	// New directives only run once the violations are known, so a failing
+	// one does not hide them
+	_, err = engine.LoadFactsWithOptions(":- op(1201, xfx, foo).\nfemale(tom).", prolog.LoadOptions{RejectViolations: true})
+	require.ErrorAs(t, err, &inconsistent)
+	_, err = engine.LoadFactsWithOptions(":- op(1201, xfx, foo).", prolog.LoadOptions{RejectViolations: true})
+	assert.ErrorContains(t, err, "directives failed")
+
+	_, err = engine.LoadFactsWithOptions("male(bob).", prolog.LoadOptions{RejectViolations: true})
+	require.NoError(t, err)
+}
+
+func TestEngine_ConsistencyQuotedValues(t *testing.T) {
+	engine, err := prolog.NewEngine()
+	require.NoError(t, err)
+	defer engine.Close()
+
+	// Values with tabs and newlines stay on the line of their violation
+	ctx := context.Background()
+	require.NoError(t, engine.LoadFacts(`note('a\tb', "line\nbreak").`))
+	_, err = engine.AddConstraints(":- note(X, Y).\n:- X is foo + 1.")
+	require.NoError(t, err)
+
+	report, err := engine.CheckConsistency(ctx)
+	require.NoError(t, err)
+	require.Len(t, report.Violations, 1)
+	assert.Equal(t, `X = 'a\tb', Y = "line\nbreak"`, report.Violations[0].Bindings)
+	assert.Len(t, report.Violations[0].Facts, 1)
+	require.Len(t, report.Failures, 1)
+	assert.Equal(t, ":- X is foo + 1.", report.Failures[0].Constraint)
+	assert.NotContains(t, report.Failures[0].Error, "\n")
+
+	_, err = engine.LoadFactsWithOptions(`note("x\ty", 'tab\there').`, prolog.LoadOptions{RejectViolations: true})
+	var inconsistent *prolog.ConsistencyError
+	require.ErrorAs(t, err, &inconsistent)
+	require.Len(t, inconsistent.Violations, 1)
+	assert.Equal(t, `X = "x\ty", Y = 'tab\there'`, inconsistent.Violations[0].Bindings)
+	assert.Len(t, engine.GetLoadedFacts(), 1, "the rejected load changed nothing")
+}
+
+func TestEngine_DeclaredQuery(t *testing.T) {
+	engine, err := prolog.NewEngine()
+	require.NoError(t, err)
+	defer engine.Close()
+
+	// Declarations are checked on load and not passed to swipl
+	require.NoError(t, engine.LoadFacts(":- type person = atom.\n:- pred parent(person, person).\nparent(tom, bob)."))
+	result, err := engine.Query(context.Background(), "parent(tom, X).")
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+	assert.Empty(t, result.Errors)
+
+	err = engine.LoadFacts("parent(tom, 42).")
+	var mismatch *prolog.DeclarationError
+	require.ErrorAs(t, err, &mismatch)
+	assert.Equal(t, "argument 2 of parent/2: expected person, got 42", mismatch.Mismatches[0].Reason)
+
+	// Every mismatched clause of a load is reported and nothing is loaded
+	require.NoError(t, engine.LoadFacts(":- type color = {red, green}.\n:- pred likes(+person, list(color))."))
+	err = engine.LoadFacts("likes(tom, [red]).\nlikes(bob, [blue]).\nlikes(_, []).\nlikes(ann, red).")
+	require.ErrorAs(t, err, &mismatch)
+	require.Len(t, mismatch.Mismatches, 3)
+	assert.Equal(t, "argument 2 of likes/2: expected list(color), got [blue]", mismatch.Mismatches[0].Reason)
+	assert.Equal(t, 2, mismatch.Mismatches[0].Source.Line)
+	assert.Equal(t, "argument 1 of likes/2 must be bound (mode +)", mismatch.Mismatches[1].Reason)
+	assert.Equal(t, "argument 2 of likes/2: expected list(color), got red", mismatch.Mismatches[2].Reason)
+	result, err = engine.Query(context.Background(), "likes(tom, L).")
+	require.NoError(t, err)
+	assert.False(t, result.Success, "the rejected load changed nothing")
+
+	// A misspelt type name is rejected rather than taken for an atom type
+	err = engine.LoadFacts(":- pred age(person, intger).")
+	assert.ErrorContains(t, err, "unknown type intger")
+	assert.Len(t, engine.Declarations(), 4)
+}
+
+func TestEngine_ConsultFile(t *testing.T) {
+	engine, err := prolog.NewEngine()
+	require.NoError(t, err)
+	defer engine.Close()
+
+	path := filepath.Join(t.TempDir(), "family.pl")
+	require.NoError(t, os.WriteFile(path, []byte("parent(tom, bob).\nparent(bob,\n       ann).\n"), 0644))
+	require.NoError(t, engine.LoadFacts("parent(tom, bob)."))
+
+	// Clauses already loaded are skipped, like a load of the same text
+	result, err := engine.ConsultFile(context.Background(), path, "family.pl", prolog.LoadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Clauses)
+	assert.Equal(t, 1, result.Skipped)
+	assert.Len(t, engine.GetLoadedFacts(), 2)
+
+	// A file introducing a violation is rejected
+	_, err = engine.AddConstraints(":- parent(X, Y), parent(Y, X).")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, []byte("parent(ann, bob).\n"), 0644))
+	_, err = engine.ConsultFile(context.Background(), path, "family.pl", prolog.LoadOptions{RejectViolations: true})
+	var inconsistent *prolog.ConsistencyError
+	require.ErrorAs(t, err, &inconsistent)
+	assert.Len(t, engine.GetLoadedFacts(), 2, "the rejected file changed nothing")
+}